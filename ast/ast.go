@@ -48,9 +48,10 @@ func (p *Program) String() string {
 
 // Statements
 type LetStatement struct {
-	Token token.Token // the token.LET token
-	Name  *Identifier
-	Value Expression
+	Token    token.Token // the token.LET token
+	Name     *Identifier
+	Value    Expression
+	Exported bool // preceded by 'export', making it part of a module's exports
 }
 
 func (ls *LetStatement) statementNode()       {}
@@ -58,6 +59,9 @@ func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
+	if ls.Exported {
+		out.WriteString("export ")
+	}
 	out.WriteString(ls.TokenLiteral() + " ")
 	out.WriteString(ls.Name.String())
 	out.WriteString(" = ")
@@ -92,6 +96,27 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+type ThrowStatement struct {
+	Token token.Token // the 'throw' token
+	Value Expression
+}
+
+func (ts *ThrowStatement) statementNode()       {}
+func (ts *ThrowStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *ThrowStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ts.TokenLiteral() + " ")
+
+	if ts.Value != nil {
+		out.WriteString(ts.Value.String())
+	}
+
+	out.WriteString(";")
+
+	return out.String()
+}
+
 type ExpressionStatement struct {
 	Token      token.Token // the first token of the expression
 	Expression Expression
@@ -109,6 +134,7 @@ func (es *ExpressionStatement) String() string {
 type BlockStatement struct {
 	Token      token.Token // the { token
 	Statements []Statement
+	Rbrace     token.Token // the } token
 }
 
 func (bs *BlockStatement) statementNode()       {}
@@ -216,6 +242,36 @@ func (ie *IfExpression) String() string {
 	return out.String()
 }
 
+// TryExpression evaluates to the value of Block, or to the value of Catch
+// when Block throws. Finally, if any, runs after either of them.
+type TryExpression struct {
+	Token   token.Token // The 'try' token
+	Block   *BlockStatement
+	Param   *Identifier // bound to the error caught
+	Catch   *BlockStatement
+	Finally *BlockStatement
+}
+
+func (te *TryExpression) expressionNode()      {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("try ")
+	out.WriteString(te.Block.String())
+	out.WriteString(" catch (")
+	out.WriteString(te.Param.String())
+	out.WriteString(") ")
+	out.WriteString(te.Catch.String())
+
+	if te.Finally != nil {
+		out.WriteString(" finally ")
+		out.WriteString(te.Finally.String())
+	}
+
+	return out.String()
+}
+
 type FunctionLiteral struct {
 	Token      token.Token // The 'fn' token
 	Parameters []*Identifier
@@ -245,6 +301,7 @@ type CallExpression struct {
 	Token     token.Token // The '(' token
 	Function  Expression  // Identifier or FunctionLiteral
 	Arguments []Expression
+	Tail      bool // the call is in tail position, see MarkTailCalls
 }
 
 func (ce *CallExpression) expressionNode()      {}
@@ -319,6 +376,7 @@ func (ie *IndexExpression) String() string {
 type HashLiteral struct {
 	Token token.Token // the '{' token
 	Pairs map[Expression]Expression
+	Keys  []Expression // keys of Pairs in source order
 }
 
 func (hl *HashLiteral) expressionNode()      {}
@@ -327,8 +385,8 @@ func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for key, value := range hl.Pairs {
-		pairs = append(pairs, key.String()+":"+value.String())
+	for _, key := range hl.Keys {
+		pairs = append(pairs, key.String()+":"+hl.Pairs[key].String())
 	}
 
 	out.WriteString("{")
@@ -337,3 +395,39 @@ func (hl *HashLiteral) String() string {
 
 	return out.String()
 }
+
+type MacroLiteral struct {
+	Token      token.Token // The 'macro' token
+	Parameters []*Identifier
+	Body       *BlockStatement
+}
+
+func (ml *MacroLiteral) expressionNode()      {}
+func (ml *MacroLiteral) TokenLiteral() string { return ml.Token.Literal }
+func (ml *MacroLiteral) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range ml.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString(ml.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(ml.Body.String())
+
+	return out.String()
+}
+
+type ImportExpression struct {
+	Token token.Token // The 'import' token
+	Path  string
+}
+
+func (ie *ImportExpression) expressionNode()      {}
+func (ie *ImportExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *ImportExpression) String() string {
+	return ie.TokenLiteral() + ` "` + ie.Path + `"`
+}
@@ -0,0 +1,99 @@
+package ast
+
+// ModifierFunc is applied to every node by Modify. The returned node
+// replaces the passed one in the tree.
+type ModifierFunc func(Node) Node
+
+// Modify rewrites an AST bottom-up: the children of node are modified
+// first, then modifier is applied to node itself and its result returned.
+func Modify(node Node, modifier ModifierFunc) Node {
+	switch node := node.(type) {
+	// Statements
+	case *Program:
+		for i, stmt := range node.Statements {
+			node.Statements[i], _ = Modify(stmt, modifier).(Statement)
+		}
+
+	case *BlockStatement:
+		for i, stmt := range node.Statements {
+			node.Statements[i], _ = Modify(stmt, modifier).(Statement)
+		}
+
+	case *ExpressionStatement:
+		node.Expression, _ = Modify(node.Expression, modifier).(Expression)
+
+	case *ReturnStatement:
+		node.ReturnValue, _ = Modify(node.ReturnValue, modifier).(Expression)
+
+	case *ThrowStatement:
+		node.Value, _ = Modify(node.Value, modifier).(Expression)
+
+	case *LetStatement:
+		node.Name, _ = Modify(node.Name, modifier).(*Identifier)
+		node.Value, _ = Modify(node.Value, modifier).(Expression)
+
+	// Expressions
+	case *PrefixExpression:
+		node.Right, _ = Modify(node.Right, modifier).(Expression)
+
+	case *InfixExpression:
+		node.Left, _ = Modify(node.Left, modifier).(Expression)
+		node.Right, _ = Modify(node.Right, modifier).(Expression)
+
+	case *IfExpression:
+		node.Condition, _ = Modify(node.Condition, modifier).(Expression)
+		node.Consequence, _ = Modify(node.Consequence, modifier).(*BlockStatement)
+		if node.Alternative != nil {
+			node.Alternative, _ = Modify(node.Alternative, modifier).(*BlockStatement)
+		}
+
+	case *TryExpression:
+		node.Block, _ = Modify(node.Block, modifier).(*BlockStatement)
+		node.Param, _ = Modify(node.Param, modifier).(*Identifier)
+		node.Catch, _ = Modify(node.Catch, modifier).(*BlockStatement)
+		if node.Finally != nil {
+			node.Finally, _ = Modify(node.Finally, modifier).(*BlockStatement)
+		}
+
+	case *FunctionLiteral:
+		for i, param := range node.Parameters {
+			node.Parameters[i], _ = Modify(param, modifier).(*Identifier)
+		}
+		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+
+	case *MacroLiteral:
+		for i, param := range node.Parameters {
+			node.Parameters[i], _ = Modify(param, modifier).(*Identifier)
+		}
+		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+
+	case *CallExpression:
+		node.Function, _ = Modify(node.Function, modifier).(Expression)
+		for i, arg := range node.Arguments {
+			node.Arguments[i], _ = Modify(arg, modifier).(Expression)
+		}
+
+	case *ArrayLiteral:
+		for i, el := range node.Elements {
+			node.Elements[i], _ = Modify(el, modifier).(Expression)
+		}
+
+	case *IndexExpression:
+		node.Left, _ = Modify(node.Left, modifier).(Expression)
+		node.Index, _ = Modify(node.Index, modifier).(Expression)
+
+	case *HashLiteral:
+		pairs := make(map[Expression]Expression, len(node.Pairs))
+		keys := make([]Expression, 0, len(node.Keys))
+		for _, key := range node.Keys {
+			newKey, _ := Modify(key, modifier).(Expression)
+			newValue, _ := Modify(node.Pairs[key], modifier).(Expression)
+			pairs[newKey] = newValue
+			keys = append(keys, newKey)
+		}
+		node.Pairs = pairs
+		node.Keys = keys
+	}
+
+	return modifier(node)
+}
@@ -0,0 +1,190 @@
+package ast
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestModify(t *testing.T) {
+	one := func() Expression { return &IntegerLiteral{Value: 1} }
+	two := func() Expression { return &IntegerLiteral{Value: 2} }
+
+	turnOneIntoTwo := func(node Node) Node {
+		integer, ok := node.(*IntegerLiteral)
+		if !ok {
+			return node
+		}
+
+		if integer.Value != 1 {
+			return node
+		}
+
+		integer.Value = 2
+		return integer
+	}
+
+	tests := []struct {
+		input    Node
+		expected Node
+	}{
+		{
+			one(),
+			two(),
+		},
+		{
+			&Program{
+				Statements: []Statement{
+					&ExpressionStatement{Expression: one()},
+				},
+			},
+			&Program{
+				Statements: []Statement{
+					&ExpressionStatement{Expression: two()},
+				},
+			},
+		},
+		{
+			&InfixExpression{Left: one(), Operator: "+", Right: two()},
+			&InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{
+			&InfixExpression{Left: two(), Operator: "+", Right: one()},
+			&InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{
+			&PrefixExpression{Operator: "-", Right: one()},
+			&PrefixExpression{Operator: "-", Right: two()},
+		},
+		{
+			&IndexExpression{Left: one(), Index: one()},
+			&IndexExpression{Left: two(), Index: two()},
+		},
+		{
+			&IfExpression{
+				Condition: one(),
+				Consequence: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: one()},
+					},
+				},
+				Alternative: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: one()},
+					},
+				},
+			},
+			&IfExpression{
+				Condition: two(),
+				Consequence: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: two()},
+					},
+				},
+				Alternative: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: two()},
+					},
+				},
+			},
+		},
+		{
+			&ReturnStatement{ReturnValue: one()},
+			&ReturnStatement{ReturnValue: two()},
+		},
+		{
+			&LetStatement{Value: one()},
+			&LetStatement{Value: two()},
+		},
+		{
+			&FunctionLiteral{
+				Parameters: []*Identifier{},
+				Body: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: one()},
+					},
+				},
+			},
+			&FunctionLiteral{
+				Parameters: []*Identifier{},
+				Body: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: two()},
+					},
+				},
+			},
+		},
+		{
+			&CallExpression{Function: one(), Arguments: []Expression{one(), two()}},
+			&CallExpression{Function: two(), Arguments: []Expression{two(), two()}},
+		},
+		{
+			&ArrayLiteral{Elements: []Expression{one(), one()}},
+			&ArrayLiteral{Elements: []Expression{two(), two()}},
+		},
+	}
+
+	for _, tt := range tests {
+		modified := Modify(tt.input, turnOneIntoTwo)
+
+		if !reflect.DeepEqual(modified, tt.expected) {
+			t.Errorf("not equal. got=%#v, want=%#v", modified, tt.expected)
+		}
+	}
+}
+
+func TestModifyHashLiteral(t *testing.T) {
+	one := &IntegerLiteral{Value: 1}
+	two := &IntegerLiteral{Value: 2}
+
+	hashLiteral := &HashLiteral{
+		Pairs: map[Expression]Expression{one: one, two: two},
+		Keys:  []Expression{one, two},
+	}
+
+	turnOneIntoTwo := func(node Node) Node {
+		integer, ok := node.(*IntegerLiteral)
+		if !ok || integer.Value != 1 {
+			return node
+		}
+		return &IntegerLiteral{Value: 2}
+	}
+
+	Modify(hashLiteral, turnOneIntoTwo)
+
+	if len(hashLiteral.Keys) != 2 {
+		t.Fatalf("wrong number of keys. got=%d", len(hashLiteral.Keys))
+	}
+
+	for _, key := range hashLiteral.Keys {
+		key, _ := key.(*IntegerLiteral)
+		if key.Value != 2 {
+			t.Errorf("key is not %d, got=%d", 2, key.Value)
+		}
+		value, _ := hashLiteral.Pairs[key].(*IntegerLiteral)
+		if value.Value != 2 {
+			t.Errorf("value is not %d, got=%d", 2, value.Value)
+		}
+	}
+}
+
+func TestModifyRenamesParameters(t *testing.T) {
+	fn := &FunctionLiteral{
+		Parameters: []*Identifier{{Value: "x"}},
+		Body: &BlockStatement{
+			Statements: []Statement{
+				&ExpressionStatement{Expression: &Identifier{Value: "x"}},
+			},
+		},
+	}
+
+	Modify(fn, func(node Node) Node {
+		if ident, ok := node.(*Identifier); ok && ident.Value == "x" {
+			return &Identifier{Value: "y"}
+		}
+		return node
+	})
+
+	if fn.String() != "(y) y" {
+		t.Errorf("fn.String() wrong. got=%q", fn.String())
+	}
+}
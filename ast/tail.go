@@ -0,0 +1,42 @@
+package ast
+
+// MarkTailCalls marks the calls in tail position in the body of fn, those
+// whose value is returned by fn as it is: the value of a return statement
+// and the value of the last statement of the body, looking into the
+// branches of if expressions. Calls in try expressions are never in tail
+// position, as the try expression must still catch their errors.
+func MarkTailCalls(fn *FunctionLiteral) {
+	if fn.Body == nil {
+		return
+	}
+
+	Inspect(fn.Body, func(node Node) bool {
+		switch node := node.(type) {
+		case *FunctionLiteral, *MacroLiteral, *TryExpression:
+			return false
+		case *ReturnStatement:
+			markTailExpression(node.ReturnValue)
+		}
+		return true
+	})
+	markTailBlock(fn.Body)
+}
+
+func markTailBlock(block *BlockStatement) {
+	if block == nil || len(block.Statements) == 0 {
+		return
+	}
+	if stmt, ok := block.Statements[len(block.Statements)-1].(*ExpressionStatement); ok {
+		markTailExpression(stmt.Expression)
+	}
+}
+
+func markTailExpression(exp Expression) {
+	switch exp := exp.(type) {
+	case *CallExpression:
+		exp.Tail = true
+	case *IfExpression:
+		markTailBlock(exp.Consequence)
+		markTailBlock(exp.Alternative)
+	}
+}
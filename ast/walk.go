@@ -0,0 +1,137 @@
+package ast
+
+// A Visitor's Visit method is invoked for each node encountered by Walk.
+// If the result visitor w is not nil, Walk visits each of the children
+// of node with the visitor w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses an AST in depth-first order: It starts by calling
+// v.Visit(node); node must not be nil. If the visitor w returned by
+// v.Visit(node) is not nil, Walk is invoked recursively with visitor
+// w for each of the non-nil children of node, followed by a call of
+// w.Visit(nil).
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch node := node.(type) {
+	// Statements
+	case *Program:
+		walkStatementList(v, node.Statements)
+
+	case *BlockStatement:
+		walkStatementList(v, node.Statements)
+
+	case *ExpressionStatement:
+		if node.Expression != nil {
+			Walk(v, node.Expression)
+		}
+
+	case *ReturnStatement:
+		if node.ReturnValue != nil {
+			Walk(v, node.ReturnValue)
+		}
+
+	case *ThrowStatement:
+		if node.Value != nil {
+			Walk(v, node.Value)
+		}
+
+	case *LetStatement:
+		if node.Name != nil {
+			Walk(v, node.Name)
+		}
+		if node.Value != nil {
+			Walk(v, node.Value)
+		}
+
+	// Expressions
+	case *Identifier, *Boolean, *IntegerLiteral, *StringLiteral, *ImportExpression:
+		// nothing to do
+
+	case *PrefixExpression:
+		Walk(v, node.Right)
+
+	case *InfixExpression:
+		Walk(v, node.Left)
+		Walk(v, node.Right)
+
+	case *IfExpression:
+		Walk(v, node.Condition)
+		Walk(v, node.Consequence)
+		if node.Alternative != nil {
+			Walk(v, node.Alternative)
+		}
+
+	case *TryExpression:
+		Walk(v, node.Block)
+		Walk(v, node.Param)
+		Walk(v, node.Catch)
+		if node.Finally != nil {
+			Walk(v, node.Finally)
+		}
+
+	case *FunctionLiteral:
+		for _, param := range node.Parameters {
+			Walk(v, param)
+		}
+		Walk(v, node.Body)
+
+	case *MacroLiteral:
+		for _, param := range node.Parameters {
+			Walk(v, param)
+		}
+		Walk(v, node.Body)
+
+	case *CallExpression:
+		Walk(v, node.Function)
+		walkExpressionList(v, node.Arguments)
+
+	case *ArrayLiteral:
+		walkExpressionList(v, node.Elements)
+
+	case *IndexExpression:
+		Walk(v, node.Left)
+		Walk(v, node.Index)
+
+	case *HashLiteral:
+		for _, key := range node.Keys {
+			Walk(v, key)
+			Walk(v, node.Pairs[key])
+		}
+	}
+
+	v.Visit(nil)
+}
+
+func walkStatementList(v Visitor, list []Statement) {
+	for _, stmt := range list {
+		Walk(v, stmt)
+	}
+}
+
+func walkExpressionList(v Visitor, list []Expression) {
+	for _, exp := range list {
+		Walk(v, exp)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses an AST in depth-first order: It starts by calling
+// f(node); node must not be nil. If f returns true, Inspect invokes f
+// recursively for each of the non-nil children of node, followed by a
+// call of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
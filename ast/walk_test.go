@@ -0,0 +1,106 @@
+package ast
+
+import (
+	"fmt"
+	"monkey-compiler/token"
+	"reflect"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	one := func() Expression { return &IntegerLiteral{Value: 1} }
+	ident := func(name string) *Identifier { return &Identifier{Value: name} }
+
+	key := &StringLiteral{Value: "k"}
+
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Name: ident("f"),
+				Value: &FunctionLiteral{
+					Parameters: []*Identifier{ident("a"), ident("b")},
+					Body: &BlockStatement{
+						Statements: []Statement{
+							&ReturnStatement{ReturnValue: &InfixExpression{
+								Left: ident("a"), Operator: "+", Right: ident("b"),
+							}},
+						},
+					},
+				},
+			},
+			&ExpressionStatement{Expression: &IfExpression{
+				Condition:   &Boolean{Value: true},
+				Consequence: &BlockStatement{},
+				Alternative: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: &PrefixExpression{Operator: "-", Right: one()}},
+				}},
+			}},
+			&ExpressionStatement{Expression: &IndexExpression{
+				Left: &ArrayLiteral{Elements: []Expression{one()}},
+				Index: &CallExpression{
+					Function: ident("f"),
+					Arguments: []Expression{&HashLiteral{
+						Pairs: map[Expression]Expression{key: one()},
+						Keys:  []Expression{key},
+					}},
+				},
+			}},
+		},
+	}
+
+	var visited []string
+	Inspect(program, func(node Node) bool {
+		if node != nil {
+			visited = append(visited, fmt.Sprintf("%T", node))
+		}
+		return true
+	})
+
+	expected := []string{
+		"*ast.Program",
+		"*ast.LetStatement", "*ast.Identifier",
+		"*ast.FunctionLiteral", "*ast.Identifier", "*ast.Identifier",
+		"*ast.BlockStatement", "*ast.ReturnStatement",
+		"*ast.InfixExpression", "*ast.Identifier", "*ast.Identifier",
+		"*ast.ExpressionStatement", "*ast.IfExpression", "*ast.Boolean",
+		"*ast.BlockStatement", "*ast.BlockStatement",
+		"*ast.ExpressionStatement", "*ast.PrefixExpression", "*ast.IntegerLiteral",
+		"*ast.ExpressionStatement", "*ast.IndexExpression",
+		"*ast.ArrayLiteral", "*ast.IntegerLiteral",
+		"*ast.CallExpression", "*ast.Identifier",
+		"*ast.HashLiteral", "*ast.StringLiteral", "*ast.IntegerLiteral",
+	}
+
+	if !reflect.DeepEqual(visited, expected) {
+		t.Errorf("wrong visiting order.\nwant=%v\ngot=%v", expected, visited)
+	}
+}
+
+func TestInspectSkipsChildren(t *testing.T) {
+	program := &Program{
+		Statements: []Statement{
+			&ExpressionStatement{Expression: &FunctionLiteral{
+				Token: token.Token{Type: token.FUNCTION, Literal: "fn"},
+				Body: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: &Identifier{Value: "inner"}},
+				}},
+			}},
+			&ExpressionStatement{Expression: &Identifier{Value: "outer"}},
+		},
+	}
+
+	var identifiers []string
+	Inspect(program, func(node Node) bool {
+		switch node := node.(type) {
+		case *FunctionLiteral:
+			return false
+		case *Identifier:
+			identifiers = append(identifiers, node.Value)
+		}
+		return true
+	})
+
+	if !reflect.DeepEqual(identifiers, []string{"outer"}) {
+		t.Errorf("wrong identifiers visited. got=%v", identifiers)
+	}
+}
@@ -0,0 +1,166 @@
+// Package bench measures how fast Monkey programs run on the evaluator and
+// on the VM. Parsing, macro expansion and compilation happen once before
+// measuring, and every run starts over from fresh globals.
+package bench
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"monkey-compiler/ast"
+	"monkey-compiler/compiler"
+	"monkey-compiler/evaluator"
+	"monkey-compiler/lexer"
+	"monkey-compiler/module"
+	"monkey-compiler/object"
+	"monkey-compiler/parser"
+	"monkey-compiler/vm"
+	"strings"
+	"testing"
+)
+
+// Engine is a way of running Monkey programs
+type Engine string
+
+const (
+	Evaluator Engine = "eval"
+	VM        Engine = "vm"
+)
+
+// Engines lists every engine
+var Engines = []Engine{Evaluator, VM}
+
+// Program is a Monkey program to measure
+type Program struct {
+	Name   string
+	Source string
+}
+
+// Programs are representative workloads: function calls, string building,
+// array processing and hash lookups
+var Programs = []Program{
+	{
+		"fibonacci",
+		`let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+fib(20)`,
+	},
+	{
+		"strings",
+		`let build = fn(i, s) { if (i == 0) { s } else { build(i - 1, s + str(i) + ",") } };
+len(split(build(500, ""), ","))`,
+	},
+	{
+		"arrays",
+		`let fill = fn(i, arr) { if (i == 0) { arr } else { fill(i - 1, push(arr, i)) } };
+let xs = fill(500, []);
+let evens = filter(xs, fn(x) { x / 2 * 2 == x });
+reduce(map(sort(evens), fn(x) { x * x }), 0, fn(acc, x) { acc + x })`,
+	},
+	{
+		"hashes",
+		`let h = reduce(range(200), {}, fn(acc, i) { merge(acc, {"k" + str(i): i}) });
+reduce(range(200), 0, fn(acc, i) { acc + h["k" + str(i)] + len(keys(h)) })`,
+	},
+}
+
+// Prepare gets src, read from file or "" if it was not, ready to run on
+// engine. The returned function runs it once and returns the value of its
+// last expression statement.
+func Prepare(engine Engine, src, file string) (func() (object.Object, error), error) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("parse error: %s", strings.Join(p.Errors(), "; "))
+	}
+
+	macroEnv := object.NewEnvironment()
+	evaluator.DefineMacros(program, macroEnv)
+	expanded, err := evaluator.ExpandMacros(program, macroEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	// output would flood the measurements
+	sandbox := &object.Sandbox{Modules: object.Modules, Stdout: ioutil.Discard}
+	builtins := sandbox.Builtins()
+	loader := module.NewLoader(module.DefaultPath()...)
+
+	switch engine {
+	case Evaluator:
+		return prepareEval(expanded, builtins, loader, file), nil
+	case VM:
+		return prepareVM(expanded, builtins, loader, file)
+	default:
+		return nil, fmt.Errorf("unknown engine %q", engine)
+	}
+}
+
+func prepareEval(
+	program ast.Node,
+	builtins []object.BuiltinDef,
+	loader *module.Loader,
+	file string,
+) func() (object.Object, error) {
+	return func() (object.Object, error) {
+		env := object.NewEnvironment()
+		env.SetBuiltins(builtins)
+		env.SetImporter(evaluator.NewImporter(loader, file))
+
+		result := evaluator.Eval(program, env)
+		if err, ok := result.(*object.Error); ok && !err.Held {
+			return nil, errors.New(err.Message)
+		}
+		return result, nil
+	}
+}
+
+func prepareVM(
+	program ast.Node,
+	builtins []object.BuiltinDef,
+	loader *module.Loader,
+	file string,
+) (func() (object.Object, error), error) {
+	symbolTable := compiler.NewSymbolTable()
+	vmBuiltins := make([]*object.Builtin, len(builtins))
+	for i, def := range builtins {
+		symbolTable.DefineBuiltin(i, def.Name)
+		vmBuiltins[i] = def.Builtin
+	}
+
+	comp := compiler.NewWithState(symbolTable, []object.Object{})
+	comp.SetLoader(loader, file)
+	if err := comp.Compile(program); err != nil {
+		return nil, err
+	}
+	byteCode := comp.ByteCode()
+
+	return func() (object.Object, error) {
+		machine := vm.NewWithBuiltins(byteCode, make([]object.Object, byteCode.NumGlobals), vmBuiltins)
+		if err := machine.Run(); err != nil {
+			return nil, err
+		}
+		return machine.LastPopped(), nil
+	}, nil
+}
+
+// Run measures running src, read from file or "" if it was not, on
+// engine. The program is run once before measuring, and an error it raises
+// is returned.
+func Run(engine Engine, src, file string) (testing.BenchmarkResult, error) {
+	run, err := Prepare(engine, src, file)
+	if err != nil {
+		return testing.BenchmarkResult{}, err
+	}
+	if _, err := run(); err != nil {
+		return testing.BenchmarkResult{}, err
+	}
+
+	var runErr error
+	result := testing.Benchmark(func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N && runErr == nil; i++ {
+			_, runErr = run()
+		}
+	})
+	return result, runErr
+}
@@ -0,0 +1,63 @@
+package bench
+
+import "testing"
+
+func TestPrograms(t *testing.T) {
+	expected := map[string]string{
+		"fibonacci": "6765",
+		"strings":   "501",
+		"arrays":    "20958500",
+		"hashes":    "59900",
+	}
+
+	for _, program := range Programs {
+		for _, engine := range Engines {
+			run, err := Prepare(engine, program.Source, "")
+			if err != nil {
+				t.Fatalf("%s on %s: %s", program.Name, engine, err)
+			}
+			result, err := run()
+			if err != nil {
+				t.Fatalf("%s on %s: %s", program.Name, engine, err)
+			}
+			if result.Inspect() != expected[program.Name] {
+				t.Errorf("%s on %s: wrong result. want=%s, got=%s",
+					program.Name, engine, expected[program.Name], result.Inspect())
+			}
+		}
+	}
+}
+
+func TestRunError(t *testing.T) {
+	for _, engine := range Engines {
+		if _, err := Run(engine, "1 + true", ""); err == nil {
+			t.Errorf("expected error on %s", engine)
+		}
+		if _, err := Run(engine, "let = 1", ""); err == nil {
+			t.Errorf("expected parse error on %s", engine)
+		}
+	}
+	if _, err := Prepare("jit", "1", ""); err == nil {
+		t.Errorf("expected error for unknown engine")
+	}
+}
+
+func BenchmarkPrograms(b *testing.B) {
+	for _, program := range Programs {
+		for _, engine := range Engines {
+			run, err := Prepare(engine, program.Source, "")
+			if err != nil {
+				b.Fatalf("%s on %s: %s", program.Name, engine, err)
+			}
+
+			b.Run(program.Name+"/"+string(engine), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if _, err := run(); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"monkey-compiler/bench"
+	"os"
+)
+
+// runBench implements `monkey bench [-engine eval|vm] files...`, measuring
+// each file on both engines unless one is chosen
+func runBench(args []string) int {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	engine := flags.String("engine", "", "measure on this engine only: eval or vm")
+	_ = flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: monkey bench [-engine eval|vm] files...")
+		return 2
+	}
+
+	engines := bench.Engines
+	switch bench.Engine(*engine) {
+	case "":
+	case bench.Evaluator, bench.VM:
+		engines = []bench.Engine{bench.Engine(*engine)}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown engine %q: want eval or vm\n", *engine)
+		return 2
+	}
+
+	status := 0
+	for _, path := range flags.Args() {
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 2
+			continue
+		}
+
+		for _, e := range engines {
+			result, err := bench.Run(e, string(src), path)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s: %s\n", path, e, err)
+				status = 1
+				continue
+			}
+			fmt.Printf("%s\t%s\t%s\t%s\n", path, e, result.String(), result.MemString())
+		}
+	}
+	return status
+}
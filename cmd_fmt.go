@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"monkey-compiler/format"
+	"os"
+)
+
+// runFmt implements `monkey fmt [-w] [-check] files...`. Without files it
+// formats standard input to standard output.
+func runFmt(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := flags.Bool("w", false, "write result to source file instead of stdout")
+	check := flags.Bool("check", false, "list files whose formatting differs and exit with status 1")
+	_ = flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		src, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		formatted, err := format.Source(src)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "<stdin>: %s\n", err)
+			return 2
+		}
+		if *check {
+			if !bytes.Equal(src, formatted) {
+				fmt.Println("<stdin>")
+				return 1
+			}
+			return 0
+		}
+		os.Stdout.Write(formatted)
+		return 0
+	}
+
+	status := 0
+	for _, path := range flags.Args() {
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 2
+			continue
+		}
+
+		formatted, err := format.Source(src)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+			status = 2
+			continue
+		}
+
+		switch {
+		case *check:
+			if !bytes.Equal(src, formatted) {
+				fmt.Println(path)
+				if status == 0 {
+					status = 1
+				}
+			}
+		case *write:
+			if bytes.Equal(src, formatted) {
+				continue
+			}
+			if err := ioutil.WriteFile(path, formatted, 0644); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				status = 2
+			}
+		default:
+			os.Stdout.Write(formatted)
+		}
+	}
+
+	return status
+}
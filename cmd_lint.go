@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"monkey-compiler/lint"
+	"os"
+)
+
+type fileDiagnostic struct {
+	File string `json:"file"`
+	lint.Diagnostic
+}
+
+// runLint implements `monkey lint [-json] files...`. It exits with status 1
+// when any diagnostic is reported.
+func runLint(args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print diagnostics as a JSON array")
+	_ = flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: monkey lint [-json] files...")
+		return 2
+	}
+
+	status := 0
+	found := []fileDiagnostic{}
+
+	for _, path := range flags.Args() {
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 2
+			continue
+		}
+
+		diagnostics, err := lint.Source(string(src))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+			status = 2
+			continue
+		}
+
+		for _, d := range diagnostics {
+			found = append(found, fileDiagnostic{File: path, Diagnostic: d})
+		}
+	}
+
+	if *asJSON {
+		out, _ := json.MarshalIndent(found, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		for _, d := range found {
+			fmt.Printf("%s:%d:%d: %s (%s)\n", d.File, d.Line, d.Column, d.Message, d.Rule)
+		}
+	}
+
+	if status == 0 && len(found) > 0 {
+		status = 1
+	}
+	return status
+}
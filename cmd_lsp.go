@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"monkey-compiler/lsp"
+	"os"
+)
+
+// runLsp implements `monkey lsp`, serving the Language Server Protocol on
+// stdin and stdout until the client sends exit.
+func runLsp(args []string) int {
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, "usage: monkey lsp")
+		return 2
+	}
+
+	if err := lsp.NewServer(os.Stdin, os.Stdout).Run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
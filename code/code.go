@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"sort"
 )
 
 // Opcode is a byte corresponding a instruction
@@ -29,6 +30,25 @@ const (
 	OpJump
 	OpGetGlobal
 	OpSetGlobal
+	OpArray
+	OpHash
+	OpIndex
+	OpCall
+	OpReturnValue
+	OpReturn
+	OpGetLocal
+	OpSetLocal
+	OpGetBuiltin
+	OpClosure
+	OpGetFree
+	OpCurrentClosure
+	OpImport
+	OpSetupTry
+	OpEndTry
+	OpThrow
+	OpEndFinally
+	OpTailCall
+	OpLessThan
 )
 
 // Instructions is byte array representing code
@@ -66,6 +86,8 @@ func fmtInstruction(def *Definition, operands []int) string {
 		return def.Name
 	case 1:
 		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
 	}
 
 	return fmt.Sprintf("ERROR: unexpected number of operands for %s: %d", def.Name, operandCount)
@@ -92,10 +114,38 @@ var definitions = map[Opcode]*Definition{
 	OpEqual:         {"OpEqual", []int{}},
 	OpNotEqual:      {"OpNotEqual", []int{}},
 	OpGreaterThan:   {"OpGreaterThan", []int{}},
+	OpLessThan:      {"OpLessThan", []int{}},
 	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
 	OpJump:          {"OpJump", []int{2}},
 	OpGetGlobal:     {"OpGetGlobal", []int{2}},
 	OpSetGlobal:     {"OpSetGlobal", []int{2}},
+	// OpArray and OpHash take the number of elements on the stack, which is
+	// twice the number of pairs for hashes
+	OpArray:       {"OpArray", []int{2}},
+	OpHash:        {"OpHash", []int{2}},
+	OpIndex:       {"OpIndex", []int{}},
+	OpCall:        {"OpCall", []int{1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpReturn:      {"OpReturn", []int{}},
+	OpGetLocal:    {"OpGetLocal", []int{1}},
+	OpSetLocal:    {"OpSetLocal", []int{1}},
+	OpGetBuiltin:  {"OpGetBuiltin", []int{1}},
+	// OpClosure takes the constant index of the function and the number of
+	// free variables on the stack
+	OpClosure:        {"OpClosure", []int{2, 1}},
+	OpGetFree:        {"OpGetFree", []int{1}},
+	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+	// OpImport takes the constant index of the module
+	OpImport: {"OpImport", []int{2}},
+	// OpSetupTry takes the positions of the catch and finally blocks, 0 for
+	// a try without finally
+	OpSetupTry:   {"OpSetupTry", []int{2, 2}},
+	OpEndTry:     {"OpEndTry", []int{}},
+	OpThrow:      {"OpThrow", []int{}},
+	OpEndFinally: {"OpEndFinally", []int{}},
+	// OpTailCall calls like OpCall from tail position, reusing the frame of
+	// the caller for closures
+	OpTailCall: {"OpTailCall", []int{1}},
 }
 
 // Lookup returns definition of passed opcode
@@ -128,6 +178,8 @@ func Make(opcode Opcode, operands ...int) []byte {
 		switch width {
 		case 2:
 			binary.BigEndian.PutUint16(instruction[offset:], uint16(operand))
+		case 1:
+			instruction[offset] = byte(operand)
 		}
 		offset += width
 	}
@@ -143,6 +195,8 @@ func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
 		switch width {
 		case 2:
 			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
 		}
 
 		offset += width
@@ -154,3 +208,29 @@ func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
 func ReadUint16(ins Instructions) uint16 {
 	return binary.BigEndian.Uint16(ins)
 }
+
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
+
+// Position is the source position of the instructions starting at Offset,
+// Line being 0 when they have none
+type Position struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+// Positions locates instructions in the source they were compiled from,
+// sorted by offset
+type Positions []Position
+
+// Lookup returns the source position of the instruction at offset, 0s
+// when it has none
+func (p Positions) Lookup(offset int) (line, column int) {
+	i := sort.Search(len(p), func(i int) bool { return p[i].Offset > offset })
+	if i == 0 {
+		return 0, 0
+	}
+	return p[i-1].Line, p[i-1].Column
+}
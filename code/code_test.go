@@ -17,6 +17,12 @@ func TestMake(t *testing.T) {
 		{
 			"oppop", OpPop, []int{}, []byte{byte(OpPop)},
 		},
+		{
+			"opgetlocal", OpGetLocal, []int{255}, []byte{byte(OpGetLocal), 255},
+		},
+		{
+			"opclosure", OpClosure, []int{65534, 255}, []byte{byte(OpClosure), 255, 254, 255},
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.desc, func(t *testing.T) {
@@ -41,12 +47,16 @@ func TestInstructionsString(t *testing.T) {
 		Make(OpConstant, 2),
 		Make(OpAdd),
 		Make(OpConstant, 65535),
+		Make(OpGetLocal, 1),
+		Make(OpClosure, 65535, 255),
 	}
 
 	expected := `0000 OpConstant 1
 0003 OpConstant 2
 0006 OpAdd
 0007 OpConstant 65535
+0010 OpGetLocal 1
+0012 OpClosure 65535 255
 `
 
 	concatenated := concatInstructions(instructions)
@@ -74,6 +84,12 @@ func TestReadOperands(t *testing.T) {
 		{
 			"opconstant", OpConstant, []int{65535}, 2,
 		},
+		{
+			"opgetlocal", OpGetLocal, []int{255}, 1,
+		},
+		{
+			"opclosure", OpClosure, []int{65535, 255}, 3,
+		},
 	}
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
@@ -100,3 +116,31 @@ func TestReadOperands(t *testing.T) {
 		})
 	}
 }
+
+func TestPositionsLookup(t *testing.T) {
+	positions := Positions{
+		{Offset: 3, Line: 1, Column: 5},
+		{Offset: 7, Line: 0, Column: 0},
+		{Offset: 9, Line: 2, Column: 1},
+	}
+
+	tests := []struct {
+		offset int
+		line   int
+		column int
+	}{
+		{0, 0, 0},
+		{3, 1, 5},
+		{6, 1, 5},
+		{7, 0, 0},
+		{12, 2, 1},
+	}
+
+	for _, tt := range tests {
+		line, column := positions.Lookup(tt.offset)
+		if line != tt.line || column != tt.column {
+			t.Errorf("wrong position at offset %d. want=%d:%d, got=%d:%d",
+				tt.offset, tt.line, tt.column, line, column)
+		}
+	}
+}
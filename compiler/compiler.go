@@ -4,13 +4,48 @@ import (
 	"fmt"
 	"monkey-compiler/ast"
 	"monkey-compiler/code"
+	"monkey-compiler/module"
 	"monkey-compiler/object"
+	"monkey-compiler/token"
 )
 
 // ByteCode is byte code generated by compiler
 type ByteCode struct {
 	Instructions code.Instructions
+	Positions    code.Positions // source positions of the instructions
 	Constants    []object.Object
+	NumGlobals   int // number of globals the instructions use
+}
+
+// EndsWithValue tells whether program ends with a statement that has a
+// value, an expression or return statement. Only then is the last value a
+// VM popped the value of the program.
+func EndsWithValue(program ast.Node) bool {
+	statements := program.(*ast.Program).Statements
+	if len(statements) == 0 {
+		return false
+	}
+
+	switch statements[len(statements)-1].(type) {
+	case *ast.ExpressionStatement, *ast.ReturnStatement:
+		return true
+	default:
+		return false
+	}
+}
+
+// Error is a compilation error located at the token of the offending node
+type Error struct {
+	Message string
+	Token   token.Token
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func newError(tok token.Token, format string, a ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...), Token: tok}
 }
 
 // Emitted Instruction is an instruction emitted by compiler
@@ -19,25 +54,53 @@ type EmittedInstruction struct {
 	Position int
 }
 
+// CompilationScope holds the instructions emitted for one function body,
+// or for the main program
+type CompilationScope struct {
+	instructions        code.Instructions
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+
+	positions code.Positions
+	position  token.Token // token errors raised by emitted instructions are located at
+}
+
 // Compiler is compiler of monkey
 type Compiler struct {
-	instructions code.Instructions
-	constants    []object.Object
-	symbolTable  *SymbolTable
+	constants   []object.Object
+	symbolTable *SymbolTable
 
-	lastInstruction     EmittedInstruction
-	previousInstruction EmittedInstruction
+	scopes     []CompilationScope
+	scopeIndex int
+
+	loader  *module.Loader
+	file    string                    // file being compiled, "" if none
+	modules map[string]*object.Module // compiled modules by file
+	exports []string                  // names exported so far
 }
 
 // New returns empty compiler
 func New() *Compiler {
+	return NewWithBuiltins(object.Builtins)
+}
+
+// NewWithBuiltins returns empty compiler knowing builtins instead of
+// object.Builtins, such as those granted by a sandbox. Code referring to
+// other builtins fails to compile.
+func NewWithBuiltins(builtins []object.BuiltinDef) *Compiler {
+	symbolTable := NewSymbolTable()
+	for i, v := range builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+
 	return &Compiler{
-		instructions: code.Instructions{},
-		constants:    []object.Object{},
-		symbolTable:  NewSymbolTable(),
+		constants:   []object.Object{},
+		symbolTable: symbolTable,
+
+		scopes:     []CompilationScope{{instructions: code.Instructions{}}},
+		scopeIndex: 0,
 
-		lastInstruction:     EmittedInstruction{},
-		previousInstruction: EmittedInstruction{},
+		modules: make(map[string]*object.Module),
 	}
 }
 
@@ -50,8 +113,29 @@ func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
 	return c
 }
 
+// SetLoader makes the compiler load imported modules with loader,
+// resolving relative imports against file, "" for code not read from a
+// file. Without a loader import expressions fail to compile.
+func (c *Compiler) SetLoader(loader *module.Loader, file string) {
+	c.loader = loader
+	c.file = file
+}
+
 // Compile ...
 func (c *Compiler) Compile(node ast.Node) error {
+	// a node missing from a transformed AST would otherwise compile to
+	// nothing and break the VM stack
+	if node == nil {
+		return newError(token.Token{}, "cannot compile a missing node")
+	}
+
+	if tok, ok := raisingToken(node); ok {
+		index := c.scopeIndex
+		previous := c.scopes[index].position
+		c.scopes[index].position = tok
+		defer func() { c.scopes[index].position = previous }()
+	}
+
 	switch node := node.(type) {
 	case *ast.Program:
 		for _, stmt := range node.Statements {
@@ -71,41 +155,62 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 		c.emit(code.OpPop)
 	case *ast.LetStatement:
-		if err := c.Compile(node.Value); err != nil {
+		if node.Exported && c.scopeIndex != 0 {
+			return newError(node.Token, "export outside of the top level")
+		}
+
+		// a function literal may refer to the name it is bound to
+		if fn, ok := node.Value.(*ast.FunctionLiteral); ok {
+			if err := c.compileFunction(fn, node.Name.Value); err != nil {
+				return err
+			}
+		} else if err := c.Compile(node.Value); err != nil {
 			return err
 		}
+
 		symbol := c.symbolTable.Define(node.Name.Value)
-		c.emit(code.OpSetGlobal, symbol.Index)
+		if symbol.Scope == GlobalScope {
+			c.emit(code.OpSetGlobal, symbol.Index)
+		} else {
+			c.emit(code.OpSetLocal, symbol.Index)
+		}
+		if node.Exported {
+			c.exports = append(c.exports, node.Name.Value)
+		}
+	case *ast.ReturnStatement:
+		if err := c.Compile(node.ReturnValue); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+	case *ast.ThrowStatement:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpThrow)
+	case *ast.TryExpression:
+		return c.compileTry(node)
 	case *ast.IfExpression:
 		if err := c.Compile(node.Condition); err != nil {
 			return err
 		}
 		// emit jump op with bogus operand
 		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
-		if err := c.Compile(node.Consequence); err != nil {
+		if err := c.compileBlockValue(node.Consequence); err != nil {
 			return err
 		}
-		if c.lastInstructionIsPop() {
-			c.removeLastPop()
-		}
 
 		jumpPos := c.emit(code.OpJump, 9999)
 
-		afterConsequencePos := len(c.instructions)
+		afterConsequencePos := len(c.currentInstructions())
 		c.changeOperand(jumpNotTruthyPos, afterConsequencePos)
 
 		if node.Alternative == nil {
 			c.emit(code.OpNull)
-		} else {
-			if err := c.Compile(node.Alternative); err != nil {
-				return err
-			}
-			if c.lastInstructionIsPop() {
-				c.removeLastPop()
-			}
+		} else if err := c.compileBlockValue(node.Alternative); err != nil {
+			return err
 		}
 
-		afterAlternativePos := len(c.instructions)
+		afterAlternativePos := len(c.currentInstructions())
 		c.changeOperand(jumpPos, afterAlternativePos)
 	case *ast.PrefixExpression:
 		if err := c.Compile(node.Right); err != nil {
@@ -117,23 +222,14 @@ func (c *Compiler) Compile(node ast.Node) error {
 		case "!":
 			c.emit(code.OpBang)
 		default:
-			return fmt.Errorf("unknown prefix operator: %s", node.Operator)
+			return newError(node.Token, "unknown prefix operator: %s", node.Operator)
 		}
 	case *ast.InfixExpression:
-		if node.Operator == "<" {
-			if err := c.Compile(node.Right); err != nil {
-				return err
-			}
-			if err := c.Compile(node.Left); err != nil {
-				return err
-			}
-		} else {
-			if err := c.Compile(node.Left); err != nil {
-				return err
-			}
-			if err := c.Compile(node.Right); err != nil {
-				return err
-			}
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Right); err != nil {
+			return err
 		}
 		switch node.Operator {
 		case "+":
@@ -147,23 +243,79 @@ func (c *Compiler) Compile(node ast.Node) error {
 		case ">":
 			c.emit(code.OpGreaterThan)
 		case "<":
-			c.emit(code.OpGreaterThan)
+			c.emit(code.OpLessThan)
 		case "==":
 			c.emit(code.OpEqual)
 		case "!=":
 			c.emit(code.OpNotEqual)
 		default:
-			return fmt.Errorf("unknown infix operator: %s", node.Operator)
+			return newError(node.Token, "unknown infix operator: %s", node.Operator)
 		}
 	case *ast.Identifier:
 		symbol, ok := c.symbolTable.Resolve(node.Value)
 		if !ok {
-			return fmt.Errorf("undefined variable: %s", node.Value)
+			if module, ok := object.BuiltinModule(node.Value); ok && module != "" {
+				return newError(node.Token, "builtin %s is not allowed: module %s is not granted",
+					node.Value, module)
+			}
+			return newError(node.Token, "undefined variable: %s", node.Value)
 		}
-		c.emit(code.OpGetGlobal, symbol.Index)
+		c.loadSymbol(symbol)
 	case *ast.IntegerLiteral:
 		integer := &object.Integer{Value: node.Value}
 		c.emit(code.OpConstant, c.addConstant(integer))
+	case *ast.StringLiteral:
+		str := &object.String{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(str))
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			if err := c.Compile(el); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(node.Elements))
+	case *ast.HashLiteral:
+		for _, key := range node.Keys {
+			if err := c.Compile(key); err != nil {
+				return err
+			}
+			if err := c.Compile(node.Pairs[key]); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, len(node.Keys)*2)
+	case *ast.IndexExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+	case *ast.FunctionLiteral:
+		return c.compileFunction(node, "")
+	case *ast.CallExpression:
+		if err := c.Compile(node.Function); err != nil {
+			return err
+		}
+		for _, arg := range node.Arguments {
+			if err := c.Compile(arg); err != nil {
+				return err
+			}
+		}
+		if node.Tail {
+			c.emit(code.OpTailCall, len(node.Arguments))
+		} else {
+			c.emit(code.OpCall, len(node.Arguments))
+		}
+	case *ast.ImportExpression:
+		mod, err := c.compileImport(node)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpImport, c.addConstant(mod))
+	case *ast.MacroLiteral:
+		return newError(node.Token, "macro literal outside of a top-level let statement")
 	case *ast.Boolean:
 		if node.Value {
 			c.emit(code.OpTrue)
@@ -178,22 +330,289 @@ func (c *Compiler) Compile(node ast.Node) error {
 // ByteCode ...
 func (c *Compiler) ByteCode() *ByteCode {
 	return &ByteCode{
-		Instructions: c.instructions,
+		Instructions: c.currentInstructions(),
+		Positions:    c.scopes[c.scopeIndex].positions,
 		Constants:    c.constants,
+		NumGlobals:   c.symbolTable.numDefinitions,
 	}
 }
 
+// compileFunction compiles a function literal into a closure. name is the
+// name the function is bound to by a let statement, if any.
+func (c *Compiler) compileFunction(node *ast.FunctionLiteral, name string) error {
+	c.enterScope()
+
+	if name != "" {
+		c.symbolTable.DefineFunctionName(name)
+	}
+	for _, p := range node.Parameters {
+		c.symbolTable.Define(p.Value)
+	}
+
+	if err := c.Compile(node.Body); err != nil {
+		c.leaveScope()
+		return err
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		c.replaceLastPopWithReturn()
+	}
+	if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpReturn)
+	}
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.numDefinitions
+	instructions, positions := c.leaveScope()
+
+	for _, s := range freeSymbols {
+		c.loadSymbol(s)
+	}
+
+	compiledFn := &object.CompiledFunction{
+		Instructions:  instructions,
+		Positions:     positions,
+		NumLocals:     numLocals,
+		NumParameters: len(node.Parameters),
+		Name:          name,
+	}
+	c.emit(code.OpClosure, c.addConstant(compiledFn), len(freeSymbols))
+
+	return nil
+}
+
+// compileTry compiles a try expression. The VM enters the catch block with
+// the error caught on the stack, and the finally block with the value of
+// the try expression under the reason it was entered for: null when the
+// try or catch block completed, the error to throw again or the return
+// value of a return statement. The catch block has a scope of its own.
+func (c *Compiler) compileTry(node *ast.TryExpression) error {
+	// emit setup op with bogus operands
+	setupPos := c.emit(code.OpSetupTry, 9999, 9999)
+	if err := c.compileBlockValue(node.Block); err != nil {
+		return err
+	}
+	c.emit(code.OpEndTry)
+	if node.Finally != nil {
+		c.emit(code.OpNull)
+	}
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	// the error caught is visible in the catch block only
+	catchPos := len(c.currentInstructions())
+	endBlock := c.symbolTable.Block()
+	symbol := c.symbolTable.Define(node.Param.Value)
+	if symbol.Scope == GlobalScope {
+		c.emit(code.OpSetGlobal, symbol.Index)
+	} else {
+		c.emit(code.OpSetLocal, symbol.Index)
+	}
+	err := c.compileBlockValue(node.Catch)
+	endBlock()
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpEndTry)
+
+	finallyPos := 0
+	if node.Finally != nil {
+		c.emit(code.OpNull)
+		finallyPos = len(c.currentInstructions())
+	}
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	c.replaceInstruction(setupPos, code.Make(code.OpSetupTry, catchPos, finallyPos))
+
+	if node.Finally != nil {
+		if err := c.Compile(node.Finally); err != nil {
+			return err
+		}
+		c.emit(code.OpEndFinally)
+	}
+	return nil
+}
+
+// compileImport compiles the module imported by node, or returns it from
+// the modules compiled before
+func (c *Compiler) compileImport(node *ast.ImportExpression) (*object.Module, error) {
+	if c.loader == nil {
+		return nil, newError(node.Token, "cannot import %q: no module loader", node.Path)
+	}
+
+	file, err := c.loader.Resolve(node.Path, c.file)
+	if err != nil {
+		return nil, newError(node.Token, "%s", err)
+	}
+	if mod, ok := c.modules[file]; ok {
+		return mod, nil
+	}
+
+	if err := c.loader.Begin(file); err != nil {
+		return nil, newError(node.Token, "%s", err)
+	}
+	defer c.loader.End()
+
+	program, err := c.loader.Parse(file)
+	if err != nil {
+		return nil, newError(node.Token, "%s", err)
+	}
+
+	// the module gets a global namespace of its own, sharing only the
+	// builtins and the constants
+	mc := &Compiler{
+		constants:   c.constants,
+		symbolTable: c.symbolTable.builtinTable(),
+		scopes:      []CompilationScope{{instructions: code.Instructions{}}},
+		loader:      c.loader,
+		file:        file,
+		modules:     c.modules,
+	}
+	if err := mc.Compile(program); err != nil {
+		if cerr, ok := err.(*Error); ok && cerr.Token.Line > 0 {
+			return nil, newError(node.Token, "%s:%d:%d: %s",
+				file, cerr.Token.Line, cerr.Token.Column, cerr.Message)
+		}
+		return nil, newError(node.Token, "%s: %s", file, err)
+	}
+	mc.emitExports()
+	c.constants = mc.constants
+
+	mod := &object.Module{
+		Name: file,
+		Fn: &object.CompiledFunction{
+			Instructions: mc.currentInstructions(),
+			Positions:    mc.scopes[0].positions,
+		},
+		NumGlobals: mc.symbolTable.numDefinitions,
+	}
+	c.modules[file] = mod
+	return mod, nil
+}
+
+// emitExports ends a module by returning the hash of its exports
+func (c *Compiler) emitExports() {
+	seen := make(map[string]bool)
+	numElements := 0
+	for _, name := range c.exports {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		symbol, _ := c.symbolTable.Resolve(name)
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: name}))
+		c.emit(code.OpGetGlobal, symbol.Index)
+		numElements += 2
+	}
+	c.emit(code.OpHash, numElements)
+	c.emit(code.OpReturnValue)
+}
+
+// compileBlockValue compiles a block of an if expression so that it leaves
+// its value on the stack, null when the block does not end in an expression
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement) error {
+	if err := c.Compile(block); err != nil {
+		return err
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+	return nil
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	}
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, CompilationScope{instructions: code.Instructions{}})
+	c.scopeIndex++
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+// leaveScope returns the instructions of the innermost scope and their
+// positions, and leaves it
+func (c *Compiler) leaveScope() (code.Instructions, code.Positions) {
+	instructions := c.currentInstructions()
+	positions := c.scopes[c.scopeIndex].positions
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions, positions
+}
+
 // returns position of start of added instruction
 func (c *Compiler) emit(opcode code.Opcode, operands ...int) int {
 	ins := code.Make(opcode, operands...)
 	pos := c.addInstruction(ins)
 	c.setLastInstruction(opcode, pos)
+	c.addPosition(pos)
 	return pos
 }
 
+// addPosition records the instruction at pos as raising errors at the
+// token of the node being compiled, if that differs from the instruction
+// before
+func (c *Compiler) addPosition(pos int) {
+	scope := &c.scopes[c.scopeIndex]
+	last := code.Position{}
+	if n := len(scope.positions); n > 0 {
+		last = scope.positions[n-1]
+	}
+	if last.Line == scope.position.Line && last.Column == scope.position.Column {
+		return
+	}
+	scope.positions = append(scope.positions, code.Position{
+		Offset: pos,
+		Line:   scope.position.Line,
+		Column: scope.position.Column,
+	})
+}
+
+// raisingToken returns the token the evaluator locates errors raised by
+// node at, if node may raise any at run time
+func raisingToken(node ast.Node) (token.Token, bool) {
+	switch node := node.(type) {
+	case *ast.ThrowStatement:
+		return node.Token, true
+	case *ast.PrefixExpression:
+		return node.Token, true
+	case *ast.InfixExpression:
+		return node.Token, true
+	case *ast.CallExpression:
+		return node.Token, true
+	case *ast.IndexExpression:
+		return node.Token, true
+	case *ast.HashLiteral:
+		return node.Token, true
+	case *ast.ImportExpression:
+		return node.Token, true
+	}
+	return token.Token{}, false
+}
+
 func (c *Compiler) addInstruction(ins []byte) int {
-	pos := len(c.instructions)
-	c.instructions = append(c.instructions, ins...)
+	pos := len(c.currentInstructions())
+	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), ins...)
 	return pos
 }
 
@@ -204,30 +623,49 @@ func (c *Compiler) addConstant(obj object.Object) int {
 }
 
 func (c *Compiler) setLastInstruction(opcode code.Opcode, pos int) {
-	previous := c.lastInstruction
+	previous := c.scopes[c.scopeIndex].lastInstruction
 	last := EmittedInstruction{Opcode: opcode, Position: pos}
 
-	c.previousInstruction = previous
-	c.lastInstruction = last
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
 }
 
-func (c *Compiler) lastInstructionIsPop() bool {
-	return c.lastInstruction.Opcode == code.OpPop
+func (c *Compiler) lastInstructionIs(opcode code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == opcode
 }
 
 func (c *Compiler) removeLastPop() {
-	c.instructions = c.instructions[:c.lastInstruction.Position]
-	c.lastInstruction = c.previousInstruction
+	last := c.scopes[c.scopeIndex].lastInstruction
+	previous := c.scopes[c.scopeIndex].previousInstruction
+
+	c.scopes[c.scopeIndex].instructions = c.currentInstructions()[:last.Position]
+	c.scopes[c.scopeIndex].lastInstruction = previous
+
+	positions := c.scopes[c.scopeIndex].positions
+	for len(positions) > 0 && positions[len(positions)-1].Offset >= last.Position {
+		positions = positions[:len(positions)-1]
+	}
+	c.scopes[c.scopeIndex].positions = positions
+}
+
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
 }
 
 func (c *Compiler) changeOperand(opPos int, operand int) {
-	opcode := code.Opcode(c.instructions[opPos])
+	opcode := code.Opcode(c.currentInstructions()[opPos])
 	newInstruction := code.Make(opcode, operand)
 	c.replaceInstruction(opPos, newInstruction)
 }
 
 func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
 	for i := 0; i < len(newInstruction); i++ {
-		c.instructions[pos+i] = newInstruction[i]
+		ins[pos+i] = newInstruction[i]
 	}
 }
@@ -89,11 +89,11 @@ func TestBooleanExpression(t *testing.T) {
 		{
 			desc:              "5<3",
 			input:             "5 < 3;",
-			expectedConstants: []interface{}{3, 5},
+			expectedConstants: []interface{}{5, 3},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 1),
-				code.Make(code.OpGreaterThan),
+				code.Make(code.OpLessThan),
 				code.Make(code.OpPop),
 			},
 		},
@@ -171,6 +171,50 @@ func TestConditional(t *testing.T) {
 	runCompilerTests(t, testCases)
 }
 
+func TestTryCatch(t *testing.T) {
+	testCases := []compilerTestCase{
+		{
+			desc:              "try-catch-and-throw",
+			input:             "try { 1 } catch (e) { 2 }; throw 3;",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpSetupTry, 12, 0), // 00
+				code.Make(code.OpConstant, 0),     // 05
+				code.Make(code.OpEndTry),          // 08
+				code.Make(code.OpJump, 19),        // 09
+				code.Make(code.OpSetGlobal, 0),    // 12
+				code.Make(code.OpConstant, 1),     // 15
+				code.Make(code.OpEndTry),          // 18
+				code.Make(code.OpPop),             // 19
+				code.Make(code.OpConstant, 2),     // 20
+				code.Make(code.OpThrow),           // 23
+			},
+		},
+		{
+			desc:              "try-catch-finally",
+			input:             "try { 1 } catch (e) { 2 } finally { 3 }",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpSetupTry, 13, 21), // 00
+				code.Make(code.OpConstant, 0),      // 05
+				code.Make(code.OpEndTry),           // 08
+				code.Make(code.OpNull),             // 09
+				code.Make(code.OpJump, 21),         // 10
+				code.Make(code.OpSetGlobal, 0),     // 13
+				code.Make(code.OpConstant, 1),      // 16
+				code.Make(code.OpEndTry),           // 19
+				code.Make(code.OpNull),             // 20
+				code.Make(code.OpConstant, 2),      // 21
+				code.Make(code.OpPop),              // 24
+				code.Make(code.OpEndFinally),       // 25
+				code.Make(code.OpPop),              // 26
+			},
+		},
+	}
+
+	runCompilerTests(t, testCases)
+}
+
 func TestGlobalLetStatement(t *testing.T) {
 	testCases := []compilerTestCase{
 		{
@@ -223,6 +267,526 @@ func TestGlobalLetStatement(t *testing.T) {
 	runCompilerTests(t, testCases)
 }
 
+func TestStringExpressions(t *testing.T) {
+	testCases := []compilerTestCase{
+		{
+			desc:              "string",
+			input:             `"monkey"`,
+			expectedConstants: []interface{}{"monkey"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			desc:              "concatenation",
+			input:             `"mon" + "key"`,
+			expectedConstants: []interface{}{"mon", "key"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, testCases)
+}
+
+func TestArrayLiterals(t *testing.T) {
+	testCases := []compilerTestCase{
+		{
+			desc:              "empty",
+			input:             "[]",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			desc:              "expressions",
+			input:             "[1 + 2, 3]",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpArray, 2),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, testCases)
+}
+
+func TestHashLiterals(t *testing.T) {
+	testCases := []compilerTestCase{
+		{
+			desc:              "empty",
+			input:             "{}",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpHash, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			desc:              "pairs in source order",
+			input:             "{3: 4, 1: 2 * 5}",
+			expectedConstants: []interface{}{3, 4, 1, 2, 5},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpMul),
+				code.Make(code.OpHash, 4),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, testCases)
+}
+
+func TestIndexExpressions(t *testing.T) {
+	testCases := []compilerTestCase{
+		{
+			desc:              "array",
+			input:             "[1, 2][1 + 1]",
+			expectedConstants: []interface{}{1, 2, 1, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpArray, 2),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpAdd),
+				code.Make(code.OpIndex),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			desc:              "hash",
+			input:             "{1: 2}[1]",
+			expectedConstants: []interface{}{1, 2, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpHash, 2),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpIndex),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, testCases)
+}
+
+func TestFunctions(t *testing.T) {
+	testCases := []compilerTestCase{
+		{
+			desc:  "explicit return",
+			input: "fn() { return 5 + 10 }",
+			expectedConstants: []interface{}{
+				5, 10,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			desc:  "implicit return",
+			input: "fn() { 1; 2 }",
+			expectedConstants: []interface{}{
+				1, 2,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpPop),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			desc:  "empty body",
+			input: "fn() { }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, testCases)
+}
+
+func TestFunctionCalls(t *testing.T) {
+	testCases := []compilerTestCase{
+		{
+			desc:  "without arguments",
+			input: "fn() { 24 }();",
+			expectedConstants: []interface{}{
+				24,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpCall, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			desc:  "with arguments",
+			input: "let manyArg = fn(a, b) { a; b }; manyArg(24, 25);",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpPop),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpReturnValue),
+				},
+				24, 25,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpCall, 2),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, testCases)
+}
+
+func TestLetStatementScopes(t *testing.T) {
+	testCases := []compilerTestCase{
+		{
+			desc:  "global from function",
+			input: "let num = 55; fn() { num }",
+			expectedConstants: []interface{}{
+				55,
+				[]code.Instructions{
+					code.Make(code.OpGetGlobal, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			desc:  "locals",
+			input: "fn() { let a = 55; let b = 77; a + b }",
+			expectedConstants: []interface{}{
+				55, 77,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, testCases)
+}
+
+func TestBuiltins(t *testing.T) {
+	testCases := []compilerTestCase{
+		{
+			desc:              "global",
+			input:             "len([]); push([], 1);",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 0),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetBuiltin, 5),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpCall, 2),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			desc:  "local",
+			input: "fn() { len([]) }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetBuiltin, 0),
+					code.Make(code.OpArray, 0),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, testCases)
+}
+
+func TestClosures(t *testing.T) {
+	testCases := []compilerTestCase{
+		{
+			desc:  "free variable",
+			input: "fn(a) { fn(b) { a + b } }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpClosure, 0, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			desc:  "nested free variables",
+			input: "fn(a) { fn(b) { fn(c) { a + b + c } } }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetFree, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpClosure, 0, 2),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpClosure, 1, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, testCases)
+}
+
+func TestRecursiveFunctions(t *testing.T) {
+	testCases := []compilerTestCase{
+		{
+			desc:  "global",
+			input: "let countDown = fn(x) { countDown(x - 1); }; countDown(1);",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSub),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			desc:  "local",
+			input: "let wrapper = fn() { let countDown = fn(x) { countDown(x - 1); }; countDown(1); }; wrapper();",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSub),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+				[]code.Instructions{
+					code.Make(code.OpClosure, 1, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 2),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpCall, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, testCases)
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x", "undefined variable: x"},
+		{"fn() { y }", "undefined variable: y"},
+		{"fn(a) { a }; a", "undefined variable: a"},
+		{"fn() { export let a = 1; }", "export outside of the top level"},
+		{`import "math"`, `cannot import "math": no module loader`},
+	}
+
+	for _, tt := range tests {
+		err := New().Compile(parse(tt.input))
+		if err == nil {
+			t.Errorf("expected error for %q", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
+
+func TestEndsWithValue(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"", false},
+		{"1", true},
+		{"1; let x = 2;", false},
+		{"let x = 2; return x;", true},
+		{"let x = 2; if (x > 1) { let y = 3 }", true},
+	}
+
+	for _, tt := range tests {
+		if actual := EndsWithValue(parse(tt.input)); actual != tt.expected {
+			t.Errorf("EndsWithValue(%q) wrong. want=%t, got=%t", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestCompileMissingNode(t *testing.T) {
+	program := parse("1 + 2")
+	infix := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.InfixExpression)
+	infix.Right = nil
+
+	err := New().Compile(program)
+	if err == nil {
+		t.Fatalf("expected error for a missing node")
+	}
+	if err.Error() != "cannot compile a missing node" {
+		t.Errorf("wrong error. got=%q", err.Error())
+	}
+}
+
+func TestPositions(t *testing.T) {
+	c := New()
+	if err := c.Compile(parse("1; 2 + -3;\nlen(4)")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	expected := code.Positions{
+		{Offset: 4, Line: 1, Column: 6},
+		{Offset: 7, Line: 1, Column: 8},
+		{Offset: 11, Line: 1, Column: 6},
+		{Offset: 12, Line: 0, Column: 0},
+		{Offset: 13, Line: 2, Column: 4},
+		{Offset: 20, Line: 0, Column: 0},
+	}
+	positions := c.ByteCode().Positions
+	if len(positions) != len(expected) {
+		t.Fatalf("wrong positions length. want=%v, got=%v", expected, positions)
+	}
+	for i, position := range expected {
+		if positions[i] != position {
+			t.Errorf("wrong position at %d. want=%+v, got=%+v", i, position, positions[i])
+		}
+	}
+}
+
+func TestSandboxedBuiltins(t *testing.T) {
+	builtins := (&object.Sandbox{Modules: []string{object.ModuleTime}}).Builtins()
+
+	if err := NewWithBuiltins(builtins).Compile(parse("now()")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	err := NewWithBuiltins(builtins).Compile(parse(`puts("hi")`))
+	expected := "builtin puts is not allowed: module stdout is not granted"
+	if err == nil || err.Error() != expected {
+		t.Errorf("wrong error. want=%q, got=%v", expected, err)
+	}
+}
+
 func runCompilerTests(t *testing.T, testCases []compilerTestCase) {
 	t.Helper()
 
@@ -256,6 +820,10 @@ func runCompilerTests(t *testing.T, testCases []compilerTestCase) {
 				switch c := c.(type) {
 				case int:
 					testIntegerObject(t, int64(c), byteCode.Constants[i])
+				case string:
+					testStringObject(t, c, byteCode.Constants[i])
+				case []code.Instructions:
+					testCompiledFunction(t, c, byteCode.Constants[i])
 				}
 			}
 		})
@@ -288,3 +856,30 @@ func testIntegerObject(t *testing.T, expected int64, actual object.Object) {
 		t.Fatalf("integer valud wrong. want=%d, got=%d", expected, actualInteger.Value)
 	}
 }
+
+func testStringObject(t *testing.T, expected string, actual object.Object) {
+	t.Helper()
+
+	actualString, ok := actual.(*object.String)
+	if !ok {
+		t.Fatalf("could not convert to String: %+v", actual)
+	}
+
+	if actualString.Value != expected {
+		t.Fatalf("string value wrong. want=%q, got=%q", expected, actualString.Value)
+	}
+}
+
+func testCompiledFunction(t *testing.T, expected []code.Instructions, actual object.Object) {
+	t.Helper()
+
+	fn, ok := actual.(*object.CompiledFunction)
+	if !ok {
+		t.Fatalf("could not convert to CompiledFunction: %+v", actual)
+	}
+
+	expectedInstructions := concatInstructions(expected)
+	if fn.Instructions.String() != expectedInstructions.String() {
+		t.Fatalf("function instructions wrong.\nwant=%s\ngot=%s", expectedInstructions, fn.Instructions)
+	}
+}
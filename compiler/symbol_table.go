@@ -1,9 +1,15 @@
 package compiler
 
+import "sort"
+
 type SymbolScope string
 
 const (
-	GlobalScope SymbolScope = "GLOBAL"
+	GlobalScope   SymbolScope = "GLOBAL"
+	LocalScope    SymbolScope = "LOCAL"
+	BuiltinScope  SymbolScope = "BUILTIN"
+	FreeScope     SymbolScope = "FREE"
+	FunctionScope SymbolScope = "FUNCTION"
 )
 
 type Symbol struct {
@@ -13,6 +19,12 @@ type Symbol struct {
 }
 
 type SymbolTable struct {
+	Outer *SymbolTable
+
+	// FreeSymbols are the symbols of enclosing scopes referred to from this
+	// scope, in the order they are captured by a closure
+	FreeSymbols []Symbol
+
 	store          map[string]Symbol
 	numDefinitions int
 }
@@ -21,14 +33,134 @@ func NewSymbolTable() *SymbolTable {
 	return &SymbolTable{store: make(map[string]Symbol), numDefinitions: 0}
 }
 
+// NewEnclosedSymbolTable returns symbol table for local scope nested in outer
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
 func (s *SymbolTable) Define(name string) Symbol {
-	symbol := Symbol{Name: name, Scope: GlobalScope, Index: s.numDefinitions}
+	symbol := Symbol{Name: name, Index: s.numDefinitions}
+	if s.Outer == nil {
+		symbol.Scope = GlobalScope
+	} else {
+		symbol.Scope = LocalScope
+	}
+
 	s.store[name] = symbol
 	s.numDefinitions++
 	return symbol
 }
 
+// NumDefinitions returns the number of slots defined in s, including the
+// ones of names no longer visible
+func (s *SymbolTable) NumDefinitions() int {
+	return s.numDefinitions
+}
+
+// Block opens a block scope in s. Names defined in s until end is called
+// are visible up to that call only, and the names they shadowed are visible
+// again afterwards. Their slots stay taken, so closures created in the block
+// keep working.
+func (s *SymbolTable) Block() (end func()) {
+	saved := make(map[string]Symbol, len(s.store))
+	for name, symbol := range s.store {
+		saved[name] = symbol
+	}
+
+	return func() {
+		for name, symbol := range s.store {
+			if symbol.Scope != GlobalScope && symbol.Scope != LocalScope {
+				continue
+			}
+			if previous, ok := saved[name]; !ok {
+				delete(s.store, name)
+			} else if previous != symbol {
+				s.store[name] = previous
+			}
+		}
+	}
+}
+
+// DefineBuiltin registers builtin function at index without taking up a
+// definition slot
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Scope: BuiltinScope, Index: index}
+	s.store[name] = symbol
+	return symbol
+}
+
+// DefineFunctionName defines the name a function literal is bound to, so
+// that the function can refer to itself
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+	symbol := Symbol{Name: name, Scope: FunctionScope, Index: 0}
+	s.store[name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Scope: FreeScope, Index: len(s.FreeSymbols) - 1}
+	s.store[original.Name] = symbol
+	return symbol
+}
+
+// Resolve looks name up in s and its outer tables. Locals of enclosing
+// functions are turned into free symbols of s.
 func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 	symbol, ok := s.store[name]
-	return symbol, ok
+	if ok || s.Outer == nil {
+		return symbol, ok
+	}
+
+	symbol, ok = s.Outer.Resolve(name)
+	if !ok {
+		return symbol, ok
+	}
+	if symbol.Scope == GlobalScope || symbol.Scope == BuiltinScope {
+		return symbol, ok
+	}
+
+	return s.defineFree(symbol), true
+}
+
+// Clone returns a copy of s that can be defined into without affecting s.
+// The outer table is shared.
+func (s *SymbolTable) Clone() *SymbolTable {
+	clone := NewSymbolTable()
+	clone.Outer = s.Outer
+	clone.numDefinitions = s.numDefinitions
+	clone.FreeSymbols = append([]Symbol{}, s.FreeSymbols...)
+	for name, symbol := range s.store {
+		clone.store[name] = symbol
+	}
+	return clone
+}
+
+// Symbols returns the symbols defined directly in s, sorted by name
+func (s *SymbolTable) Symbols() []Symbol {
+	symbols := make([]Symbol, 0, len(s.store))
+	for _, symbol := range s.store {
+		symbols = append(symbols, symbol)
+	}
+	sort.Slice(symbols, func(i, j int) bool { return symbols[i].Name < symbols[j].Name })
+	return symbols
+}
+
+// builtinTable returns a new global symbol table defining the builtins
+// known to s
+func (s *SymbolTable) builtinTable() *SymbolTable {
+	for s.Outer != nil {
+		s = s.Outer
+	}
+
+	table := NewSymbolTable()
+	for _, symbol := range s.store {
+		if symbol.Scope == BuiltinScope {
+			table.DefineBuiltin(symbol.Index, symbol.Name)
+		}
+	}
+	return table
 }
@@ -1,6 +1,9 @@
 package compiler
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+)
 
 func TestDefine(t *testing.T) {
 	expected := map[string]Symbol{
@@ -36,3 +39,278 @@ func TestResolveGlobal(t *testing.T) {
 		}
 	}
 }
+
+func TestResolveLocal(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+	global.Define("b")
+
+	local := NewEnclosedSymbolTable(global)
+	local.Define("c")
+	local.Define("d")
+
+	expected := []Symbol{
+		{Name: "a", Scope: GlobalScope, Index: 0},
+		{Name: "b", Scope: GlobalScope, Index: 1},
+		{Name: "c", Scope: LocalScope, Index: 0},
+		{Name: "d", Scope: LocalScope, Index: 1},
+	}
+
+	for _, expSym := range expected {
+		actual, ok := local.Resolve(expSym.Name)
+		if !ok {
+			t.Fatalf("name '%s' could not be resolved", expSym.Name)
+		}
+		if actual != expSym {
+			t.Fatalf("resolved '%s' wrong. want=%+v, got=%+v", expSym.Name, expSym, actual)
+		}
+	}
+}
+
+func TestResolveNestedLocal(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	firstLocal := NewEnclosedSymbolTable(global)
+	firstLocal.Define("b")
+
+	secondLocal := NewEnclosedSymbolTable(firstLocal)
+	secondLocal.Define("b")
+	secondLocal.Define("c")
+
+	expected := []Symbol{
+		{Name: "a", Scope: GlobalScope, Index: 0},
+		{Name: "b", Scope: LocalScope, Index: 0},
+		{Name: "c", Scope: LocalScope, Index: 1},
+	}
+
+	for _, expSym := range expected {
+		actual, ok := secondLocal.Resolve(expSym.Name)
+		if !ok {
+			t.Fatalf("name '%s' could not be resolved", expSym.Name)
+		}
+		if actual != expSym {
+			t.Fatalf("resolved '%s' wrong. want=%+v, got=%+v", expSym.Name, expSym, actual)
+		}
+	}
+
+	if _, ok := firstLocal.Resolve("c"); ok {
+		t.Fatalf("name 'c' should not be resolvable from outer scope")
+	}
+}
+
+func TestDefineResolveBuiltins(t *testing.T) {
+	global := NewSymbolTable()
+	firstLocal := NewEnclosedSymbolTable(global)
+	secondLocal := NewEnclosedSymbolTable(firstLocal)
+
+	expected := []Symbol{
+		{Name: "a", Scope: BuiltinScope, Index: 0},
+		{Name: "c", Scope: BuiltinScope, Index: 1},
+		{Name: "e", Scope: BuiltinScope, Index: 2},
+		{Name: "f", Scope: BuiltinScope, Index: 3},
+	}
+
+	for i, v := range expected {
+		global.DefineBuiltin(i, v.Name)
+	}
+
+	for _, table := range []*SymbolTable{global, firstLocal, secondLocal} {
+		for _, sym := range expected {
+			result, ok := table.Resolve(sym.Name)
+			if !ok {
+				t.Errorf("name %s not resolvable", sym.Name)
+				continue
+			}
+			if result != sym {
+				t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+			}
+		}
+	}
+
+	if next := global.Define("g"); next.Index != 0 {
+		t.Errorf("builtins should not take up definition slots. got index=%d", next.Index)
+	}
+}
+
+func TestSymbols(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineBuiltin(0, "len")
+	global.Define("b")
+	global.Define("a")
+
+	local := NewEnclosedSymbolTable(global)
+	local.Define("c")
+
+	expected := []Symbol{
+		{Name: "a", Scope: GlobalScope, Index: 1},
+		{Name: "b", Scope: GlobalScope, Index: 0},
+		{Name: "len", Scope: BuiltinScope, Index: 0},
+	}
+	if actual := global.Symbols(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("wrong global symbols. want=%+v, got=%+v", expected, actual)
+	}
+
+	expected = []Symbol{{Name: "c", Scope: LocalScope, Index: 0}}
+	if actual := local.Symbols(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("wrong local symbols. want=%+v, got=%+v", expected, actual)
+	}
+}
+
+func TestClone(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	clone := global.Clone()
+	if b := clone.Define("b"); b.Index != 1 {
+		t.Errorf("clone should continue numbering. got index=%d", b.Index)
+	}
+
+	if _, ok := global.Resolve("b"); ok {
+		t.Errorf("definition in clone leaked into original table")
+	}
+	if c := global.Define("c"); c.Index != 1 {
+		t.Errorf("original table numbering changed. got index=%d", c.Index)
+	}
+}
+
+func TestBlock(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	end := global.Block()
+	if a := global.Define("a"); a.Index != 1 {
+		t.Errorf("block should shadow a in a new slot. got index=%d", a.Index)
+	}
+	global.Define("b")
+	end()
+
+	if a, _ := global.Resolve("a"); a.Index != 0 {
+		t.Errorf("a not restored after block. got index=%d", a.Index)
+	}
+	if _, ok := global.Resolve("b"); ok {
+		t.Errorf("definition in block leaked out of it")
+	}
+	if n := global.NumDefinitions(); n != 3 {
+		t.Errorf("block slots should stay taken. got definitions=%d", n)
+	}
+}
+
+func TestResolveFree(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+	global.Define("b")
+
+	firstLocal := NewEnclosedSymbolTable(global)
+	firstLocal.Define("c")
+	firstLocal.Define("d")
+
+	secondLocal := NewEnclosedSymbolTable(firstLocal)
+	secondLocal.Define("e")
+	secondLocal.Define("f")
+
+	tests := []struct {
+		table               *SymbolTable
+		expectedSymbols     []Symbol
+		expectedFreeSymbols []Symbol
+	}{
+		{
+			firstLocal,
+			[]Symbol{
+				{Name: "a", Scope: GlobalScope, Index: 0},
+				{Name: "b", Scope: GlobalScope, Index: 1},
+				{Name: "c", Scope: LocalScope, Index: 0},
+				{Name: "d", Scope: LocalScope, Index: 1},
+			},
+			[]Symbol{},
+		},
+		{
+			secondLocal,
+			[]Symbol{
+				{Name: "a", Scope: GlobalScope, Index: 0},
+				{Name: "b", Scope: GlobalScope, Index: 1},
+				{Name: "c", Scope: FreeScope, Index: 0},
+				{Name: "d", Scope: FreeScope, Index: 1},
+				{Name: "e", Scope: LocalScope, Index: 0},
+				{Name: "f", Scope: LocalScope, Index: 1},
+			},
+			[]Symbol{
+				{Name: "c", Scope: LocalScope, Index: 0},
+				{Name: "d", Scope: LocalScope, Index: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, sym := range tt.expectedSymbols {
+			result, ok := tt.table.Resolve(sym.Name)
+			if !ok {
+				t.Errorf("name %s not resolvable", sym.Name)
+				continue
+			}
+			if result != sym {
+				t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+			}
+		}
+
+		if len(tt.table.FreeSymbols) != len(tt.expectedFreeSymbols) {
+			t.Errorf("wrong number of free symbols. got=%d, want=%d",
+				len(tt.table.FreeSymbols), len(tt.expectedFreeSymbols))
+			continue
+		}
+		for i, sym := range tt.expectedFreeSymbols {
+			if result := tt.table.FreeSymbols[i]; result != sym {
+				t.Errorf("wrong free symbol. got=%+v, want=%+v", result, sym)
+			}
+		}
+	}
+}
+
+func TestResolveUnresolvableFree(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	firstLocal := NewEnclosedSymbolTable(global)
+	firstLocal.Define("c")
+
+	secondLocal := NewEnclosedSymbolTable(firstLocal)
+	secondLocal.Define("e")
+
+	for _, name := range []string{"b", "d"} {
+		if _, ok := secondLocal.Resolve(name); ok {
+			t.Errorf("name %s resolved, but was expected not to", name)
+		}
+	}
+	if len(secondLocal.FreeSymbols) != 0 {
+		t.Errorf("unresolvable names should not become free. got=%+v", secondLocal.FreeSymbols)
+	}
+}
+
+func TestDefineAndResolveFunctionName(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineFunctionName("a")
+
+	expected := Symbol{Name: "a", Scope: FunctionScope, Index: 0}
+	result, ok := global.Resolve(expected.Name)
+	if !ok {
+		t.Fatalf("function name %s not resolvable", expected.Name)
+	}
+	if result != expected {
+		t.Errorf("expected %s to resolve to %+v, got=%+v", expected.Name, expected, result)
+	}
+}
+
+func TestShadowingFunctionName(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineFunctionName("a")
+	global.Define("a")
+
+	expected := Symbol{Name: "a", Scope: GlobalScope, Index: 0}
+	result, ok := global.Resolve(expected.Name)
+	if !ok {
+		t.Fatalf("name %s not resolvable", expected.Name)
+	}
+	if result != expected {
+		t.Errorf("expected %s to resolve to %+v, got=%+v", expected.Name, expected, result)
+	}
+}
@@ -0,0 +1,46 @@
+// Package conformance checks that the evaluator and the VM agree on what
+// Monkey programs do.
+package conformance
+
+import (
+	"monkey-compiler/bench"
+	"monkey-compiler/object"
+	"strings"
+)
+
+// ErrorOutcome prefixes the message of the error a program raises, or ends
+// with as a value, in its outcome
+const ErrorOutcome = "ERROR: "
+
+// normalize words error messages the way the evaluator does where the
+// engines differ by design: the VM reports undefined names when compiling
+// programs, and calls functions closures.
+var normalize = strings.NewReplacer(
+	"undefined variable: ", "identifier not found: ",
+	object.CLOSURE_OBJ, object.FUNCTION_OBJ,
+)
+
+// Outcome runs src on engine and returns the representation of the value
+// of its last expression statement, or the normalized message of the error
+// it raises or ends with, prefixed with ErrorOutcome.
+func Outcome(engine bench.Engine, src string) string {
+	run, err := bench.Prepare(engine, src, "")
+	if err != nil {
+		return errorOutcome(err.Error())
+	}
+	result, err := run()
+	if err != nil {
+		return errorOutcome(err.Error())
+	}
+	if err, ok := result.(*object.Error); ok {
+		return errorOutcome(err.Message)
+	}
+	if result == nil {
+		return "null"
+	}
+	return result.Inspect()
+}
+
+func errorOutcome(message string) string {
+	return ErrorOutcome + normalize.Replace(message)
+}
@@ -0,0 +1,103 @@
+package conformance
+
+import (
+	"monkey-compiler/bench"
+	"testing"
+)
+
+// corpus lists programs along with what both engines must make of them.
+// Programs end with an expression statement and do not evaluate to
+// functions, whose representations differ between the engines.
+var corpus = []struct {
+	name     string
+	input    string
+	expected string
+}{
+	{"arithmetic", `(5 + 10 * 2 + 15 / 3) * 2 + -10`, "50"},
+	{"overflow", `9223372036854775807 + 1`, "-9223372036854775808"},
+	{"negative division", `-7 / 2`, "-3"},
+	{"comparisons", `[1 < 2, 1 > 2, 1 == 1, 1 != 1, (1 < 2) == true, !5, !!0]`,
+		"[true, false, true, false, true, false, true]"},
+	{"string equality", `["monkey" == "mon" + "key", "a" != "a", "a" == "b"]`,
+		"[true, false, false]"},
+	{"conditionals", `if (1 > 2) { 10 } else { if (false) { 20 } else { 30 } }`, "30"},
+	{"conditional without alternative", `if (false) { 10 }`, "null"},
+	{"let statements", `let a = 5; let b = a * a; let c = a + b + 5; c`, "35"},
+	{"return at top level", `return 5; 10`, "5"},
+	{"early return", `let f = fn(x) { if (x > 5) { return "big"; } "small" }; [f(1), f(10)]`,
+		`[small, big]`},
+	{"function without body", `fn() {}()`, "null"},
+	{"closures", `let adder = fn(x) { fn(y) { x + y } }; let addTwo = adder(2); addTwo(3)`, "5"},
+	{"nested closures", `let f = fn(a) { fn(b) { fn(c) { a + b + c } } }; f(1)(2)(3)`, "6"},
+	{"recursion", `let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(15)`, "610"},
+	{"mutual recursion", `
+let even = fn(n, odd) { if (n == 0) { true } else { odd(n - 1) } };
+let odd = fn(n) { if (n == 0) { false } else { even(n - 1, odd) } };
+[even(10, odd), odd(7)]`, "[true, true]"},
+	{"tail calls", `let count = fn(n, acc) { if (n == 0) { acc } else { count(n - 1, acc + 1) } }; count(100000, 0)`,
+		"100000"},
+	{"arrays", `let a = [1, 2 * 2, 3 + 3]; [a[0], a[2], a[3], a[-1], len(a), first(a), last(a), rest(a)]`,
+		"[1, 6, null, null, 3, 1, 6, [4, 6]]"},
+	{"empty arrays", `[first([]), last([]), rest([]), len([])]`, "[null, null, null, 0]"},
+	{"hashes", `let h = {"one": 1, "two": 2, true: 3, 4: 4}; [h["one"], h[true], h[4], h["five"]]`,
+		"[1, 3, 4, null]"},
+	{"hash order", `let h = {"b": 1, "a": 2, "b": 3}; merge(delete(h, "a"), {"c": 4})`,
+		"{b: 3, c: 4}"},
+	{"higher order builtins", `
+let xs = range(1, 11);
+let evens = filter(xs, fn(x) { x / 2 * 2 == x });
+reduce(map(evens, fn(x) { x * x }), 0, fn(acc, x) { acc + x })`, "220"},
+	{"sort", `[sort([3, 1, 2]), sort(["b", "c", "a"]), sort([1, 3, 2], fn(a, b) { a > b })]`,
+		"[[1, 2, 3], [a, b, c], [3, 2, 1]]"},
+	{"string builtins", `join(map(split("a,b,c", ","), fn(s) { upper(s) + repeat("!", 2) }), "-")`,
+		"A!!-B!!-C!!"},
+	{"conversions", `[str(12) + "3", int("42") + 1, type(1), type("a"), type([]), type({}), bool(0)]`,
+		"[123, 43, INTEGER, STRING, ARRAY, HASH, true]"},
+	{"json", `json_stringify(json_parse(json_stringify({"a": [1, true, "x"]})))`,
+		`{"a":[1,true,"x"]}`},
+	{"zip and slice", `[zip([1, 2, 3], ["a", "b"]), slice([1, 2, 3, 4], 1, -1), slice("monkey", 3)]`,
+		"[[[1, a], [2, b]], [2, 3], key]"},
+	{"macros", `let unless = macro(cond, cons, alt) { quote(if (!(unquote(cond))) { unquote(cons) } else { unquote(alt) }) };
+unless(10 > 5, "not greater", "greater")`, "greater"},
+	{"try catch", `try { 1 + true } catch (e) { is_error(e) }`, "true"},
+	{"try finally", `let f = fn() { try { throw "x" } catch (e) { "caught" } finally { "ignored" } }; f()`,
+		"caught"},
+	{"thrown values", `try { throw 5 } catch (e) { e["message"] }`, "5"},
+	{"caught division by zero", `try { 1 / 0 } catch (e) { "caught" }`, "caught"},
+	{"error values", `let e = error("boom"); [is_error(e), is_error(1), e["message"]]`,
+		"[true, false, boom]"},
+	{"type mismatch", `5 + true`, "ERROR: type mismatch: INTEGER + BOOLEAN"},
+	{"comparison type mismatch", `1 < true`, "ERROR: type mismatch: INTEGER < BOOLEAN"},
+	{"comparison operand order", `(1 + true) < (2 + "a")`, "ERROR: type mismatch: INTEGER + BOOLEAN"},
+	{"unknown operator", `"a" - "b"`, "ERROR: unknown operator: STRING - STRING"},
+	{"unknown comparison", `true > false`, "ERROR: unknown operator: BOOLEAN > BOOLEAN"},
+	{"unknown prefix operator", `-true`, "ERROR: unknown operator: -BOOLEAN"},
+	{"division by zero", `let zero = 0; 10 / zero`, "ERROR: division by zero"},
+	{"too many arguments", `fn(a) { a }(1, 2)`, "ERROR: wrong number of arguments: want=1, got=2"},
+	{"too few arguments", `fn(a, b) { a }(1)`, "ERROR: wrong number of arguments: want=2, got=1"},
+	{"tail call arity stack", `let f = fn(x) { x }; let g = fn() { f(1, 2) }; try { g() } catch (e) { e["stack"] }`,
+		"[g]"},
+	{"not a function", `let x = 1; x()`, "ERROR: not a function: INTEGER"},
+	{"not a function callback", `map([1], 1)`, "ERROR: not a function: INTEGER"},
+	{"unusable hash key", `{[1]: 2}`, "ERROR: unusable as hash key: ARRAY"},
+	{"unusable hash index", `{"a": 1}[fn() { 1 }]`, "ERROR: unusable as hash key: FUNCTION"},
+	{"index not supported", `1[0]`, "ERROR: index operator not supported: INTEGER"},
+	{"undefined name", `let a = 1; b`, "ERROR: identifier not found: b"},
+	{"builtin error", `len(1)`, "ERROR: argument to `len` not supported, got INTEGER"},
+	{"uncaught throw", `throw "boom"; 1`, "ERROR: boom"},
+	{"callback error", `map([1], fn(x) { x + true })`, "ERROR: type mismatch: INTEGER + BOOLEAN"},
+	{"parse error", `let = 1`,
+		"ERROR: parse error: expected next token to be IDENT, got = instead; no prefix parse function for = found"},
+}
+
+func TestCorpus(t *testing.T) {
+	for _, tt := range corpus {
+		for _, engine := range bench.Engines {
+			got := Outcome(engine, tt.input)
+			if got != tt.expected {
+				t.Errorf("%s on %s: wrong outcome. want=%q, got=%q",
+					tt.name, engine, tt.expected, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,336 @@
+package conformance
+
+import (
+	"fmt"
+	"math/rand"
+	"monkey-compiler/bench"
+	"strings"
+	"testing"
+)
+
+// kind is the type of the values an expression generated by a generator
+// evaluates to
+type kind int
+
+const (
+	intKind kind = iota
+	boolKind
+	stringKind
+	arrayKind
+	hashKind
+	numKinds
+)
+
+type variable struct {
+	name string
+	kind kind
+}
+
+// generator writes well-typed programs, making each choice by reading a
+// byte of data. Once data runs out every choice is the first one, which
+// always ends an expression, so that small mutations of data make small
+// changes to programs. The programs do not loop or recurse, so they always
+// finish, and they only raise errors on division by zero.
+type generator struct {
+	data  []byte
+	vars  []variable
+	names int
+}
+
+// maxDepth bounds the nesting of generated expressions
+const maxDepth = 4
+
+func generate(data []byte) string {
+	g := &generator{data: data}
+
+	var out strings.Builder
+	for i := g.choose(4); i > 0; i-- {
+		k := kind(g.choose(int(numKinds)))
+		value := g.expression(k, maxDepth)
+		name := g.define(k)
+		fmt.Fprintf(&out, "let %s = %s;\n", name, value)
+	}
+	out.WriteString(g.expression(kind(g.choose(int(numKinds))), maxDepth))
+	return out.String()
+}
+
+// choose returns a choice from 0 up to but not including n
+func (g *generator) choose(n int) int {
+	if len(g.data) == 0 {
+		return 0
+	}
+	b := g.data[0]
+	g.data = g.data[1:]
+	return int(b) % n
+}
+
+// name returns a new name starting with prefix. Identifiers cannot have
+// digits, so names are numbered with letters.
+func (g *generator) name(prefix string) string {
+	g.names++
+	name := prefix
+	for n := g.names; n > 0; n /= 26 {
+		name += string(rune('a' + n%26))
+	}
+	return name
+}
+
+// define adds a variable of a kind and returns its name
+func (g *generator) define(k kind) string {
+	name := g.name("v")
+	g.vars = append(g.vars, variable{name, k})
+	return name
+}
+
+// variable returns the name of a variable of a kind in scope, or "" if
+// there is none
+func (g *generator) variable(k kind) string {
+	names := []string{}
+	for _, v := range g.vars {
+		if v.kind == k {
+			names = append(names, v.name)
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	return names[g.choose(len(names))]
+}
+
+// function returns a function literal with parameters of kinds whose body
+// evaluates to result
+func (g *generator) function(result kind, depth int, params ...kind) string {
+	scope := len(g.vars)
+	names := make([]string, len(params))
+	for i, k := range params {
+		names[i] = g.define(k)
+	}
+	body := g.expression(result, depth)
+	g.vars = g.vars[:scope]
+	return fmt.Sprintf("fn(%s) { %s }", strings.Join(names, ", "), body)
+}
+
+func (g *generator) expression(k kind, depth int) string {
+	if depth > 0 {
+		depth--
+		// choices common to all kinds
+		switch g.choose(16) {
+		case 1:
+			if name := g.variable(k); name != "" {
+				return name
+			}
+		case 2:
+			return fmt.Sprintf("if (%s) { %s } else { %s }",
+				g.expression(boolKind, depth), g.expression(k, depth), g.expression(k, depth))
+		case 3:
+			arg := kind(g.choose(int(numKinds)))
+			return fmt.Sprintf("%s(%s)",
+				g.function(k, depth, arg), g.expression(arg, depth))
+		case 4:
+			scope := len(g.vars)
+			value := g.expression(k, depth)
+			name := g.define(k)
+			result := g.expression(k, depth)
+			g.vars = g.vars[:scope]
+			return fmt.Sprintf("if (true) { let %s = %s; %s }", name, value, result)
+		case 5:
+			return fmt.Sprintf("try { %s } catch (%s) { %s }",
+				g.expression(k, depth), g.name("e"), g.expression(k, depth))
+		}
+	}
+
+	switch k {
+	case intKind:
+		return g.intExpression(depth)
+	case boolKind:
+		return g.boolExpression(depth)
+	case stringKind:
+		return g.stringExpression(depth)
+	case arrayKind:
+		return g.arrayExpression(depth)
+	default:
+		return g.hashExpression(depth)
+	}
+}
+
+func (g *generator) intExpression(depth int) string {
+	if depth == 0 {
+		return g.intLiteral()
+	}
+
+	switch g.choose(9) {
+	case 1, 2:
+		ops := []string{"+", "-", "*", "/"}
+		return fmt.Sprintf("(%s %s %s)",
+			g.expression(intKind, depth), ops[g.choose(len(ops))], g.expression(intKind, depth))
+	case 3:
+		return fmt.Sprintf("(-%s)", g.expression(intKind, depth))
+	case 4:
+		return fmt.Sprintf("len(%s)", g.expression(stringKind, depth))
+	case 5:
+		return fmt.Sprintf("len(%s)", g.expression(arrayKind, depth))
+	case 6:
+		return fmt.Sprintf("reduce(%s, %s, %s)",
+			g.expression(arrayKind, depth), g.expression(intKind, depth),
+			g.function(intKind, depth, intKind, intKind))
+	case 7:
+		return fmt.Sprintf("len(keys(%s))", g.expression(hashKind, depth))
+	default:
+		return g.intLiteral()
+	}
+}
+
+func (g *generator) intLiteral() string {
+	switch g.choose(8) {
+	case 1:
+		return "9223372036854775807"
+	case 2:
+		return fmt.Sprintf("(-%d)", g.choose(256))
+	default:
+		return fmt.Sprint(g.choose(256))
+	}
+}
+
+func (g *generator) boolExpression(depth int) string {
+	if depth == 0 {
+		return []string{"true", "false"}[g.choose(2)]
+	}
+
+	switch g.choose(8) {
+	case 1, 2:
+		ops := []string{"<", ">", "==", "!="}
+		return fmt.Sprintf("(%s %s %s)",
+			g.expression(intKind, depth), ops[g.choose(len(ops))], g.expression(intKind, depth))
+	case 3:
+		ops := []string{"==", "!="}
+		k := []kind{boolKind, stringKind}[g.choose(2)]
+		return fmt.Sprintf("(%s %s %s)",
+			g.expression(k, depth), ops[g.choose(len(ops))], g.expression(k, depth))
+	case 4:
+		return fmt.Sprintf("(!%s)", g.expression(boolKind, depth))
+	case 5:
+		return fmt.Sprintf("contains(%s, %s)",
+			g.expression(arrayKind, depth), g.expression(intKind, depth))
+	case 6:
+		return fmt.Sprintf("contains(%s, %s)",
+			g.expression(hashKind, depth), g.expression(stringKind, depth))
+	default:
+		return []string{"true", "false"}[g.choose(2)]
+	}
+}
+
+func (g *generator) stringExpression(depth int) string {
+	if depth == 0 {
+		return g.stringLiteral()
+	}
+
+	switch g.choose(7) {
+	case 1, 2:
+		return fmt.Sprintf("(%s + %s)",
+			g.expression(stringKind, depth), g.expression(stringKind, depth))
+	case 3:
+		k := []kind{intKind, boolKind, arrayKind, hashKind}[g.choose(4)]
+		return fmt.Sprintf("str(%s)", g.expression(k, depth))
+	case 4:
+		return fmt.Sprintf("upper(%s)", g.expression(stringKind, depth))
+	case 5:
+		return fmt.Sprintf("join(map(%s, %s), %s)",
+			g.expression(arrayKind, depth), g.function(stringKind, depth, intKind),
+			g.expression(stringKind, depth))
+	default:
+		return g.stringLiteral()
+	}
+}
+
+func (g *generator) stringLiteral() string {
+	literals := []string{"", "a", "b", "mon", "key"}
+	return fmt.Sprintf("%q", literals[g.choose(len(literals))])
+}
+
+func (g *generator) arrayExpression(depth int) string {
+	if depth == 0 {
+		return g.arrayLiteral(depth)
+	}
+
+	switch g.choose(8) {
+	case 1:
+		return fmt.Sprintf("push(%s, %s)",
+			g.expression(arrayKind, depth), g.expression(intKind, depth))
+	case 2:
+		return fmt.Sprintf("map(%s, %s)",
+			g.expression(arrayKind, depth), g.function(intKind, depth, intKind))
+	case 3:
+		return fmt.Sprintf("filter(%s, %s)",
+			g.expression(arrayKind, depth), g.function(boolKind, depth, intKind))
+	case 4:
+		builtins := []string{"sort", "reverse"}
+		return fmt.Sprintf("%s(%s)",
+			builtins[g.choose(len(builtins))], g.expression(arrayKind, depth))
+	case 5:
+		return fmt.Sprintf("slice(%s, %s)",
+			g.expression(arrayKind, depth), g.expression(intKind, depth))
+	case 6:
+		return fmt.Sprintf("range(%d)", g.choose(10))
+	default:
+		return g.arrayLiteral(depth)
+	}
+}
+
+func (g *generator) arrayLiteral(depth int) string {
+	elements := make([]string, g.choose(4))
+	for i := range elements {
+		elements[i] = g.expression(intKind, depth)
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+func (g *generator) hashExpression(depth int) string {
+	if depth == 0 {
+		return g.hashLiteral(depth)
+	}
+
+	switch g.choose(4) {
+	case 1:
+		return fmt.Sprintf("merge(%s, %s)",
+			g.expression(hashKind, depth), g.expression(hashKind, depth))
+	case 2:
+		return fmt.Sprintf("delete(%s, %s)",
+			g.expression(hashKind, depth), g.expression(stringKind, depth))
+	default:
+		return g.hashLiteral(depth)
+	}
+}
+
+func (g *generator) hashLiteral(depth int) string {
+	pairs := make([]string, g.choose(4))
+	for i := range pairs {
+		pairs[i] = g.expression(stringKind, depth) + ": " + g.expression(intKind, depth)
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+func testAgreement(t *testing.T, src string) {
+	evalOutcome := Outcome(bench.Evaluator, src)
+	vmOutcome := Outcome(bench.VM, src)
+	if evalOutcome != vmOutcome {
+		t.Errorf("engines disagree on\n%s\neval=%q, vm=%q", src, evalOutcome, vmOutcome)
+	}
+}
+
+func TestGeneratedPrograms(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		data := make([]byte, r.Intn(256))
+		r.Read(data)
+		testAgreement(t, generate(data))
+	}
+}
+
+func FuzzEngines(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{3, 0, 1, 2, 7, 5, 1, 3, 3, 2, 9, 1, 4})
+	f.Add([]byte("differential testing of the evaluator and the vm"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		testAgreement(t, generate(data))
+	})
+}
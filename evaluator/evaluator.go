@@ -1,18 +1,46 @@
 package evaluator
 
 import (
+	"context"
 	"fmt"
 	"monkey-compiler/ast"
+	"monkey-compiler/limit"
 	"monkey-compiler/object"
+	"monkey-compiler/token"
 )
 
 var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	NULL  = object.NULL
+	TRUE  = object.True
+	FALSE = object.False
 )
 
+// EvalContext evaluates node like Eval, but stops when ctx is done or
+// limits are exceeded. Exceeded limits are reported as *limit.LimitError and
+// cancellation as *limit.CanceledError; Monkey errors are returned as
+// *object.Error results like Eval does.
+func EvalContext(
+	ctx context.Context,
+	node ast.Node,
+	env *object.Environment,
+	limits limit.Limits,
+) (object.Object, error) {
+	meter := limit.NewMeter(ctx, limits)
+	env.SetMeter(meter)
+	defer env.SetMeter(nil)
+
+	result := Eval(node, env)
+	if err := meter.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	if err := env.Meter().Step(); err != nil {
+		return newError("%s", err)
+	}
+
 	switch node := node.(type) {
 
 	// Statements
@@ -32,18 +60,36 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 		return &object.ReturnValue{Value: val}
 
+	case *ast.ThrowStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		return locate(object.Thrown(val), node.Token)
+
 	case *ast.LetStatement:
 		val := Eval(node.Value, env)
 		if isError(val) {
 			return val
 		}
+		if fn, ok := val.(*object.Function); ok {
+			if _, ok := node.Value.(*ast.FunctionLiteral); ok {
+				fn.Name = node.Name.Value
+			}
+		}
 		env.Set(node.Name.Value, val)
 
 	// Expressions
 	case *ast.IntegerLiteral:
-		return &object.Integer{Value: node.Value}
+		if err := alloc(env, 1); err != nil {
+			return err
+		}
+		return object.NewInteger(node.Value)
 
 	case *ast.StringLiteral:
+		if err := alloc(env, 1); err != nil {
+			return err
+		}
 		return &object.String{Value: node.Value}
 
 	case *ast.Boolean:
@@ -54,7 +100,10 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right)
+		if err := alloc(env, 1); err != nil {
+			return err
+		}
+		return locate(evalPrefixExpression(node.Operator, right), node.Token)
 
 	case *ast.InfixExpression:
 		left := Eval(node.Left, env)
@@ -66,21 +115,38 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(right) {
 			return right
 		}
+		if err := alloc(env, infixSize(node.Operator, left, right)); err != nil {
+			return err
+		}
 
-		return evalInfixExpression(node.Operator, left, right)
+		return locate(evalInfixExpression(node.Operator, left, right), node.Token)
 
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
 
+	case *ast.TryExpression:
+		return evalTryExpression(node, env)
+
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
+		if err := alloc(env, 1); err != nil {
+			return err
+		}
 		return &object.Function{Parameters: params, Env: env, Body: body}
 
 	case *ast.CallExpression:
+		if node.Function.TokenLiteral() == "quote" {
+			if len(node.Arguments) != 1 {
+				return locate(newError("wrong number of arguments to quote. got=%d, want=1",
+					len(node.Arguments)), node.Token)
+			}
+			return quote(node.Arguments[0], env)
+		}
+
 		function := Eval(node.Function, env)
 		if isError(function) {
 			return function
@@ -91,13 +157,19 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return args[0]
 		}
 
-		return applyFunction(function, args)
+		if node.Tail {
+			return &tailCall{fn: function, args: args, token: node.Token}
+		}
+		return locate(applyFunction(function, args, env), node.Token)
 
 	case *ast.ArrayLiteral:
 		elements := evalExpressions(node.Elements, env)
 		if len(elements) == 1 && isError(elements[0]) {
 			return elements[0]
 		}
+		if err := alloc(env, 1); err != nil {
+			return err
+		}
 		return &object.Array{Elements: elements}
 
 	case *ast.IndexExpression:
@@ -109,11 +181,18 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(index) {
 			return index
 		}
-		return evalIndexExpression(left, index)
+		return locate(evalIndexExpression(left, index), node.Token)
 
 	case *ast.HashLiteral:
 		return evalHashLiteral(node, env)
 
+	case *ast.ImportExpression:
+		importer := env.Importer()
+		if importer == nil {
+			return locate(newError("cannot import %q: no module loader", node.Path), node.Token)
+		}
+		return locate(importer.Import(node.Path, env), node.Token)
+
 	}
 
 	return nil
@@ -125,10 +204,10 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	for _, statement := range program.Statements {
 		result = Eval(statement, env)
 
-		switch result := result.(type) {
-		case *object.ReturnValue:
-			return result.Value
-		case *object.Error:
+		if returnValue, ok := result.(*object.ReturnValue); ok {
+			return returnValue.Value
+		}
+		if isError(result) {
 			return result
 		}
 	}
@@ -145,11 +224,8 @@ func evalBlockStatement(
 	for _, statement := range block.Statements {
 		result = Eval(statement, env)
 
-		if result != nil {
-			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
-				return result
-			}
+		if isReturnValue(result) || isError(result) {
+			return result
 		}
 	}
 
@@ -174,6 +250,21 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 	}
 }
 
+// infixSize returns the number of objects an infix expression allocates.
+// Concatenations are charged by length, lest doubling a string exhaust
+// memory.
+func infixSize(operator string, left, right object.Object) int {
+	leftStr, ok := left.(*object.String)
+	if !ok || operator != "+" {
+		return 1
+	}
+	rightStr, ok := right.(*object.String)
+	if !ok {
+		return 1
+	}
+	return object.StringSize(len(leftStr.Value) + len(rightStr.Value))
+}
+
 func evalInfixExpression(
 	operator string,
 	left, right object.Object,
@@ -215,7 +306,7 @@ func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
 	}
 
 	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
+	return object.NewInteger(-value)
 }
 
 func evalIntegerInfixExpression(
@@ -227,13 +318,16 @@ func evalIntegerInfixExpression(
 
 	switch operator {
 	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
+		return object.NewInteger(leftVal + rightVal)
 	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
+		return object.NewInteger(leftVal - rightVal)
 	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
+		return object.NewInteger(leftVal * rightVal)
 	case "/":
-		return &object.Integer{Value: leftVal / rightVal}
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		return object.NewInteger(leftVal / rightVal)
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
@@ -252,14 +346,20 @@ func evalStringInfixExpression(
 	operator string,
 	left, right object.Object,
 ) object.Object {
-	if operator != "+" {
+	leftVal := left.(*object.String).Value
+	rightVal := right.(*object.String).Value
+
+	switch operator {
+	case "+":
+		return &object.String{Value: leftVal + rightVal}
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
 		return newError("unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
 	}
-
-	leftVal := left.(*object.String).Value
-	rightVal := right.(*object.String).Value
-	return &object.String{Value: leftVal + rightVal}
 }
 
 func evalIfExpression(
@@ -280,6 +380,49 @@ func evalIfExpression(
 	}
 }
 
+// evalTryExpression evaluates the try block, then the catch block if the
+// try block raised an error, and the finally block last. An error raised
+// by the catch block, or a return from either block, happens after the
+// finally block, and an error or return from the finally block overrides
+// them. The catch block is evaluated in an environment of its own.
+// Exceeded limits are not caught.
+func evalTryExpression(
+	te *ast.TryExpression,
+	env *object.Environment,
+) object.Object {
+	result := Eval(te.Block, env)
+	if isError(result) && env.Meter().Err() == nil {
+		err := result.(*object.Error)
+		recordStack(err, env)
+		err.Held = true
+		catchEnv := object.NewEnclosedEnvironment(env)
+		catchEnv.Set(te.Param.Value, err)
+		result = Eval(te.Catch, catchEnv)
+	}
+	if result == nil {
+		result = NULL
+	}
+
+	if te.Finally != nil {
+		if isError(result) {
+			recordStack(result.(*object.Error), env)
+		}
+		if final := Eval(te.Finally, env); isReturnValue(final) || isError(final) {
+			return final
+		}
+	}
+
+	return result
+}
+
+// recordStack records the functions being called in env as the stack of
+// err, unless it already has one
+func recordStack(err *object.Error, env *object.Environment) {
+	if err.Stack == nil {
+		err.Stack = env.CallStack()
+	}
+}
+
 func evalIdentifier(
 	node *ast.Identifier,
 	env *object.Environment,
@@ -288,11 +431,15 @@ func evalIdentifier(
 		return val
 	}
 
-	if builtin, ok := builtins[node.Value]; ok {
+	table := env.Builtins()
+	if table == nil {
+		table = builtins
+	}
+	if builtin, ok := table[node.Value]; ok {
 		return builtin
 	}
 
-	return newError("identifier not found: " + node.Value)
+	return locate(newError("identifier not found: %s", node.Value), node.Token)
 }
 
 func isTruthy(obj object.Object) bool {
@@ -312,11 +459,34 @@ func newError(format string, a ...interface{}) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
 
-func isError(obj object.Object) bool {
-	if obj != nil {
-		return obj.Type() == object.ERROR_OBJ
+// locate records the position of tok as where obj was raised if it is an
+// error without a position yet, so that errors keep the position of the
+// innermost node raising them
+func locate(obj object.Object, tok token.Token) object.Object {
+	if err, ok := obj.(*object.Error); ok && err.Line == 0 {
+		err.Line, err.Column = tok.Line, tok.Column
 	}
-	return false
+	return obj
+}
+
+// alloc accounts for n objects allocated in env, returning an error object
+// when that exceeds the object limit
+func alloc(env *object.Environment, n int) *object.Error {
+	if err := env.Meter().Alloc(n); err != nil {
+		return newError("%s", err)
+	}
+	return nil
+}
+
+// isError tells whether obj is an error being raised
+func isError(obj object.Object) bool {
+	err, ok := obj.(*object.Error)
+	return ok && !err.Held
+}
+
+func isReturnValue(obj object.Object) bool {
+	_, ok := obj.(*object.ReturnValue)
+	return ok
 }
 
 func evalExpressions(
@@ -336,22 +506,107 @@ func evalExpressions(
 	return result
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// applyFunction calls fn with args on behalf of code evaluated in env
+func applyFunction(fn object.Object, args []object.Object, env *object.Environment) object.Object {
 	switch fn := fn.(type) {
 
 	case *object.Function:
-		extendedEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
-		return unwrapReturnValue(evaluated)
+		meter := fn.Env.Meter()
+		if err := meter.Enter(); err != nil {
+			return newError("%s", err)
+		}
+		defer meter.Leave()
+
+		if len(args) != len(fn.Parameters) {
+			return wrongArguments(fn, args)
+		}
+
+		// tail calls to functions are made here in turn instead of
+		// nesting them
+		for {
+			if err := alloc(fn.Env, 1); err != nil {
+				return err
+			}
+
+			fn.Env.EnterCall(fn.Name)
+			extendedEnv := extendFunctionEnv(fn, args)
+			result := unwrapReturnValue(Eval(fn.Body, extendedEnv))
+
+			// a tail call fails in the frame of fn, like the calls
+			// made in its body
+			call, ok := result.(*tailCall)
+			var next *object.Function
+			if ok {
+				next, _ = call.fn.(*object.Function)
+				if next == nil {
+					result = locate(applyFunction(call.fn, call.args, fn.Env), call.token)
+				} else if len(call.args) != len(next.Parameters) {
+					result = locate(wrongArguments(next, call.args), call.token)
+				}
+			}
+			if isError(result) {
+				recordStack(result.(*object.Error), fn.Env)
+			}
+			fn.Env.LeaveCall()
+
+			if next == nil || isError(result) {
+				return result
+			}
+			fn, args = next, call.args
+		}
 
 	case *object.Builtin:
-		return fn.Fn(args...)
+		if fn.Size != nil {
+			if err := alloc(env, fn.Size(args...)); err != nil {
+				return err
+			}
+		}
+
+		var result object.Object
+		if fn.HigherOrder != nil {
+			result = fn.HigherOrder(callbackFrom(env), args...)
+		} else {
+			result = fn.Fn(args...)
+		}
+		if result == nil {
+			return NULL
+		}
+		if fn.Size == nil {
+			if err := alloc(env, object.Size(result)); err != nil {
+				return err
+			}
+		}
+		return result
 
 	default:
 		return newError("not a function: %s", fn.Type())
 	}
 }
 
+func wrongArguments(fn *object.Function, args []object.Object) *object.Error {
+	return newError("wrong number of arguments: want=%d, got=%d",
+		len(fn.Parameters), len(args))
+}
+
+// tailCall is the result of a call in tail position, which is made by
+// applyFunction once the function making it returns
+type tailCall struct {
+	fn    object.Object
+	args  []object.Object
+	token token.Token
+}
+
+func (tc *tailCall) Type() object.ObjectType { return "TAIL_CALL" }
+func (tc *tailCall) Inspect() string         { return "tail call" }
+
+// callbackFrom returns the function a higher-order builtin called from env
+// calls functions with
+func callbackFrom(env *object.Environment) object.CallFunction {
+	return func(fn object.Object, args ...object.Object) object.Object {
+		return applyFunction(fn, args, env)
+	}
+}
+
 func extendFunctionEnv(
 	fn *object.Function,
 	args []object.Object,
@@ -379,6 +634,12 @@ func evalIndexExpression(left, index object.Object) object.Object {
 		return evalArrayIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
+	case left.Type() == object.ERROR_OBJ && index.Type() == object.STRING_OBJ:
+		field, ok := left.(*object.Error).Field(index.(*object.String).Value)
+		if !ok {
+			return NULL
+		}
+		return field
 	default:
 		return newError("index operator not supported: %s", left.Type())
 	}
@@ -400,9 +661,9 @@ func evalHashLiteral(
 	node *ast.HashLiteral,
 	env *object.Environment,
 ) object.Object {
-	pairs := make(map[object.HashKey]object.HashPair)
+	hash := object.NewHash(len(node.Keys))
 
-	for keyNode, valueNode := range node.Pairs {
+	for _, keyNode := range node.Keys {
 		key := Eval(keyNode, env)
 		if isError(key) {
 			return key
@@ -410,19 +671,21 @@ func evalHashLiteral(
 
 		hashKey, ok := key.(object.Hashable)
 		if !ok {
-			return newError("unusable as hash key: %s", key.Type())
+			return locate(newError("unusable as hash key: %s", key.Type()), node.Token)
 		}
 
-		value := Eval(valueNode, env)
+		value := Eval(node.Pairs[keyNode], env)
 		if isError(value) {
 			return value
 		}
 
-		hashed := hashKey.HashKey()
-		pairs[hashed] = object.HashPair{Key: key, Value: value}
+		hash.Set(hashKey, value)
 	}
 
-	return &object.Hash{Pairs: pairs}
+	if err := alloc(env, 1); err != nil {
+		return err
+	}
+	return hash
 }
 
 func evalHashIndexExpression(hash, index object.Object) object.Object {
@@ -433,10 +696,10 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
 		return newError("unusable as hash key: %s", index.Type())
 	}
 
-	pair, ok := hashObject.Pairs[key.HashKey()]
+	value, ok := hashObject.Get(key)
 	if !ok {
 		return NULL
 	}
 
-	return pair.Value
+	return value
 }
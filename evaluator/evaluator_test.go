@@ -1,7 +1,10 @@
 package evaluator
 
 import (
+	"context"
+	"errors"
 	"monkey-compiler/lexer"
+	"monkey-compiler/limit"
 	"monkey-compiler/object"
 	"monkey-compiler/parser"
 	"testing"
@@ -59,6 +62,10 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"(1 < 2) == false", false},
 		{"(1 > 2) == true", false},
 		{"(1 > 2) == false", true},
+		{`"a" == "a"`, true},
+		{`"a" == "b"`, false},
+		{`"a" != "a"`, false},
+		{`"a" + "b" != "ab"`, false},
 	}
 
 	for _, tt := range tests {
@@ -221,6 +228,18 @@ if (10 > 1) {
 			`999[1]`,
 			"index operator not supported: INTEGER",
 		},
+		{
+			"10 / (5 - 5)",
+			"division by zero",
+		},
+		{
+			"fn() { 1 }(1)",
+			"wrong number of arguments: want=0, got=1",
+		},
+		{
+			"fn(a) { a }()",
+			"wrong number of arguments: want=1, got=0",
+		},
 	}
 
 	for _, tt := range tests {
@@ -240,6 +259,140 @@ if (10 > 1) {
 	}
 }
 
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input  string
+		line   int
+		column int
+	}{
+		{"5 + true;", 1, 3},
+		{"let a = 1;\nlet b = -true;", 2, 9},
+		{"foobar", 1, 1},
+		{"let f = fn() {\n  1 + true\n};\nf()", 2, 5},
+		{"len(1)", 1, 4},
+		{"[1][true]", 1, 4},
+		{"{[1]: 2}", 1, 1},
+		{`throw "x"`, 1, 1},
+		{"let e = error(\"x\");\nthrow e", 1, 14},
+		{"try { 1 + true } catch (e) { throw e }", 1, 9},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)",
+				tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Line != tt.line || errObj.Column != tt.column {
+			t.Errorf("wrong error position for %q. want=%d:%d, got=%d:%d",
+				tt.input, tt.line, tt.column, errObj.Line, errObj.Column)
+		}
+	}
+}
+
+func TestErrorBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`is_error(error("x"))`, "true"},
+		{`is_error(1)`, "false"},
+		{`is_error(if (false) { 1 })`, "false"},
+		{`error("x")`, "ERROR: x"},
+		{`error("x")["message"]`, "x"},
+		{`let e = error("x"); [1, 2]`, "[1, 2]"},
+		{`let check = fn(n) { if (n < 0) { return error("negative") } n }; is_error(check(-1))`, "true"},
+		{`try { throw error("bad") } catch (e) { e["message"] }`, "bad"},
+		{`is_error(try { 1 + true } catch (e) { e })`, "true"},
+		{`map([1, -1], fn(n) { if (n < 0) { error("neg") } else { n } })`, "[1, ERROR: neg]"},
+		{`error(1)`, "ERROR: arguments to `error` must be STRING, got INTEGER"},
+		{`is_error()`, "ERROR: wrong number of arguments. got=0, want=1"},
+		{`try { 1 + true } catch (e) { [e["line"], e["column"]] }`, "[1, 9]"},
+		{`error("x")["column"]`, "6"},
+	}
+
+	for _, tt := range tests {
+		if actual := testEval(tt.input).Inspect(); actual != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestTryCatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`try { 1 } catch (e) { 2 }`, "1"},
+		{`try { throw "boom"; 1 } catch (e) { e["message"] }`, "boom"},
+		{`try { 1 + true } catch (e) { 2 }`, "2"},
+		{`try { throw 42 } catch (e) { e["message"] }`, "42"},
+		{`try { throw "a" } catch (e) { e }`, "ERROR: a"},
+		{`let x = 5; try { throw 1 } catch (x) { x }; x`, "5"},
+		{`let x = 5; try { throw 1 } catch (e) { let x = 6; x }; x`, "5"},
+		{`let f = fn() { let x = 5; try { throw 1 } catch (x) { x }; x }; f()`, "5"},
+		{`let f = try { throw "a" } catch (e) { fn() { e["message"] } }; f()`, "a"},
+		{`let f = fn() { try { throw "a" } catch (e) { fn() { e["message"] } } }; f()()`, "a"},
+		{`try { try { throw "inner" } catch (e) { throw e["message"] + "!" } } catch (e) { e["message"] }`, "inner!"},
+		{`try { try { throw "a" } catch (e) { throw e } } catch (f) { f["message"] }`, "a"},
+		{`try { throw "a" } catch (e) { e["unknown"] }`, "null"},
+		{`let f = fn() { throw "deep" }; let g = fn() { 1 + f() }; try { g() } catch (e) { e["stack"] }`, "[f, g]"},
+		{`let f = fn() { throw "deep" }; let g = fn() { f() }; try { g() } catch (e) { e["stack"] }`, "[f]"},
+		{`let f = fn() { try { throw "x" } catch (e) { e["stack"] } }; f()`, "[f]"},
+		{`try { fn() { throw "x" }() } catch (e) { e["stack"] }`, "[<anonymous>]"},
+		{`try { throw "x" } catch (e) { e["stack"] }`, "[]"},
+		{`let f = fn(n) { if (n == 0) { throw "bottom" }; 1 + f(n - 1) }; try { f(3) } catch (e) { len(e["stack"]) }`, "4"},
+		{`let log = []; let r = try { 1 } catch (e) { 2 } finally { let log = push(log, "f") }; [r, log]`, "[1, [f]]"},
+		{`let log = []; let r = try { throw "x" } catch (e) { 2 } finally { let log = push(log, "f") }; [r, log]`, "[2, [f]]"},
+		{`let log = []; let r = try { try { throw "x" } catch (e) { throw "y" } finally { let log = push(log, "f") } } catch (e) { e["message"] }; [r, log]`, "[y, [f]]"},
+		{`let f = fn() { try { return 1 } catch (e) { 2 } finally { 5 }; 3 }; f()`, "1"},
+		{`let f = fn() { try { return 1 } catch (e) { 2 } finally { throw "finally ran" } }; try { f() } catch (e) { e["message"] }`, "finally ran"},
+		{`let f = fn() { try { throw "x" } catch (e) { return 2 } finally { 3 }; 4 }; f()`, "2"},
+		{`let f = fn() { try { 1 } catch (e) { 2 } finally { return 3 } }; f()`, "3"},
+		{`let f = fn() { try { try { return 1 } catch (e) { 0 } finally { 2 } } catch (e) { 0 } finally { 3 } }; f()`, "1"},
+		{`let f = fn() { try { throw "x" } catch (e) { 1 } }; f() + f()`, "2"},
+		{`let g = fn(x) { if (x == 2) { throw "two" } x }; try { map([1, 2, 3], g) } catch (e) { e["message"] }`, "two"},
+		{`1 + try { throw "x" } catch (e) { 2 }`, "3"},
+		{`if (try { false } catch (e) { true }) { 1 } else { 2 }`, "2"},
+	}
+
+	for _, tt := range tests {
+		if actual := testEval(tt.input).Inspect(); actual != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestUncaughtErrors(t *testing.T) {
+	tests := []struct {
+		input   string
+		message string
+	}{
+		{`throw "boom"`, "boom"},
+		{`let f = fn() { throw "boom" }; f(); 1`, "boom"},
+		{`try { throw "a" } catch (e) { throw "b" }`, "b"},
+		{`try { 1 } catch (e) { 2 } finally { throw "c" }`, "c"},
+		{`try { throw "a" } catch (e) { throw "b" } finally { 3 }`, "b"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok || errObj.Held {
+			t.Errorf("no error raised for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.message {
+			t.Errorf("wrong error message for %q. want=%q, got=%q", tt.input, tt.message, errObj.Message)
+		}
+	}
+}
+
 func TestLetStatements(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -420,6 +573,173 @@ func TestBuiltinFunctions(t *testing.T) {
 	}
 }
 
+func TestCollectionBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, "[2, 4, 6]"},
+		{`let offset = 10; map([1, 2], fn(x) { x + offset })`, "[11, 12]"},
+		{`map(["a", "bb"], len)`, "[1, 2]"},
+		{`map([], fn(x) { x })`, "[]"},
+		{`filter([1, 2, 3, 4], fn(x) { x > 2 })`, "[3, 4]"},
+		{`reduce([1, 2, 3, 4], 0, fn(acc, x) { acc + x })`, "10"},
+		{`reduce([], 5, fn(acc, x) { acc + x })`, "5"},
+		{`sort([3, 1, 2])`, "[1, 2, 3]"},
+		{`sort(["b", "c", "a"])`, "[a, b, c]"},
+		{`sort([3, 1, 2], fn(a, b) { a > b })`, "[3, 2, 1]"},
+		{`let a = [2, 1]; sort(a); a`, "[2, 1]"},
+		{`reverse([1, 2, 3])`, "[3, 2, 1]"},
+		{`contains([1, "a", [2]], "a")`, "true"},
+		{`contains([1, "a", [2]], [2])`, "true"},
+		{`!contains([1, 2], 3)`, "true"},
+		{`contains({"a": 1}, "a")`, "true"},
+		{`keys({"b": 2, "a": 1, 3: 0})`, "[b, a, 3]"},
+		{`values({"b": 2, "a": 1})`, "[2, 1]"},
+		{`keys({"a": 1, "b": 2, "a": 3})`, "[a, b]"},
+		{`{"z": 1, "y": 2, true: 3, 0: 4}`, "{z: 1, y: 2, true: 3, 0: 4}"},
+		{`keys(delete({"c": 1, "a": 2, "b": 3}, "a"))`, "[c, b]"},
+		{`merge({"b": 1, "a": 2}, {"c": 3, "b": 4})`, "{b: 4, a: 2, c: 3}"},
+		{`range(3)`, "[0, 1, 2]"},
+		{`range(2, 5)`, "[2, 3, 4]"},
+		{`range(5, 0, -2)`, "[5, 3, 1]"},
+		{`slice([1, 2, 3, 4], 1, 3)`, "[2, 3]"},
+		{`slice([1, 2, 3, 4], -2)`, "[3, 4]"},
+		{`slice([1, 2, 3], 2, 10)`, "[3]"},
+		{`join(["a", "b", "c"], ", ")`, "a, b, c"},
+		{`zip([1, 2, 3], ["a", "b"])`, "[[1, a], [2, b]]"},
+		{`map(["a", 1], len)`, "ERROR: argument to `len` not supported, got INTEGER"},
+		{`sort([1, "a"])`, "ERROR: cannot sort STRING and INTEGER"},
+		{`range(1, 2, 0)`, "ERROR: step of `range` must not be 0"},
+		{`range(9223372036854775806, 9223372036854775807, 5)`, "[9223372036854775806]"},
+		{`range(0, 50000000)`, "ERROR: range of 50000000 integers exceeds the maximum length of 4194304"},
+		{`join([1], "")`, "ERROR: elements to `join` must be STRING, got INTEGER"},
+		{`map([1], 1)`, "ERROR: not a function: INTEGER"},
+	}
+
+	for _, tt := range tests {
+		if actual := testEval(tt.input).Inspect(); actual != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestStringBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`split("a,b,,c", ",")`, "[a, b, , c]"},
+		{"split(\"  one two\tthree \")", "[one, two, three]"},
+		{`join(split("a b c"), "-")`, "a-b-c"},
+		{`slice("hello", 1, 3)`, "el"},
+		{`slice("hello", -3)`, "llo"},
+		{`index_of("banana", "an")`, "1"},
+		{`index_of("banana", "x")`, "-1"},
+		{`index_of([1, 2, 3], 3)`, "2"},
+		{`contains("monkey", "key")`, "true"},
+		{`starts_with("monkey", "mon")`, "true"},
+		{`ends_with("monkey", "mon")`, "false"},
+		{`upper("Monkey")`, "MONKEY"},
+		{`lower("Monkey")`, "monkey"},
+		{"trim(\"  monkey \n\")", "monkey"},
+		{`replace("a-b-c", "-", "+")`, "a+b+c"},
+		{`repeat("ab", 3)`, "ababab"},
+		{`char(97) + char(955)`, "aλ"},
+		{`ord("a")`, "97"},
+		{`ord("λ")`, "955"},
+		{`format("%d items for %s: %v", 3, "you", [1, "a"])`, "3 items for you: [1, a]"},
+		{`format("100%%")`, "100%"},
+		{`upper(1)`, "ERROR: arguments to `upper` must be STRING, got INTEGER"},
+		{`repeat("a", -1)`, "ERROR: count to `repeat` must not be negative, got -1"},
+		{`repeat("ab", 9223372036854775807)`, "ERROR: repeating 2 bytes 9223372036854775807 times exceeds the maximum length of 4194304"},
+		{`replace(repeat("a", 3000), "", repeat("b", 3000))`, "ERROR: replacing in 3000 bytes makes 9006000 bytes, exceeding the maximum length of 4194304"},
+		{`len(replace("abab", "", "-"))`, "9"},
+		{`let s = repeat("a", 1000000); join([s, s, s, s, s])`, "ERROR: joining 5 strings makes 5000000 bytes, exceeding the maximum length of 4194304"},
+		{`ord("ab")`, "ERROR: argument to `ord` must be a single character, got \"ab\""},
+		{`format("%d", "a")`, "ERROR: format: %d expects INTEGER, got STRING"},
+		{`format("%d %d", 1)`, "ERROR: format: missing argument for %d"},
+		{`format("%d", 1, 2)`, "ERROR: format: 1 arguments left unused"},
+	}
+
+	for _, tt := range tests {
+		if actual := testEval(tt.input).Inspect(); actual != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestConversionBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`type(1)`, "INTEGER"},
+		{`type("a")`, "STRING"},
+		{`type(true)`, "BOOLEAN"},
+		{`type(if (false) { 1 })`, "NULL"},
+		{`type([])`, "ARRAY"},
+		{`type({})`, "HASH"},
+		{`type(len)`, "BUILTIN"},
+		{`str(12) + str(true) + str("!")`, "12true!"},
+		{`str([1, "a"])`, "[1, a]"},
+		{`int("42") + 1`, "43"},
+		{`int(" -7 ")`, "-7"},
+		{`int(true) + int(false)`, "1"},
+		{`int("4x2")`, "ERROR: cannot convert \"4x2\" to INTEGER"},
+		{`int([])`, "ERROR: argument to `int` not supported, got ARRAY"},
+		{`bool(0)`, "true"},
+		{`bool("")`, "true"},
+		{`bool(if (false) { 1 })`, "false"},
+		{`!bool(false)`, "true"},
+		{`bool(1) == true`, "true"},
+		{`inspect("a")`, "\"a\""},
+		{`inspect([1, "a", {"k": [true]}])`, "[1, \"a\", {\"k\": [true]}]"},
+		{`type(fn() {})`, "FUNCTION"},
+	}
+
+	for _, tt := range tests {
+		if actual := testEval(tt.input).Inspect(); actual != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestJSONBuiltins(t *testing.T) {
+	// string literals cannot contain double quotes, so JSON documents are
+	// written with single quotes replaced by q
+	quote := `let q = fn(s) { replace(s, "'", char(34)) }; `
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`json_parse("42")`, "42"},
+		{`json_parse(q(" 'a' "))`, "a"},
+		{`json_parse(q("[1, true, null, 'x']"))`, "[1, true, null, x]"},
+		{`json_parse(q("{'a': {'b': [1, 2]}}"))["a"]["b"][1]`, "2"},
+		{`json_parse("[null]")[0] == json_parse("null")`, "true"},
+		{`if (json_parse("[null]")[0]) { 1 } else { 2 }`, "2"},
+		{`json_parse(q("{'a': 1"))`, "ERROR: json_parse: unexpected end of JSON input"},
+		{`json_parse("[1,]")`, "ERROR: json_parse: invalid character ',' looking for beginning of value"},
+		{`json_parse("1 2")`, "ERROR: json_parse: unexpected data after JSON value"},
+		{`json_parse("1.5")`, "ERROR: json_parse: number 1.5 is not a 64-bit integer"},
+		{`json_parse(1)`, "ERROR: arguments to `json_parse` must be STRING, got INTEGER"},
+		{`json_stringify({"b": [1, "x"], "a": if (false) { 1 }, "c": true})`, `{"b":[1,"x"],"a":null,"c":true}`},
+		{`json_stringify(q("<a'b>"))`, `"<a\"b>"`},
+		{`json_stringify({"a": [1]}, true)`, "{\n  \"a\": [\n    1\n  ]\n}"},
+		{`json_stringify(json_parse(q("{'k': [1, {'v': false}], 'a': 1}")))`, `{"k":[1,{"v":false}],"a":1}`},
+		{`json_stringify({1: 2})`, "ERROR: json_stringify: keys must be STRING, got INTEGER"},
+		{`json_stringify([len])`, "ERROR: json_stringify: cannot encode BUILTIN"},
+		{`json_stringify(1, "yes")`, "ERROR: second argument to `json_stringify` must be BOOLEAN, got STRING"},
+	}
+
+	for _, tt := range tests {
+		if actual := testEval(quote + tt.input).Inspect(); actual != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
 func TestArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 
@@ -523,12 +843,12 @@ func TestHashLiterals(t *testing.T) {
 		FALSE.HashKey():                            6,
 	}
 
-	if len(result.Pairs) != len(expected) {
-		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
+	if result.Len() != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", result.Len())
 	}
 
-	for expectedKey, expectedValue := range expected {
-		pair, ok := result.Pairs[expectedKey]
+	for _, pair := range result.OrderedPairs() {
+		expectedValue, ok := expected[pair.Key.(object.Hashable).HashKey()]
 		if !ok {
 			t.Errorf("no pair for given key in Pairs")
 		}
@@ -582,6 +902,105 @@ func TestHashIndexExpressions(t *testing.T) {
 		}
 	}
 }
+func TestEvalContextLimits(t *testing.T) {
+	countdown := "let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(100);"
+	// tail calls do not count toward the call depth
+	recursion := "let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(100);"
+
+	tests := []struct {
+		input    string
+		limits   limit.Limits
+		expected string
+	}{
+		{countdown, limit.Limits{MaxInstructions: 100}, limit.Instructions},
+		{recursion, limit.Limits{MaxDepth: 10}, limit.Depth},
+		{countdown, limit.Limits{MaxObjects: 50}, limit.Objects},
+		{"[1, 2, 3];", limit.Limits{MaxObjects: 3}, limit.Objects},
+		// builtins account for what they make
+		{"len(range(0, 50000000));", limit.Limits{MaxObjects: 1000}, limit.Objects},
+		{"let xs = range(100); push(xs, 1);", limit.Limits{MaxObjects: 150}, limit.Objects},
+		{`let s = repeat("a", 100000); join([s, s, s]);`, limit.Limits{MaxObjects: 10000}, limit.Objects},
+		{`replace(repeat("a", 1000), "", repeat("b", 1000));`, limit.Limits{MaxObjects: 10000}, limit.Objects},
+		{`let double = fn(s, n) { if (n == 0) { s } else { double(s + s, n - 1) } }; len(double("a", 27));`,
+			limit.Limits{MaxObjects: 1000}, limit.Objects},
+		{"map(range(100), fn(x) { str(x) });", limit.Limits{MaxObjects: 150}, limit.Objects},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		_, err := EvalContext(context.Background(), program, object.NewEnvironment(), tt.limits)
+
+		var limitErr *limit.LimitError
+		if !errors.As(err, &limitErr) {
+			t.Errorf("expected LimitError for %q with %+v. got=%v", tt.input, tt.limits, err)
+			continue
+		}
+		if limitErr.Limit != tt.expected {
+			t.Errorf("wrong limit exceeded for %q. want=%q, got=%q", tt.input, tt.expected, limitErr.Limit)
+		}
+	}
+}
+
+func TestEvalContextLimitsNotCaught(t *testing.T) {
+	input := "let f = fn() { 1 + f() }; try { f() } catch (e) { 1 }"
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	_, err := EvalContext(context.Background(), program, object.NewEnvironment(), limit.Limits{MaxDepth: 10})
+	var limitErr *limit.LimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("expected LimitError. got=%v", err)
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let countdown = fn(n) { if (n == 0) { 0 } else { countdown(n - 1) } }; countdown(1000000)", "0"},
+		{"let countdown = fn(n) { if (n > 0) { return countdown(n - 1) }; n }; countdown(1000000)", "0"},
+		{"let sum = fn(n, acc) { if (n == 0) { acc } else { sum(n - 1, acc + n) } }; sum(100000, 0)", "5000050000"},
+		{"let even = fn(n, odd) { if (n == 0) { true } else { odd(n - 1, even) } }; let odd = fn(n, even) { if (n == 0) { false } else { even(n - 1, odd) } }; even(100001, odd)", "false"},
+		{"let f = fn(a) { len(a) }; f([1, 2])", "2"},
+		{"let f = fn(x) { if (x) { len([1]) } else { 2 } }; f(true)", "1"},
+		{"let f = fn(n) { if (n == 0) { fn() { 7 } } else { f(n - 1) } }; f(10)()", "7"},
+		{"let adder = fn(a) { fn(b) { a + b } }; let add = fn(a, b) { adder(a)(b) }; add(1, 2)", "3"},
+		{"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; map([3, 2], fn(n) { f(n) })", "[0, 0]"},
+		{"let f = fn() { 1 }; let g = fn() { try { f() } catch (e) { 2 } }; g()", "1"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		result, err := EvalContext(context.Background(), program, object.NewEnvironment(), limit.Limits{MaxDepth: 3})
+		if err != nil {
+			t.Fatalf("EvalContext returned error for %q: %s", tt.input, err)
+		}
+		if actual := result.Inspect(); actual != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestEvalContext(t *testing.T) {
+	input := "let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(100);"
+	program := parser.New(lexer.New(input)).ParseProgram()
+	limits := limit.Limits{MaxInstructions: 10000, MaxDepth: 101, MaxObjects: 1000}
+
+	result, err := EvalContext(context.Background(), program, object.NewEnvironment(), limits)
+	if err != nil {
+		t.Fatalf("EvalContext returned error: %s", err)
+	}
+	testIntegerObject(t, result, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = EvalContext(ctx, program, object.NewEnvironment(), limit.Limits{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected error to wrap context.Canceled. got=%v", err)
+	}
+}
+
 func testEval(input string) object.Object {
 	l := lexer.New(input)
 	p := parser.New(l)
@@ -0,0 +1,174 @@
+package evaluator
+
+import (
+	"context"
+	"fmt"
+	"monkey-compiler/ast"
+	"monkey-compiler/limit"
+	"monkey-compiler/object"
+)
+
+// DefineMacros removes top-level macro definitions such as
+// `let unless = macro(cond, then) { ... };` from program and binds them in env.
+func DefineMacros(program *ast.Program, env *object.Environment) {
+	definitions := []int{}
+
+	for i, statement := range program.Statements {
+		if isMacroDefinition(statement) {
+			addMacro(statement, env)
+			definitions = append(definitions, i)
+		}
+	}
+
+	for i := len(definitions) - 1; i >= 0; i = i - 1 {
+		definitionIndex := definitions[i]
+		program.Statements = append(
+			program.Statements[:definitionIndex],
+			program.Statements[definitionIndex+1:]...,
+		)
+	}
+}
+
+func isMacroDefinition(node ast.Statement) bool {
+	letStatement, ok := node.(*ast.LetStatement)
+	if !ok {
+		return false
+	}
+
+	_, ok = letStatement.Value.(*ast.MacroLiteral)
+	return ok
+}
+
+func addMacro(stmt ast.Statement, env *object.Environment) {
+	letStatement, _ := stmt.(*ast.LetStatement)
+	macroLiteral, _ := letStatement.Value.(*ast.MacroLiteral)
+
+	macro := &object.Macro{
+		Parameters: macroLiteral.Parameters,
+		Env:        env,
+		Body:       macroLiteral.Body,
+	}
+
+	env.Set(letStatement.Name.Value, macro)
+}
+
+// ExpandMacros replaces every call of a macro defined in env with the AST
+// returned by the macro. The result can be passed to Eval or compiled.
+func ExpandMacros(program ast.Node, env *object.Environment) (ast.Node, error) {
+	var err error
+
+	expanded := ast.Modify(program, func(node ast.Node) ast.Node {
+		if err != nil {
+			return node
+		}
+
+		callExpression, ok := node.(*ast.CallExpression)
+		if !ok {
+			return node
+		}
+
+		macro, ok := isMacroCall(callExpression, env)
+		if !ok {
+			return node
+		}
+
+		if len(callExpression.Arguments) != len(macro.Parameters) {
+			err = fmt.Errorf("wrong number of arguments to macro %s. got=%d, want=%d",
+				callExpression.Function, len(callExpression.Arguments), len(macro.Parameters))
+			return node
+		}
+
+		args := quoteArgs(callExpression)
+		evalEnv := extendMacroEnv(macro, args)
+
+		evaluated := unwrapReturnValue(Eval(macro.Body, evalEnv))
+		if isError(evaluated) {
+			err = fmt.Errorf("macro %s: %s",
+				callExpression.Function, evaluated.(*object.Error).Message)
+			return node
+		}
+
+		quote, ok := evaluated.(*object.Quote)
+		if !ok {
+			err = fmt.Errorf("macro %s must return a quoted AST node, got %s",
+				callExpression.Function, typeOf(evaluated))
+			return node
+		}
+
+		return quote.Node
+	})
+
+	return expanded, err
+}
+
+// ExpandMacrosContext expands macros like ExpandMacros, but stops running
+// macro bodies when ctx is done or limits are exceeded, which is reported
+// like EvalContext does
+func ExpandMacrosContext(
+	ctx context.Context,
+	program ast.Node,
+	env *object.Environment,
+	limits limit.Limits,
+) (ast.Node, error) {
+	meter := limit.NewMeter(ctx, limits)
+	env.SetMeter(meter)
+	defer env.SetMeter(nil)
+
+	expanded, err := ExpandMacros(program, env)
+	if meterErr := meter.Err(); meterErr != nil {
+		return nil, meterErr
+	}
+	return expanded, err
+}
+
+func isMacroCall(
+	exp *ast.CallExpression,
+	env *object.Environment,
+) (*object.Macro, bool) {
+	identifier, ok := exp.Function.(*ast.Identifier)
+	if !ok {
+		return nil, false
+	}
+
+	obj, ok := env.Get(identifier.Value)
+	if !ok {
+		return nil, false
+	}
+
+	macro, ok := obj.(*object.Macro)
+	if !ok {
+		return nil, false
+	}
+
+	return macro, true
+}
+
+func quoteArgs(exp *ast.CallExpression) []*object.Quote {
+	args := []*object.Quote{}
+
+	for _, a := range exp.Arguments {
+		args = append(args, &object.Quote{Node: a})
+	}
+
+	return args
+}
+
+func extendMacroEnv(
+	macro *object.Macro,
+	args []*object.Quote,
+) *object.Environment {
+	extended := object.NewEnclosedEnvironment(macro.Env)
+
+	for paramIdx, param := range macro.Parameters {
+		extended.Set(param.Value, args[paramIdx])
+	}
+
+	return extended
+}
+
+func typeOf(obj object.Object) object.ObjectType {
+	if obj == nil {
+		return object.NULL_OBJ
+	}
+	return obj.Type()
+}
@@ -0,0 +1,193 @@
+package evaluator
+
+import (
+	"context"
+	"errors"
+	"monkey-compiler/ast"
+	"monkey-compiler/lexer"
+	"monkey-compiler/limit"
+	"monkey-compiler/object"
+	"monkey-compiler/parser"
+	"testing"
+)
+
+func TestDefineMacros(t *testing.T) {
+	input := `
+	let number = 1;
+	let function = fn(x, y) { x + y };
+	let mymacro = macro(x, y) { x + y; };
+	`
+
+	env := object.NewEnvironment()
+	program := testParseProgram(input)
+
+	DefineMacros(program, env)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("Wrong number of statements. got=%d",
+			len(program.Statements))
+	}
+
+	_, ok := env.Get("number")
+	if ok {
+		t.Fatalf("number should not be defined")
+	}
+	_, ok = env.Get("function")
+	if ok {
+		t.Fatalf("function should not be defined")
+	}
+
+	obj, ok := env.Get("mymacro")
+	if !ok {
+		t.Fatalf("macro not in environment.")
+	}
+
+	macro, ok := obj.(*object.Macro)
+	if !ok {
+		t.Fatalf("object is not Macro. got=%T (%+v)", obj, obj)
+	}
+
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("Wrong number of macro parameters. got=%d",
+			len(macro.Parameters))
+	}
+
+	if macro.Parameters[0].String() != "x" {
+		t.Fatalf("parameter is not 'x'. got=%q", macro.Parameters[0])
+	}
+	if macro.Parameters[1].String() != "y" {
+		t.Fatalf("parameter is not 'y'. got=%q", macro.Parameters[1])
+	}
+
+	expectedBody := "(x + y)"
+
+	if macro.Body.String() != expectedBody {
+		t.Fatalf("body is not %q. got=%q", expectedBody, macro.Body.String())
+	}
+}
+
+func TestExpandMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`
+			let infixExpression = macro() { quote(1 + 2); };
+
+			infixExpression();
+			`,
+			`(1 + 2)`,
+		},
+		{
+			`
+			let reverse = macro(a, b) { quote(unquote(b) - unquote(a)); };
+
+			reverse(2 + 2, 10 - 5);
+			`,
+			`(10 - 5) - (2 + 2)`,
+		},
+		{
+			`
+			let unless = macro(condition, consequence, alternative) {
+				quote(if (!(unquote(condition))) {
+					unquote(consequence);
+				} else {
+					unquote(alternative);
+				});
+			};
+
+			unless(10 > 5, puts("not greater"), puts("greater"));
+			`,
+			`if (!(10 > 5)) { puts("not greater") } else { puts("greater") }`,
+		},
+		{
+			`
+			let first = macro(a, b) {
+				if (true) { return quote(unquote(a)); }
+				quote(unquote(b));
+			};
+
+			first(1 + 1, 2 + 2);
+			`,
+			`(1 + 1)`,
+		},
+	}
+
+	for _, tt := range tests {
+		expected := testParseProgram(tt.expected)
+		program := testParseProgram(tt.input)
+
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		expanded, err := ExpandMacros(program, env)
+		if err != nil {
+			t.Fatalf("ExpandMacros returned error: %s", err)
+		}
+
+		if expanded.String() != expected.String() {
+			t.Errorf("not equal. want=%q, got=%q",
+				expected.String(), expanded.String())
+		}
+	}
+}
+
+func TestExpandMacrosErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`let m = macro(x) { quote(x) }; m(1, 2);`,
+			"wrong number of arguments to macro m. got=2, want=1",
+		},
+		{
+			`let m = macro() { 1 }; m();`,
+			"macro m must return a quoted AST node, got INTEGER",
+		},
+		{
+			`let m = macro(x) { quote(unquote(x) + unquote(zzz)) }; m(1);`,
+			"macro m: identifier not found: zzz",
+		},
+		{
+			`let m = macro() { quote(unquote([1])) }; m();`,
+			"macro m: cannot unquote ARRAY",
+		},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(tt.input)
+
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		_, err := ExpandMacros(program, env)
+		if err == nil {
+			t.Fatalf("expected error for %q", tt.input)
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error message. want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func TestExpandMacrosContext(t *testing.T) {
+	program := testParseProgram(`let m = macro() { let f = fn(n) { f(n + 1) }; f(0) }; m();`)
+	env := object.NewEnvironment()
+	DefineMacros(program, env)
+
+	_, err := ExpandMacrosContext(context.Background(), program, env, limit.Limits{MaxInstructions: 1000})
+	var limitErr *limit.LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != limit.Instructions {
+		t.Errorf("expected instruction LimitError. got=%v", err)
+	}
+	if env.Meter() != nil {
+		t.Errorf("meter left on the macro environment")
+	}
+}
+
+func testParseProgram(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
@@ -0,0 +1,56 @@
+package evaluator
+
+import (
+	"monkey-compiler/module"
+	"monkey-compiler/object"
+)
+
+// importer evaluates imported modules in environments of their own
+type importer struct {
+	loader *module.Loader
+	file   string // file of the importing code, "" if none
+
+	modules map[string]object.Object // exports of evaluated modules by file
+}
+
+// NewImporter returns an importer loading modules with loader and
+// resolving relative imports against file, "" for code not read from a
+// file. Set it on the environment of a program to let it import modules.
+func NewImporter(loader *module.Loader, file string) object.Importer {
+	return &importer{loader: loader, file: file, modules: make(map[string]object.Object)}
+}
+
+func (imp *importer) Import(path string, env *object.Environment) object.Object {
+	file, err := imp.loader.Resolve(path, imp.file)
+	if err != nil {
+		return newError("%s", err)
+	}
+	if exports, ok := imp.modules[file]; ok {
+		return exports
+	}
+
+	if err := imp.loader.Begin(file); err != nil {
+		return newError("%s", err)
+	}
+	defer imp.loader.End()
+
+	program, err := imp.loader.Parse(file)
+	if err != nil {
+		return newError("%s", err)
+	}
+
+	moduleEnv := object.NewModuleEnvironment(env)
+	moduleEnv.SetImporter(&importer{loader: imp.loader, file: file, modules: imp.modules})
+	if result := Eval(program, moduleEnv); isError(result) {
+		return result
+	}
+
+	exports := object.NewHash(0)
+	for _, name := range module.Exports(program) {
+		value, _ := moduleEnv.Get(name)
+		exports.Set(&object.String{Value: name}, value)
+	}
+
+	imp.modules[file] = exports
+	return exports
+}
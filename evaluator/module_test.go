@@ -0,0 +1,117 @@
+package evaluator
+
+import (
+	"io/ioutil"
+	"monkey-compiler/lexer"
+	"monkey-compiler/module"
+	"monkey-compiler/object"
+	"monkey-compiler/parser"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testModules = map[string]string{
+	"math.mk": `
+		let secret = 40;
+		let two = 2;
+		export let add = fn(a, b) { a + b };
+		export let answer = fn() { secret + two };
+	`,
+	"lib/double.mk": `
+		let math = import "../math";
+		export let double = fn(x) { math["add"](x, x) };
+	`,
+	"cycle/a.mk": `import "./b";`,
+	"cycle/b.mk": `import "./a";`,
+}
+
+func TestModules(t *testing.T) {
+	dir := writeModules(t, testModules)
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let m = import "math"; m["add"](1, 2)`, 3},
+		// the module's secret is not the main program's
+		{`let secret = 1; let m = import "math"; m["answer"]() + secret`, 43},
+		{`let m = import "math"; m["secret"]`, nil},
+		{`import "lib/double"["double"](21)`, 42},
+		// modules are evaluated once and shared by every import
+		{`import "math" == import "math"`, true},
+		{`let f = fn() { import "math" }; f() == import "math"`, true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalModules(dir, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestModuleErrors(t *testing.T) {
+	dir := writeModules(t, testModules)
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "missing"`, `module "missing.mk" not found`},
+		{`import "cycle/a"`, "import cycle: "},
+	}
+
+	for _, tt := range tests {
+		errObj, ok := testEvalModules(dir, tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("expected error for %q", tt.input)
+			continue
+		}
+		if !strings.Contains(errObj.Message, tt.expected) {
+			t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+
+	errObj, ok := testEval(`import "math"`).(*object.Error)
+	if !ok || errObj.Message != `cannot import "math": no module loader` {
+		t.Errorf("wrong error without importer. got=%v", errObj)
+	}
+}
+
+func testEvalModules(dir, input string) object.Object {
+	program := parser.New(lexer.New(input)).ParseProgram()
+	env := object.NewEnvironment()
+	env.SetImporter(NewImporter(module.NewLoader(dir), ""))
+
+	return Eval(program, env)
+}
+
+// writeModules writes files, keyed by slash-separated path, into a new
+// temporary directory and returns it
+func writeModules(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "modules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
@@ -0,0 +1,95 @@
+package evaluator
+
+import (
+	"fmt"
+	"monkey-compiler/ast"
+	"monkey-compiler/object"
+	"monkey-compiler/token"
+)
+
+func quote(node ast.Node, env *object.Environment) object.Object {
+	node, err := evalUnquoteCalls(node, env)
+	if err != nil {
+		return err
+	}
+	return &object.Quote{Node: node}
+}
+
+// evalUnquoteCalls replaces unquote calls in quoted with the AST of their
+// evaluated arguments, stopping at the first argument which raises an error
+// or cannot be turned into an AST node
+func evalUnquoteCalls(quoted ast.Node, env *object.Environment) (ast.Node, *object.Error) {
+	var failed *object.Error
+
+	modified := ast.Modify(quoted, func(node ast.Node) ast.Node {
+		if failed != nil || !isUnquoteCall(node) {
+			return node
+		}
+
+		call, ok := node.(*ast.CallExpression)
+		if !ok {
+			return node
+		}
+
+		if len(call.Arguments) != 1 {
+			return node
+		}
+
+		unquoted := Eval(call.Arguments[0], env)
+		if isError(unquoted) {
+			failed = unquoted.(*object.Error)
+			return node
+		}
+
+		converted := convertObjectToASTNode(unquoted)
+		if converted == nil {
+			failed = newError("cannot unquote %s", typeOf(unquoted))
+			locate(failed, call.Token)
+			return node
+		}
+		return converted
+	})
+
+	return modified, failed
+}
+
+func isUnquoteCall(node ast.Node) bool {
+	callExpression, ok := node.(*ast.CallExpression)
+	if !ok {
+		return false
+	}
+
+	return callExpression.Function.TokenLiteral() == "unquote"
+}
+
+// convertObjectToASTNode returns the AST node making obj, or nil if there is
+// none
+func convertObjectToASTNode(obj object.Object) ast.Node {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		t := token.Token{
+			Type:    token.INT,
+			Literal: fmt.Sprintf("%d", obj.Value),
+		}
+		return &ast.IntegerLiteral{Token: t, Value: obj.Value}
+
+	case *object.Boolean:
+		var t token.Token
+		if obj.Value {
+			t = token.Token{Type: token.TRUE, Literal: "true"}
+		} else {
+			t = token.Token{Type: token.FALSE, Literal: "false"}
+		}
+		return &ast.Boolean{Token: t, Value: obj.Value}
+
+	case *object.String:
+		t := token.Token{Type: token.STRING, Literal: obj.Value}
+		return &ast.StringLiteral{Token: t, Value: obj.Value}
+
+	case *object.Quote:
+		return obj.Node
+
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,64 @@
+// Package format implements canonical formatting of Monkey source code.
+package format
+
+import (
+	"bytes"
+	"errors"
+	"monkey-compiler/lexer"
+	"monkey-compiler/parser"
+	"monkey-compiler/token"
+	"strings"
+)
+
+// Source formats src in canonical Monkey style. Comments and single blank
+// lines between statements are preserved. It returns an error if src could
+// not be parsed.
+func Source(src []byte) ([]byte, error) {
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, errors.New(strings.Join(p.Errors(), "\n"))
+	}
+
+	pr := newPrinter(scanLayout(string(src)))
+	pr.program(program)
+
+	return pr.bytes(), nil
+}
+
+// scanLayout lexes input and collects its comments together with the lines
+// that are preceded by at least one blank line.
+func scanLayout(input string) ([]comment, map[int]bool) {
+	comments := []comment{}
+	blankBefore := map[int]bool{}
+
+	l := lexer.New(input)
+	prevEndLine := 0
+	for {
+		tok := l.NextToken()
+		if tok.Type == token.EOF {
+			break
+		}
+
+		if tok.Type == token.COMMENT {
+			trailing := tok.Line == prevEndLine
+			comments = append(comments, comment{Token: tok, trailing: trailing})
+		}
+
+		if prevEndLine > 0 && tok.Line > prevEndLine+1 {
+			blankBefore[tok.Line] = true
+		}
+		prevEndLine = tok.Line + strings.Count(tok.Literal, "\n")
+	}
+
+	return comments, blankBefore
+}
+
+// IsFormatted reports whether src is already in canonical form.
+func IsFormatted(src []byte) (bool, error) {
+	formatted, err := Source(src)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(src, formatted), nil
+}
@@ -0,0 +1,117 @@
+package format
+
+import "testing"
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let x=1;let y = x+2",
+			"let x = 1;\nlet y = x + 2;\n",
+		},
+		{
+			"(a + b) * c; a + (b + c); (a + b) + c; a * (b - c) / d",
+			"(a + b) * c;\na + (b + c);\na + b + c;\na * (b - c) / d;\n",
+		},
+		{
+			"-(a + b); !(-a); -(-a); !!true; (-a) * b",
+			"-(a + b);\n!-a;\n-(-a);\n!!true;\n-a * b;\n",
+		},
+		{
+			"a == (b < c); (a == b) == c",
+			"a == b < c;\na == b == c;\n",
+		},
+		{
+			"add(a, b)[0]; (f(1))(2); [1,2,3][1+1]",
+			"add(a, b)[0];\nf(1)(2);\n[1, 2, 3][1 + 1];\n",
+		},
+		{
+			`{"b":1,"a":[true,false]}`,
+			"{\"b\": 1, \"a\": [true, false]};\n",
+		},
+		{
+			"let f = fn(x,y){x+y}; let g = fn(){}",
+			"let f = fn(x, y) {\n  x + y;\n};\nlet g = fn() {};\n",
+		},
+		{
+			"if(x>1){return x}else{if(x){1}}",
+			"if (x > 1) {\n  return x;\n} else {\n  if (x) {\n    1;\n  }\n}\n",
+		},
+		{
+			"let a = 1;\n\n\n\nlet b = 2;\nlet c = 3;",
+			"let a = 1;\n\nlet b = 2;\nlet c = 3;\n",
+		},
+		{
+			"// header\n\nlet a = 1; // one\n// two\nlet b = 2;\n// end",
+			"// header\n\nlet a = 1; // one\n// two\nlet b = 2;\n// end\n",
+		},
+		{
+			"let f = fn() { // body\n\n  // first\n  1;\n\n  // last\n};",
+			"let f = fn() { // body\n  // first\n  1;\n\n  // last\n};\n",
+		},
+		{
+			"let f = fn() {\n  // nothing\n};",
+			"let f = fn() {\n  // nothing\n};\n",
+		},
+		{
+			"let unless=macro(c,x){quote(if(!(unquote(c))){unquote(x)})};",
+			"let unless = macro(c, x) {\n  quote(if (!unquote(c)) {\n    unquote(x);\n  });\n};\n",
+		},
+		{
+			`export let m=import "lib/math";m["add"](1,2)`,
+			"export let m = import \"lib/math\";\nm[\"add\"](1, 2);\n",
+		},
+		{
+			`let r=try{f()}catch(e){throw e["message"]}finally{puts("done")}`,
+			"let r = try {\n  f();\n} catch (e) {\n  throw e[\"message\"];\n} finally {\n  puts(\"done\");\n};\n",
+		},
+		{
+			"try{1}catch(err){2}",
+			"try {\n  1;\n} catch (err) {\n  2;\n}\n",
+		},
+		{
+			"",
+			"",
+		},
+	}
+
+	for _, tt := range tests {
+		formatted, err := Source([]byte(tt.input))
+		if err != nil {
+			t.Fatalf("Source(%q) returned error: %s", tt.input, err)
+		}
+
+		if string(formatted) != tt.expected {
+			t.Errorf("Source(%q) wrong.\nwant=%q\ngot=%q", tt.input, tt.expected, formatted)
+		}
+
+		again, err := Source(formatted)
+		if err != nil {
+			t.Fatalf("Source(%q) returned error: %s", formatted, err)
+		}
+
+		if string(again) != string(formatted) {
+			t.Errorf("Source is not idempotent.\nfirst=%q\nsecond=%q", formatted, again)
+		}
+	}
+}
+
+func TestSourceParseError(t *testing.T) {
+	if _, err := Source([]byte("let = 1;")); err == nil {
+		t.Fatalf("expected error for invalid source")
+	}
+}
+
+func TestIsFormatted(t *testing.T) {
+	ok, err := IsFormatted([]byte("let x = 1;\n"))
+	if err != nil || !ok {
+		t.Errorf("expected formatted source. ok=%t, err=%v", ok, err)
+	}
+
+	ok, err = IsFormatted([]byte("let x=1"))
+	if err != nil || ok {
+		t.Errorf("expected unformatted source. ok=%t, err=%v", ok, err)
+	}
+}
@@ -0,0 +1,308 @@
+package format
+
+import (
+	"bytes"
+	"math"
+	"monkey-compiler/ast"
+	"monkey-compiler/token"
+	"strings"
+)
+
+const indentation = "  "
+
+// operator precedences, mirroring the ones used by the parser
+const (
+	_ int = iota
+	lowest
+	equals
+	lessGreater
+	sum
+	product
+	prefix
+	call
+	primary
+)
+
+var precedences = map[string]int{
+	"==": equals,
+	"!=": equals,
+	"<":  lessGreater,
+	">":  lessGreater,
+	"+":  sum,
+	"-":  sum,
+	"/":  product,
+	"*":  product,
+}
+
+type comment struct {
+	token.Token
+	trailing bool // comment follows code on the same line
+}
+
+type printer struct {
+	out         bytes.Buffer
+	indent      int
+	atLineStart bool
+
+	comments    []comment // comments not printed yet, in source order
+	blankBefore map[int]bool
+}
+
+func newPrinter(comments []comment, blankBefore map[int]bool) *printer {
+	return &printer{
+		atLineStart: true,
+		comments:    comments,
+		blankBefore: blankBefore,
+	}
+}
+
+func (p *printer) bytes() []byte {
+	return p.out.Bytes()
+}
+
+func (p *printer) write(s string) {
+	if p.atLineStart {
+		p.out.WriteString(strings.Repeat(indentation, p.indent))
+		p.atLineStart = false
+	}
+	p.out.WriteString(s)
+}
+
+func (p *printer) newline() {
+	p.out.WriteByte('\n')
+	p.atLineStart = true
+}
+
+func (p *printer) program(program *ast.Program) {
+	p.statementList(program.Statements, token.Token{Line: math.MaxInt32})
+}
+
+// statementList prints stmts one per line, interleaved with the comments
+// that precede them. Comments located before end are flushed afterwards.
+func (p *printer) statementList(stmts []ast.Statement, end token.Token) {
+	first := true
+
+	for _, stmt := range stmts {
+		start := statementStart(stmt)
+		p.flushComments(start, &first)
+
+		if !first && p.blankBefore[start.Line] {
+			p.newline()
+		}
+		p.statement(stmt)
+		p.newline()
+		first = false
+	}
+
+	p.flushComments(end, &first)
+}
+
+func (p *printer) flushComments(until token.Token, first *bool) {
+	for len(p.comments) > 0 && isBefore(p.comments[0].Token, until) {
+		c := p.comments[0]
+		p.comments = p.comments[1:]
+
+		if c.trailing && p.out.Len() > 0 {
+			if p.atLineStart {
+				p.out.Truncate(p.out.Len() - 1)
+				p.atLineStart = false
+			}
+			p.out.WriteString(" " + c.Literal)
+			p.newline()
+			continue
+		}
+
+		if !*first && p.blankBefore[c.Line] {
+			p.newline()
+		}
+		p.write(c.Literal)
+		p.newline()
+		*first = false
+	}
+}
+
+func (p *printer) hasCommentBefore(tok token.Token) bool {
+	return len(p.comments) > 0 && isBefore(p.comments[0].Token, tok)
+}
+
+func isBefore(a, b token.Token) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
+
+func statementStart(stmt ast.Statement) token.Token {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		return stmt.Token
+	case *ast.ReturnStatement:
+		return stmt.Token
+	case *ast.ThrowStatement:
+		return stmt.Token
+	case *ast.ExpressionStatement:
+		return stmt.Token
+	case *ast.BlockStatement:
+		return stmt.Token
+	}
+	return token.Token{}
+}
+
+func (p *printer) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		if stmt.Exported {
+			p.write("export ")
+		}
+		p.write("let " + stmt.Name.Value + " = ")
+		p.expression(stmt.Value, lowest)
+		p.write(";")
+	case *ast.ReturnStatement:
+		p.write("return ")
+		p.expression(stmt.ReturnValue, lowest)
+		p.write(";")
+	case *ast.ThrowStatement:
+		p.write("throw ")
+		p.expression(stmt.Value, lowest)
+		p.write(";")
+	case *ast.ExpressionStatement:
+		p.expression(stmt.Expression, lowest)
+		switch stmt.Expression.(type) {
+		case *ast.IfExpression, *ast.TryExpression:
+		default:
+			p.write(";")
+		}
+	case *ast.BlockStatement:
+		p.block(stmt)
+	}
+}
+
+func (p *printer) block(block *ast.BlockStatement) {
+	if len(block.Statements) == 0 && !p.hasCommentBefore(block.Rbrace) {
+		p.write("{}")
+		return
+	}
+
+	p.write("{")
+	p.indent++
+	p.newline()
+	p.statementList(block.Statements, block.Rbrace)
+	p.indent--
+	p.write("}")
+}
+
+// expression prints exp, wrapping it in parentheses when it binds less
+// tightly than the surrounding precedence.
+func (p *printer) expression(exp ast.Expression, precedence int) {
+	parenthesize := precedenceOf(exp) < precedence
+	if parenthesize {
+		p.write("(")
+	}
+
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		p.write(exp.Value)
+	case *ast.IntegerLiteral:
+		p.write(exp.Token.Literal)
+	case *ast.Boolean:
+		p.write(exp.Token.Literal)
+	case *ast.StringLiteral:
+		p.write(`"` + exp.Value + `"`)
+	case *ast.ImportExpression:
+		p.write(`import "` + exp.Path + `"`)
+	case *ast.PrefixExpression:
+		p.write(exp.Operator)
+		if right, ok := exp.Right.(*ast.PrefixExpression); ok && exp.Operator == "-" && right.Operator == "-" {
+			// keep "-(-x)" from being printed as "--x"
+			p.expression(exp.Right, primary)
+		} else {
+			p.expression(exp.Right, prefix)
+		}
+	case *ast.InfixExpression:
+		operatorPrecedence := precedences[exp.Operator]
+		p.expression(exp.Left, operatorPrecedence)
+		p.write(" " + exp.Operator + " ")
+		// operators are left associative, so an equal precedence on the
+		// right needs parentheses
+		p.expression(exp.Right, operatorPrecedence+1)
+	case *ast.IfExpression:
+		p.write("if (")
+		p.expression(exp.Condition, lowest)
+		p.write(") ")
+		p.block(exp.Consequence)
+		if exp.Alternative != nil {
+			p.write(" else ")
+			p.block(exp.Alternative)
+		}
+	case *ast.TryExpression:
+		p.write("try ")
+		p.block(exp.Block)
+		p.write(" catch (" + exp.Param.Value + ") ")
+		p.block(exp.Catch)
+		if exp.Finally != nil {
+			p.write(" finally ")
+			p.block(exp.Finally)
+		}
+	case *ast.FunctionLiteral:
+		params := make([]string, 0, len(exp.Parameters))
+		for _, param := range exp.Parameters {
+			params = append(params, param.Value)
+		}
+		p.write("fn(" + strings.Join(params, ", ") + ") ")
+		p.block(exp.Body)
+	case *ast.MacroLiteral:
+		params := make([]string, 0, len(exp.Parameters))
+		for _, param := range exp.Parameters {
+			params = append(params, param.Value)
+		}
+		p.write("macro(" + strings.Join(params, ", ") + ") ")
+		p.block(exp.Body)
+	case *ast.CallExpression:
+		p.expression(exp.Function, call)
+		p.write("(")
+		p.expressionList(exp.Arguments)
+		p.write(")")
+	case *ast.ArrayLiteral:
+		p.write("[")
+		p.expressionList(exp.Elements)
+		p.write("]")
+	case *ast.IndexExpression:
+		p.expression(exp.Left, call)
+		p.write("[")
+		p.expression(exp.Index, lowest)
+		p.write("]")
+	case *ast.HashLiteral:
+		p.write("{")
+		for i, key := range exp.Keys {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.expression(key, lowest)
+			p.write(": ")
+			p.expression(exp.Pairs[key], lowest)
+		}
+		p.write("}")
+	}
+
+	if parenthesize {
+		p.write(")")
+	}
+}
+
+func (p *printer) expressionList(exps []ast.Expression) {
+	for i, exp := range exps {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.expression(exp, lowest)
+	}
+}
+
+func precedenceOf(exp ast.Expression) int {
+	switch exp := exp.(type) {
+	case *ast.InfixExpression:
+		return precedences[exp.Operator]
+	case *ast.PrefixExpression:
+		return prefix
+	case *ast.CallExpression, *ast.IndexExpression:
+		return call
+	}
+	return primary
+}
@@ -7,19 +7,30 @@ type Lexer struct {
 	position     int  // current position in input (points to current char)
 	readPosition int  // current reading position in input (after current char)
 	ch           byte // current char under examination
+	line         int  // line of current char
+	column       int  // column of current char
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
 	return l
 }
 
 func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
-
 	l.skipWhitespace()
 
+	line, column := l.line, l.column
+	tok := l.readToken()
+	tok.Line = line
+	tok.Column = column
+
+	return tok
+}
+
+func (l *Lexer) readToken() token.Token {
+	var tok token.Token
+
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
@@ -44,6 +55,11 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.BANG, l.ch)
 		}
 	case '/':
+		if l.peekChar() == '/' {
+			tok.Type = token.COMMENT
+			tok.Literal = l.readComment()
+			return tok
+		}
 		tok = newToken(token.SLASH, l.ch)
 	case '*':
 		tok = newToken(token.ASTERISK, l.ch)
@@ -100,6 +116,10 @@ func (l *Lexer) skipWhitespace() {
 }
 
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -107,6 +127,7 @@ func (l *Lexer) readChar() {
 	}
 	l.position = l.readPosition
 	l.readPosition += 1
+	l.column++
 }
 
 func (l *Lexer) peekChar() byte {
@@ -144,6 +165,14 @@ func (l *Lexer) readString() string {
 	return l.input[position:l.position]
 }
 
+func (l *Lexer) readComment() string {
+	position := l.position
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+	return l.input[position:l.position]
+}
+
 func isLetter(ch byte) bool {
 	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
 }
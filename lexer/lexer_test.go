@@ -29,6 +29,7 @@ if (5 < 10) {
 "foo bar"
 [1, 2];
 {"foo": "bar"}
+macro(x, y) { x + y; };
 `
 
 	tests := []struct {
@@ -121,6 +122,19 @@ if (5 < 10) {
 		{token.COLON, ":"},
 		{token.STRING, "bar"},
 		{token.RBRACE, "}"},
+		{token.MACRO, "macro"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.COMMA, ","},
+		{token.IDENT, "y"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "x"},
+		{token.PLUS, "+"},
+		{token.IDENT, "y"},
+		{token.SEMICOLON, ";"},
+		{token.RBRACE, "}"},
+		{token.SEMICOLON, ";"},
 		{token.EOF, ""},
 	}
 
@@ -140,3 +154,49 @@ if (5 < 10) {
 		}
 	}
 }
+
+func TestCommentsAndPositions(t *testing.T) {
+	input := `let x = 5; // five
+// a comment
+x / 2`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{token.LET, "let", 1, 1},
+		{token.IDENT, "x", 1, 5},
+		{token.ASSIGN, "=", 1, 7},
+		{token.INT, "5", 1, 9},
+		{token.SEMICOLON, ";", 1, 10},
+		{token.COMMENT, "// five", 1, 12},
+		{token.COMMENT, "// a comment", 2, 1},
+		{token.IDENT, "x", 3, 1},
+		{token.SLASH, "/", 3, 3},
+		{token.INT, "2", 3, 5},
+		{token.EOF, "", 3, 6},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// Package limit bounds the resources used by running Monkey programs.
+package limit
+
+import (
+	"context"
+	"fmt"
+)
+
+// Names of the limits reported by LimitError
+const (
+	Instructions = "instruction"
+	Depth        = "call depth"
+	Objects      = "object"
+)
+
+// checkInterval is the number of steps between two checks of the context
+const checkInterval = 1024
+
+// Limits bound a single run of a program. Zero fields are unlimited.
+type Limits struct {
+	// MaxInstructions bounds the VM instructions executed, or the nodes
+	// evaluated by the evaluator
+	MaxInstructions int64
+	// MaxDepth bounds the number of nested function calls
+	MaxDepth int
+	// MaxObjects bounds the number of objects allocated
+	MaxObjects int64
+}
+
+// LimitError reports that a program exceeded one of its limits
+type LimitError struct {
+	Limit string
+	Max   int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s limit of %d exceeded", e.Limit, e.Max)
+}
+
+// CanceledError reports that a program was stopped because its context was
+// done. It unwraps to the context's error, so errors.Is(err,
+// context.DeadlineExceeded) tells timeouts.
+type CanceledError struct {
+	Err error
+}
+
+func (e *CanceledError) Error() string {
+	return "execution canceled: " + e.Err.Error()
+}
+
+func (e *CanceledError) Unwrap() error {
+	return e.Err
+}
+
+// Meter tracks the resources used by one run. The methods of a nil Meter
+// never fail, so unlimited runs need no meter at all.
+type Meter struct {
+	ctx    context.Context
+	limits Limits
+
+	instructions int64
+	depth        int
+	objects      int64
+
+	err error // first limit exceeded, sticky
+}
+
+// NewMeter returns a meter enforcing limits and the cancellation of ctx, or
+// nil if there is nothing to enforce
+func NewMeter(ctx context.Context, limits Limits) *Meter {
+	if ctx.Done() == nil && limits == (Limits{}) {
+		return nil
+	}
+	return &Meter{ctx: ctx, limits: limits}
+}
+
+// Step accounts for one instruction or evaluation step. The context is
+// checked on the first step and every checkInterval steps after it.
+func (m *Meter) Step() error {
+	if m == nil {
+		return nil
+	}
+	if m.err != nil {
+		return m.err
+	}
+
+	m.instructions++
+	if m.limits.MaxInstructions > 0 && m.instructions > m.limits.MaxInstructions {
+		return m.fail(&LimitError{Limit: Instructions, Max: m.limits.MaxInstructions})
+	}
+
+	if (m.instructions-1)%checkInterval == 0 {
+		if err := m.ctx.Err(); err != nil {
+			return m.fail(&CanceledError{Err: err})
+		}
+	}
+	return nil
+}
+
+// Alloc accounts for n allocated objects
+func (m *Meter) Alloc(n int) error {
+	if m == nil {
+		return nil
+	}
+	if m.err != nil {
+		return m.err
+	}
+
+	// compared without adding, as n may be as large as an int gets
+	if m.limits.MaxObjects > 0 && int64(n) > m.limits.MaxObjects-m.objects {
+		return m.fail(&LimitError{Limit: Objects, Max: m.limits.MaxObjects})
+	}
+	m.objects += int64(n)
+	return nil
+}
+
+// Enter accounts for a function call, Leave for its return
+func (m *Meter) Enter() error {
+	if m == nil {
+		return nil
+	}
+	if m.err != nil {
+		return m.err
+	}
+
+	m.depth++
+	if m.limits.MaxDepth > 0 && m.depth > m.limits.MaxDepth {
+		return m.fail(&LimitError{Limit: Depth, Max: int64(m.limits.MaxDepth)})
+	}
+	return nil
+}
+
+func (m *Meter) Leave() {
+	if m != nil {
+		m.depth--
+	}
+}
+
+// Err returns the first limit exceeded, or nil
+func (m *Meter) Err() error {
+	if m == nil {
+		return nil
+	}
+	return m.err
+}
+
+func (m *Meter) fail(err error) error {
+	m.err = err
+	return err
+}
@@ -0,0 +1,122 @@
+package limit
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestNilMeter(t *testing.T) {
+	m := NewMeter(context.Background(), Limits{})
+	if m != nil {
+		t.Fatalf("expected no meter without limits")
+	}
+
+	for i := 0; i < 10; i++ {
+		if m.Step() != nil || m.Alloc(1) != nil || m.Enter() != nil {
+			t.Fatalf("nil meter should never fail")
+		}
+		m.Leave()
+	}
+	if m.Err() != nil {
+		t.Fatalf("nil meter should have no error")
+	}
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		limits   Limits
+		use      func(m *Meter) error
+		expected string
+	}{
+		{
+			Limits{MaxInstructions: 3},
+			func(m *Meter) error { return repeat(4, m.Step) },
+			"instruction limit of 3 exceeded",
+		},
+		{
+			Limits{MaxObjects: 10},
+			func(m *Meter) error { return repeat(4, func() error { return m.Alloc(3) }) },
+			"object limit of 10 exceeded",
+		},
+		{
+			Limits{MaxObjects: 10},
+			func(m *Meter) error { return repeat(2, func() error { return m.Alloc(int(^uint(0) >> 1)) }) },
+			"object limit of 10 exceeded",
+		},
+		{
+			Limits{MaxDepth: 2},
+			func(m *Meter) error { return repeat(3, m.Enter) },
+			"call depth limit of 2 exceeded",
+		},
+	}
+
+	for _, tt := range tests {
+		m := NewMeter(context.Background(), tt.limits)
+		err := tt.use(m)
+
+		var limitErr *LimitError
+		if !errors.As(err, &limitErr) {
+			t.Errorf("expected *LimitError. got=%T (%v)", err, err)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, err.Error())
+		}
+		if m.Err() != err || m.Step() != err {
+			t.Errorf("meter should keep failing with the first error")
+		}
+	}
+}
+
+func TestWithinLimits(t *testing.T) {
+	m := NewMeter(context.Background(), Limits{MaxInstructions: 5, MaxDepth: 1, MaxObjects: 5})
+
+	err := repeat(5, func() error {
+		if err := m.Enter(); err != nil {
+			return err
+		}
+		m.Leave()
+		if err := m.Alloc(1); err != nil {
+			return err
+		}
+		return m.Step()
+	})
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	m := NewMeter(ctx, Limits{})
+
+	if err := repeat(checkInterval*2, m.Step); err != nil {
+		t.Fatalf("unexpected error before cancellation: %s", err)
+	}
+	cancel()
+
+	err := repeat(checkInterval, m.Step)
+	var canceled *CanceledError
+	if !errors.As(err, &canceled) {
+		t.Fatalf("expected *CanceledError. got=%T (%v)", err, err)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("error should unwrap to context.Canceled")
+	}
+
+	// an already canceled context stops the first step
+	m = NewMeter(ctx, Limits{})
+	if err := m.Step(); !errors.Is(err, context.Canceled) {
+		t.Errorf("first step should check the context. got=%v", err)
+	}
+}
+
+func repeat(n int, f func() error) error {
+	for i := 0; i < n; i++ {
+		if err := f(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+// Package lint implements static checks for Monkey programs.
+package lint
+
+import (
+	"errors"
+	"monkey-compiler/ast"
+	"monkey-compiler/lexer"
+	"monkey-compiler/parser"
+	"monkey-compiler/token"
+	"sort"
+	"strings"
+)
+
+// Names of the rules reported by the linter
+const (
+	RuleUnused          = "unused"
+	RuleShadow          = "shadow"
+	RuleUnreachable     = "unreachable"
+	RuleArity           = "arity"
+	RuleMixedComparison = "mixed-comparison"
+	RuleUndefined       = "undefined"
+)
+
+// suppressPrefix starts a comment that silences diagnostics on its own line
+// and the line that follows, e.g. `// lint:ignore unused,shadow`. Without a
+// rule list every rule is silenced.
+const suppressPrefix = "// lint:ignore"
+
+// Diagnostic is a problem found by the linter
+type Diagnostic struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+}
+
+// Lint runs every rule on program and returns the diagnostics sorted by
+// position.
+func Lint(program *ast.Program) []Diagnostic {
+	l := newLinter()
+	ast.Walk(l, program)
+	l.closeScope()
+
+	diagnostics := l.diagnostics
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i], diagnostics[j]
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	return diagnostics
+}
+
+// Source parses and lints src, dropping diagnostics silenced by
+// suppression comments.
+func Source(src string) ([]Diagnostic, error) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, errors.New(strings.Join(p.Errors(), "\n"))
+	}
+
+	suppressions := scanSuppressions(src)
+
+	diagnostics := []Diagnostic{}
+	for _, d := range Lint(program) {
+		if !suppressions.covers(d) {
+			diagnostics = append(diagnostics, d)
+		}
+	}
+
+	return diagnostics, nil
+}
+
+// suppressions maps a line to the rules silenced on it. An empty rule set
+// silences every rule.
+type suppressions map[int]map[string]bool
+
+func scanSuppressions(src string) suppressions {
+	s := suppressions{}
+
+	l := lexer.New(src)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		if tok.Type != token.COMMENT || !strings.HasPrefix(tok.Literal, suppressPrefix) {
+			continue
+		}
+
+		rules := map[string]bool{}
+		for _, rule := range strings.Split(strings.TrimPrefix(tok.Literal, suppressPrefix), ",") {
+			if rule = strings.TrimSpace(rule); rule != "" {
+				rules[rule] = true
+			}
+		}
+
+		s.add(tok.Line, rules)
+		s.add(tok.Line+1, rules)
+	}
+
+	return s
+}
+
+func (s suppressions) add(line int, rules map[string]bool) {
+	existing, ok := s[line]
+	if ok && len(existing) == 0 {
+		return
+	}
+
+	merged := map[string]bool{}
+	if len(rules) != 0 {
+		for rule := range existing {
+			merged[rule] = true
+		}
+		for rule := range rules {
+			merged[rule] = true
+		}
+	}
+	s[line] = merged
+}
+
+func (s suppressions) covers(d Diagnostic) bool {
+	rules, ok := s[d.Line]
+	if !ok {
+		return false
+	}
+	return len(rules) == 0 || rules[d.Rule]
+}
@@ -0,0 +1,129 @@
+package lint
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []Diagnostic
+	}{
+		{
+			`let x = 1; puts(x);`,
+			[]Diagnostic{},
+		},
+		{
+			`let x = 1;`,
+			[]Diagnostic{
+				{RuleUnused, "x declared but not used", 1, 5},
+			},
+		},
+		{
+			`export let x = 1; export let f = fn() { 1 };`,
+			[]Diagnostic{},
+		},
+		{
+			`let _x = 1; let f = fn(a, b) { a }; f(1, 2);`,
+			[]Diagnostic{},
+		},
+		{
+			"let x = 1;\nlet f = fn(x) { x };\nf(x);",
+			[]Diagnostic{
+				{RuleShadow, "declaration of x shadows declaration at line 1", 2, 12},
+			},
+		},
+		{
+			`let len = fn(a) { 0 }; len([]);`,
+			[]Diagnostic{
+				{RuleShadow, "declaration of len shadows builtin", 1, 5},
+			},
+		},
+		{
+			"let f = fn() {\n  return 1;\n  2;\n};\nf();",
+			[]Diagnostic{
+				{RuleUnreachable, "unreachable code", 3, 3},
+			},
+		},
+		{
+			`let add = fn(a, b) { a + b }; add(1); fn(x) { x }(1, 2);`,
+			[]Diagnostic{
+				{RuleArity, "add called with 1 arguments, but takes 2", 1, 31},
+				{RuleArity, "function literal called with 2 arguments, but takes 1", 1, 39},
+			},
+		},
+		{
+			`1 == "1"; true != 1; 1 < 2; "a" == "b"; [] == {}`,
+			[]Diagnostic{
+				{RuleMixedComparison, "comparison of INTEGER literal with STRING literal", 1, 3},
+				{RuleMixedComparison, "comparison of BOOLEAN literal with INTEGER literal", 1, 16},
+				{RuleMixedComparison, "comparison of ARRAY literal with HASH literal", 1, 44},
+			},
+		},
+		{
+			`let x = y; let f = fn(a) { g() }; f(x); len(x);`,
+			[]Diagnostic{
+				{RuleUndefined, "undefined: y", 1, 9},
+				{RuleUndefined, "undefined: g", 1, 28},
+			},
+		},
+		{
+			"let f = fn() {\n  throw \"x\";\n  2;\n};\nf();",
+			[]Diagnostic{
+				{RuleUnreachable, "unreachable code", 3, 3},
+			},
+		},
+		{
+			`try { 1 } catch (e) { e } finally { x };`,
+			[]Diagnostic{
+				{RuleUndefined, "undefined: x", 1, 37},
+			},
+		},
+		{
+			`let e = 1; try { 1 } catch (e) { e }; e;`,
+			[]Diagnostic{
+				{RuleShadow, "declaration of e shadows declaration at line 1", 1, 29},
+			},
+		},
+		{
+			`try { 1 } catch (e) { e }; e;`,
+			[]Diagnostic{
+				{RuleUndefined, "undefined: e", 1, 28},
+			},
+		},
+		{
+			`let fact = fn(n) { if (n == 0) { 1 } else { n * fact(n - 1) } }; fact(5);`,
+			[]Diagnostic{},
+		},
+		{
+			`let unless = macro(c, x) { quote(if (!(unquote(c))) { unquote(x) }) }; unless(true, z);`,
+			[]Diagnostic{
+				{RuleUndefined, "undefined: z", 1, 85},
+			},
+		},
+		{
+			"let x = 1; // lint:ignore unused\n// lint:ignore\nlet y = z;\n// lint:ignore shadow\nlet w = 1;",
+			[]Diagnostic{
+				{RuleUnused, "w declared but not used", 5, 5},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		diagnostics, err := Source(tt.input)
+		if err != nil {
+			t.Fatalf("Source(%q) returned error: %s", tt.input, err)
+		}
+
+		if !reflect.DeepEqual(diagnostics, tt.expected) {
+			t.Errorf("wrong diagnostics for %q.\nwant=%+v\ngot=%+v", tt.input, tt.expected, diagnostics)
+		}
+	}
+}
+
+func TestSourceParseError(t *testing.T) {
+	if _, err := Source("let = 1;"); err == nil {
+		t.Fatalf("expected error for invalid source")
+	}
+}
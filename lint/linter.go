@@ -0,0 +1,289 @@
+package lint
+
+import (
+	"fmt"
+	"monkey-compiler/ast"
+	"monkey-compiler/compiler"
+	"monkey-compiler/evaluator"
+	"monkey-compiler/object"
+	"monkey-compiler/token"
+	"strings"
+)
+
+type binding struct {
+	ident  *ast.Identifier
+	params int  // number of parameters if bound to a function literal, -1 otherwise
+	isLet  bool // bound by an unexported let statement, so reported when unused
+	used   bool
+}
+
+// scope mirrors the compiler's symbol table nesting: one scope per function
+// body, blocks of if expressions share the enclosing scope.
+type scope struct {
+	outer    *scope
+	table    *compiler.SymbolTable
+	bindings map[string]*binding
+}
+
+type linter struct {
+	scope       *scope
+	quoted      int // nesting depth of quote() calls
+	diagnostics []Diagnostic
+}
+
+func newLinter() *linter {
+	table := compiler.NewSymbolTable()
+	for i, name := range evaluator.BuiltinNames() {
+		table.DefineBuiltin(i, name)
+	}
+
+	return &linter{
+		scope: &scope{table: table, bindings: map[string]*binding{}},
+	}
+}
+
+func (l *linter) Visit(node ast.Node) ast.Visitor {
+	switch node := node.(type) {
+	case *ast.Program:
+		l.checkUnreachable(node.Statements)
+	case *ast.BlockStatement:
+		l.checkUnreachable(node.Statements)
+	case *ast.LetStatement:
+		l.visitLetStatement(node)
+		return nil
+	case *ast.TryExpression:
+		l.visitTryExpression(node)
+		return nil
+	case *ast.FunctionLiteral:
+		l.visitFunction(node.Parameters, node.Body)
+		return nil
+	case *ast.MacroLiteral:
+		l.visitFunction(node.Parameters, node.Body)
+		return nil
+	case *ast.CallExpression:
+		return l.visitCallExpression(node)
+	case *ast.InfixExpression:
+		l.checkComparison(node)
+	case *ast.Identifier:
+		l.use(node)
+	}
+
+	return l
+}
+
+func (l *linter) visitLetStatement(node *ast.LetStatement) {
+	params := parameterCount(node.Value)
+
+	// function literals may refer to themselves recursively
+	if params >= 0 {
+		l.declare(node.Name, params, !node.Exported)
+		ast.Walk(l, node.Value)
+		return
+	}
+
+	ast.Walk(l, node.Value)
+	// exported bindings are used by the modules importing them
+	l.declare(node.Name, params, !node.Exported)
+}
+
+// visitTryExpression declares the caught error in a scope of the catch
+// block, like the compiler does
+func (l *linter) visitTryExpression(node *ast.TryExpression) {
+	ast.Walk(l, node.Block)
+	l.openScope()
+	l.declare(node.Param, -1, false)
+	ast.Walk(l, node.Catch)
+	l.closeScope()
+	if node.Finally != nil {
+		ast.Walk(l, node.Finally)
+	}
+}
+
+func (l *linter) visitFunction(params []*ast.Identifier, body *ast.BlockStatement) {
+	l.openScope()
+	for _, param := range params {
+		l.declare(param, -1, false)
+	}
+	ast.Walk(l, body)
+	l.closeScope()
+}
+
+func (l *linter) visitCallExpression(node *ast.CallExpression) ast.Visitor {
+	switch function := node.Function.(type) {
+	case *ast.Identifier:
+		switch {
+		case function.Value == "quote":
+			l.quoted++
+			l.walkList(node.Arguments)
+			l.quoted--
+			return nil
+		case function.Value == "unquote" && l.quoted > 0:
+			l.quoted--
+			l.walkList(node.Arguments)
+			l.quoted++
+			return nil
+		}
+
+		if b := l.lookup(function.Value); b != nil && b.params >= 0 && b.params != len(node.Arguments) {
+			l.report(RuleArity, function.Token,
+				"%s called with %d arguments, but takes %d",
+				function.Value, len(node.Arguments), b.params)
+		}
+	case *ast.FunctionLiteral:
+		if len(function.Parameters) != len(node.Arguments) {
+			l.report(RuleArity, function.Token,
+				"function literal called with %d arguments, but takes %d",
+				len(node.Arguments), len(function.Parameters))
+		}
+	}
+
+	return l
+}
+
+func (l *linter) walkList(exps []ast.Expression) {
+	for _, exp := range exps {
+		ast.Walk(l, exp)
+	}
+}
+
+func (l *linter) openScope() {
+	l.scope = &scope{
+		outer:    l.scope,
+		table:    compiler.NewEnclosedSymbolTable(l.scope.table),
+		bindings: map[string]*binding{},
+	}
+}
+
+// closeScope reports the unused bindings of the innermost scope and leaves it
+func (l *linter) closeScope() {
+	for _, b := range l.scope.bindings {
+		l.checkUsed(b)
+	}
+	l.scope = l.scope.outer
+}
+
+func (l *linter) declare(ident *ast.Identifier, params int, isLet bool) {
+	name := ident.Value
+
+	if previous, ok := l.scope.bindings[name]; ok {
+		l.checkUsed(previous)
+	} else if symbol, ok := l.scope.table.Resolve(name); ok {
+		if symbol.Scope == compiler.BuiltinScope {
+			l.report(RuleShadow, ident.Token, "declaration of %s shadows builtin", name)
+		} else if outer := l.lookup(name); outer != nil {
+			l.report(RuleShadow, ident.Token, "declaration of %s shadows declaration at line %d",
+				name, outer.ident.Token.Line)
+		}
+	}
+
+	l.scope.table.Define(name)
+	l.scope.bindings[name] = &binding{ident: ident, params: params, isLet: isLet}
+}
+
+func (l *linter) checkUsed(b *binding) {
+	if b.isLet && !b.used && !strings.HasPrefix(b.ident.Value, "_") {
+		l.report(RuleUnused, b.ident.Token, "%s declared but not used", b.ident.Value)
+	}
+}
+
+func (l *linter) lookup(name string) *binding {
+	for s := l.scope; s != nil; s = s.outer {
+		if b, ok := s.bindings[name]; ok {
+			return b
+		}
+	}
+	return nil
+}
+
+func (l *linter) use(ident *ast.Identifier) {
+	if b := l.lookup(ident.Value); b != nil {
+		b.used = true
+		return
+	}
+
+	if _, ok := l.scope.table.Resolve(ident.Value); ok {
+		return
+	}
+
+	// quoted code is resolved where the macro is expanded
+	if l.quoted == 0 {
+		l.report(RuleUndefined, ident.Token, "undefined: %s", ident.Value)
+	}
+}
+
+func (l *linter) checkUnreachable(stmts []ast.Statement) {
+	for i := 0; i+1 < len(stmts); i++ {
+		switch stmts[i].(type) {
+		case *ast.ReturnStatement, *ast.ThrowStatement:
+			l.report(RuleUnreachable, statementStart(stmts[i+1]), "unreachable code")
+			return
+		}
+	}
+}
+
+func (l *linter) checkComparison(node *ast.InfixExpression) {
+	switch node.Operator {
+	case "==", "!=", "<", ">":
+	default:
+		return
+	}
+
+	left, right := literalType(node.Left), literalType(node.Right)
+	if left != "" && right != "" && left != right {
+		l.report(RuleMixedComparison, node.Token,
+			"comparison of %s literal with %s literal", left, right)
+	}
+}
+
+func (l *linter) report(rule string, tok token.Token, format string, a ...interface{}) {
+	l.diagnostics = append(l.diagnostics, Diagnostic{
+		Rule:    rule,
+		Message: fmt.Sprintf(format, a...),
+		Line:    tok.Line,
+		Column:  tok.Column,
+	})
+}
+
+func parameterCount(exp ast.Expression) int {
+	switch exp := exp.(type) {
+	case *ast.FunctionLiteral:
+		return len(exp.Parameters)
+	case *ast.MacroLiteral:
+		return len(exp.Parameters)
+	}
+	return -1
+}
+
+func literalType(exp ast.Expression) object.ObjectType {
+	switch exp.(type) {
+	case *ast.IntegerLiteral:
+		return object.INTEGER_OBJ
+	case *ast.StringLiteral:
+		return object.STRING_OBJ
+	case *ast.Boolean:
+		return object.BOOLEAN_OBJ
+	case *ast.ArrayLiteral:
+		return object.ARRAY_OBJ
+	case *ast.HashLiteral:
+		return object.HASH_OBJ
+	case *ast.FunctionLiteral:
+		return object.FUNCTION_OBJ
+	}
+	return ""
+}
+
+func statementStart(stmt ast.Statement) token.Token {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		return stmt.Token
+	case *ast.ReturnStatement:
+		return stmt.Token
+	case *ast.ThrowStatement:
+		return stmt.Token
+	case *ast.ExpressionStatement:
+		return stmt.Token
+	case *ast.BlockStatement:
+		return stmt.Token
+	}
+	return token.Token{}
+}
@@ -0,0 +1,288 @@
+package lsp
+
+import (
+	"monkey-compiler/ast"
+	"monkey-compiler/compiler"
+	"monkey-compiler/evaluator"
+	"monkey-compiler/object"
+	"monkey-compiler/token"
+)
+
+// definition is a name bound by a let statement or a parameter list
+type definition struct {
+	ident     *ast.Identifier
+	scope     compiler.SymbolScope
+	kind      object.ObjectType // inferred kind of the bound value, "" if unknown
+	parameter bool
+	children  []*definition // definitions inside a bound function literal
+}
+
+// reference is an occurrence of an identifier in the document. def is nil
+// for builtins and undefined names.
+type reference struct {
+	ident   *ast.Identifier
+	def     *definition
+	builtin bool
+}
+
+type scope struct {
+	outer *scope
+	table *compiler.SymbolTable
+	defs  map[string]*definition
+
+	start, end token.Token // tokens delimiting the scope, zero for the global scope
+	all        []*definition
+}
+
+// index holds the name resolution of a parsed document
+type index struct {
+	globals    []*definition
+	scopes     []*scope
+	references []reference
+}
+
+type indexer struct {
+	idx   *index
+	scope *scope
+}
+
+func builtinTable() *compiler.SymbolTable {
+	table := compiler.NewSymbolTable()
+	for i, name := range evaluator.BuiltinNames() {
+		table.DefineBuiltin(i, name)
+	}
+	return table
+}
+
+func buildIndex(program *ast.Program) *index {
+	global := &scope{table: builtinTable(), defs: map[string]*definition{}}
+	ix := &indexer{idx: &index{scopes: []*scope{global}}, scope: global}
+
+	ast.Walk(ix, program)
+	ix.idx.globals = global.all
+
+	return ix.idx
+}
+
+func (ix *indexer) Visit(node ast.Node) ast.Visitor {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		ix.visitLetStatement(node)
+		return nil
+	case *ast.FunctionLiteral:
+		ix.visitFunction(nil, node.Token, node.Parameters, node.Body)
+		return nil
+	case *ast.MacroLiteral:
+		ix.visitFunction(nil, node.Token, node.Parameters, node.Body)
+		return nil
+	case *ast.TryExpression:
+		ix.visitTryExpression(node)
+		return nil
+	case *ast.Identifier:
+		ix.use(node)
+	}
+	return ix
+}
+
+func (ix *indexer) visitLetStatement(node *ast.LetStatement) {
+	switch value := node.Value.(type) {
+	case *ast.FunctionLiteral:
+		def := ix.declare(node.Name, object.FUNCTION_OBJ)
+		ix.visitFunction(def, value.Token, value.Parameters, value.Body)
+	case *ast.MacroLiteral:
+		def := ix.declare(node.Name, object.MACRO_OBJ)
+		ix.visitFunction(def, value.Token, value.Parameters, value.Body)
+	default:
+		ast.Walk(ix, node.Value)
+		ix.declare(node.Name, ix.kindOf(node.Value))
+	}
+}
+
+func (ix *indexer) visitFunction(
+	owner *definition,
+	start token.Token,
+	params []*ast.Identifier,
+	body *ast.BlockStatement,
+) {
+	ix.openScope(start, body.Rbrace)
+	for _, param := range params {
+		def := ix.declare(param, "")
+		def.parameter = true
+	}
+	ast.Walk(ix, body)
+
+	if owner != nil {
+		owner.children = ix.scope.all
+	}
+	ix.closeScope()
+}
+
+// visitTryExpression declares the caught error in a scope of the catch
+// block, from the parameter to the end of the block
+func (ix *indexer) visitTryExpression(node *ast.TryExpression) {
+	ast.Walk(ix, node.Block)
+	ix.openScope(node.Param.Token, node.Catch.Rbrace)
+	ix.declare(node.Param, "")
+	ast.Walk(ix, node.Catch)
+	ix.closeScope()
+	if node.Finally != nil {
+		ast.Walk(ix, node.Finally)
+	}
+}
+
+func (ix *indexer) openScope(start, end token.Token) {
+	ix.scope = &scope{
+		outer: ix.scope,
+		table: compiler.NewEnclosedSymbolTable(ix.scope.table),
+		defs:  map[string]*definition{},
+		start: start,
+		end:   end,
+	}
+	ix.idx.scopes = append(ix.idx.scopes, ix.scope)
+}
+
+func (ix *indexer) closeScope() {
+	ix.scope = ix.scope.outer
+}
+
+func (ix *indexer) declare(ident *ast.Identifier, kind object.ObjectType) *definition {
+	symbol := ix.scope.table.Define(ident.Value)
+	def := &definition{ident: ident, scope: symbol.Scope, kind: kind}
+
+	ix.scope.defs[ident.Value] = def
+	ix.scope.all = append(ix.scope.all, def)
+	ix.idx.references = append(ix.idx.references, reference{ident: ident, def: def})
+
+	return def
+}
+
+func (ix *indexer) lookup(name string) *definition {
+	for s := ix.scope; s != nil; s = s.outer {
+		if def, ok := s.defs[name]; ok {
+			return def
+		}
+	}
+	return nil
+}
+
+func (ix *indexer) use(ident *ast.Identifier) {
+	ref := reference{ident: ident, def: ix.lookup(ident.Value)}
+	if ref.def == nil {
+		symbol, ok := ix.scope.table.Resolve(ident.Value)
+		ref.builtin = ok && symbol.Scope == compiler.BuiltinScope
+	}
+	ix.idx.references = append(ix.idx.references, ref)
+}
+
+// kindOf infers the kind of value exp evaluates to, or "" if unknown
+func (ix *indexer) kindOf(exp ast.Expression) object.ObjectType {
+	switch exp := exp.(type) {
+	case *ast.IntegerLiteral:
+		return object.INTEGER_OBJ
+	case *ast.StringLiteral:
+		return object.STRING_OBJ
+	case *ast.Boolean:
+		return object.BOOLEAN_OBJ
+	case *ast.ArrayLiteral:
+		return object.ARRAY_OBJ
+	case *ast.HashLiteral:
+		return object.HASH_OBJ
+	case *ast.FunctionLiteral:
+		return object.FUNCTION_OBJ
+	case *ast.MacroLiteral:
+		return object.MACRO_OBJ
+	case *ast.Identifier:
+		if def := ix.lookup(exp.Value); def != nil {
+			return def.kind
+		}
+		if _, ok := ix.scope.table.Resolve(exp.Value); ok {
+			return object.BUILTIN_OBJ
+		}
+	case *ast.PrefixExpression:
+		switch exp.Operator {
+		case "!":
+			return object.BOOLEAN_OBJ
+		case "-":
+			return object.INTEGER_OBJ
+		}
+	case *ast.InfixExpression:
+		switch exp.Operator {
+		case "==", "!=", "<", ">":
+			return object.BOOLEAN_OBJ
+		}
+		left, right := ix.kindOf(exp.Left), ix.kindOf(exp.Right)
+		if left == right && (left == object.INTEGER_OBJ || left == object.STRING_OBJ && exp.Operator == "+") {
+			return left
+		}
+	case *ast.CallExpression:
+		if ident, ok := exp.Function.(*ast.Identifier); ok && ix.lookup(ident.Value) == nil {
+			switch ident.Value {
+			case "len":
+				return object.INTEGER_OBJ
+			case "rest", "push":
+				return object.ARRAY_OBJ
+			case "puts":
+				return object.NULL_OBJ
+			case "quote":
+				return object.QUOTE_OBJ
+			}
+		}
+	}
+	return ""
+}
+
+// referenceAt returns the identifier occurrence covering pos
+func (idx *index) referenceAt(pos Position) (reference, bool) {
+	for _, ref := range idx.references {
+		r := identRange(ref.ident)
+		if r.Start.Line == pos.Line && r.Start.Character <= pos.Character && pos.Character <= r.End.Character {
+			return ref, true
+		}
+	}
+	return reference{}, false
+}
+
+// visibleAt returns definitions that can be referred to at pos
+func (idx *index) visibleAt(pos Position) []*definition {
+	defs := []*definition{}
+	seen := map[string]bool{}
+
+	// innermost scopes come last in idx.scopes
+	for i := len(idx.scopes) - 1; i >= 0; i-- {
+		s := idx.scopes[i]
+		if s.outer != nil && !(isBefore(tokenPosition(s.start), pos) && isBefore(pos, tokenPosition(s.end))) {
+			continue
+		}
+		for _, def := range s.all {
+			if seen[def.ident.Value] {
+				continue
+			}
+			if !def.parameter && isBefore(pos, tokenPosition(def.ident.Token)) {
+				continue
+			}
+			seen[def.ident.Value] = true
+			defs = append(defs, def)
+		}
+	}
+
+	return defs
+}
+
+func tokenPosition(tok token.Token) Position {
+	return Position{Line: tok.Line - 1, Character: tok.Column - 1}
+}
+
+func tokenRange(tok token.Token) Range {
+	start := tokenPosition(tok)
+	end := start
+	end.Character += len(tok.Literal)
+	return Range{Start: start, End: end}
+}
+
+func identRange(ident *ast.Identifier) Range {
+	return tokenRange(ident.Token)
+}
+
+func isBefore(a, b Position) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Character < b.Character
+}
@@ -0,0 +1,380 @@
+// Package lsp implements a Language Server Protocol server for Monkey.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"monkey-compiler/ast"
+	"monkey-compiler/compiler"
+	"monkey-compiler/evaluator"
+	"monkey-compiler/lexer"
+	"monkey-compiler/module"
+	"monkey-compiler/object"
+	"monkey-compiler/parser"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const diagnosticSource = "monkey"
+
+type document struct {
+	uri   string
+	index *index // nil until a version of the document parsed
+}
+
+// Server is a language server speaking JSON-RPC over a reader/writer pair,
+// usually stdin and stdout
+type Server struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	documents map[string]*document
+	shutdown  bool
+}
+
+// NewServer returns a server reading requests from in and writing
+// responses and notifications to out
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:        bufio.NewReader(in),
+		out:       out,
+		documents: map[string]*document{},
+	}
+}
+
+// Run serves requests until the client sends exit or closes the input.
+func (s *Server) Run() error {
+	for {
+		msg, err := readMessage(s.in)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			if _, ok := err.(*parseError); ok {
+				if err := s.replyError(nil, codeParseError, err.Error()); err != nil {
+					return err
+				}
+				continue
+			}
+			return err
+		}
+
+		if msg.Method == "exit" {
+			return nil
+		}
+
+		if err := s.handle(msg); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(msg *message) error {
+	if msg.ID == nil {
+		s.handleNotification(msg)
+		return nil
+	}
+
+	if s.shutdown {
+		return s.replyError(msg.ID, codeInvalidRequest, "server is shutting down")
+	}
+
+	var result interface{}
+	var err error
+
+	switch msg.Method {
+	case "initialize":
+		result = InitializeResult{
+			Capabilities: ServerCapabilities{
+				TextDocumentSync:       textDocumentSyncFull,
+				HoverProvider:          true,
+				DefinitionProvider:     true,
+				DocumentSymbolProvider: true,
+				CompletionProvider:     &CompletionOptions{},
+			},
+			ServerInfo: ServerInfo{Name: "monkey-lsp"},
+		}
+	case "shutdown":
+		s.shutdown = true
+	case "textDocument/hover":
+		result, err = s.withPosition(msg.Params, s.hover)
+	case "textDocument/definition":
+		result, err = s.withPosition(msg.Params, s.definition)
+	case "textDocument/completion":
+		result, err = s.withPosition(msg.Params, s.completion)
+	case "textDocument/documentSymbol":
+		var params DocumentSymbolParams
+		if err = json.Unmarshal(msg.Params, &params); err == nil {
+			result = s.documentSymbols(params.TextDocument.URI)
+		}
+	default:
+		return s.replyError(msg.ID, codeMethodNotFound, "method not found: "+msg.Method)
+	}
+
+	if err != nil {
+		return s.replyError(msg.ID, codeInvalidParams, err.Error())
+	}
+	return s.reply(msg.ID, result)
+}
+
+func (s *Server) handleNotification(msg *message) {
+	switch msg.Method {
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if json.Unmarshal(msg.Params, &params) == nil {
+			s.update(params.TextDocument.URI, params.TextDocument.Text)
+		}
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if json.Unmarshal(msg.Params, &params) == nil && len(params.ContentChanges) > 0 {
+			changes := params.ContentChanges
+			s.update(params.TextDocument.URI, changes[len(changes)-1].Text)
+		}
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if json.Unmarshal(msg.Params, &params) == nil {
+			delete(s.documents, params.TextDocument.URI)
+			s.publishDiagnostics(params.TextDocument.URI, []Diagnostic{})
+		}
+	}
+}
+
+func (s *Server) reply(id *json.RawMessage, result interface{}) error {
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return writeMessage(s.out, &message{ID: id, Result: raw})
+}
+
+func (s *Server) replyError(id *json.RawMessage, code int, msg string) error {
+	if id == nil {
+		null := json.RawMessage("null")
+		id = &null
+	}
+	return writeMessage(s.out, &message{ID: id, Error: &responseError{Code: code, Message: msg}})
+}
+
+func (s *Server) notify(method string, params interface{}) error {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return writeMessage(s.out, &message{Method: method, Params: raw})
+}
+
+// update re-analyzes a document and publishes its diagnostics
+func (s *Server) update(uri, text string) {
+	previous := s.documents[uri]
+	doc := &document{uri: uri}
+	s.documents[uri] = doc
+
+	p := parser.New(lexer.New(text))
+	program := p.ParseProgram()
+
+	diagnostics := []Diagnostic{}
+	for _, err := range p.DetailedErrors() {
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    tokenRange(err.Token),
+			Severity: SeverityError,
+			Source:   diagnosticSource,
+			Message:  err.Message,
+		})
+	}
+
+	if len(diagnostics) == 0 {
+		doc.index = buildIndex(program)
+		if d, ok := compileDiagnostic(uri, text); ok {
+			diagnostics = append(diagnostics, d)
+		}
+	} else {
+		// keep serving the analysis of the last version that parsed
+		if previous != nil {
+			doc.index = previous.index
+		}
+	}
+
+	s.publishDiagnostics(uri, diagnostics)
+}
+
+// compileDiagnostic compiles text and reports the first error. Macros are
+// not expanded, as that would run code of the document in the server:
+// their definitions are left out and calls to them are compiled as calls of
+// globals. Imports are resolved from the directory of the document's file
+// and then $MONKEYPATH, as when the file is run.
+func compileDiagnostic(uri, text string) (Diagnostic, bool) {
+	program := parser.New(lexer.New(text)).ParseProgram()
+
+	symbolTable := compiler.NewSymbolTable()
+	for i, def := range object.Builtins {
+		symbolTable.DefineBuiltin(i, def.Name)
+	}
+	for _, name := range removeMacroDefinitions(program) {
+		symbolTable.Define(name)
+	}
+
+	comp := compiler.NewWithState(symbolTable, []object.Object{})
+	comp.SetLoader(module.NewLoader(module.DefaultPath()...), uriFile(uri))
+	err := comp.Compile(program)
+	if err == nil {
+		return Diagnostic{}, false
+	}
+
+	d := Diagnostic{Severity: SeverityError, Source: diagnosticSource, Message: err.Error()}
+	if compileErr, ok := err.(*compiler.Error); ok {
+		d.Range = tokenRange(compileErr.Token)
+	}
+	return d, true
+}
+
+// uriFile returns the file named by a file URI, or "" for other URIs
+func uriFile(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return ""
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+// removeMacroDefinitions removes the top-level macro definitions from
+// program and returns the names they define
+func removeMacroDefinitions(program *ast.Program) []string {
+	names := []string{}
+	statements := []ast.Statement{}
+	for _, stmt := range program.Statements {
+		if let, ok := stmt.(*ast.LetStatement); ok {
+			if _, ok := let.Value.(*ast.MacroLiteral); ok {
+				names = append(names, let.Name.Value)
+				continue
+			}
+		}
+		statements = append(statements, stmt)
+	}
+	program.Statements = statements
+	return names
+}
+
+func (s *Server) publishDiagnostics(uri string, diagnostics []Diagnostic) {
+	_ = s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: diagnostics,
+	})
+}
+
+func (s *Server) withPosition(
+	raw json.RawMessage,
+	handler func(*document, Position) interface{},
+) (interface{}, error) {
+	var params TextDocumentPositionParams
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, err
+	}
+
+	doc, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return nil, fmt.Errorf("unknown document: %s", params.TextDocument.URI)
+	}
+	if doc.index == nil {
+		return nil, nil
+	}
+
+	return handler(doc, params.Position), nil
+}
+
+func (s *Server) hover(doc *document, pos Position) interface{} {
+	ref, ok := doc.index.referenceAt(pos)
+	if !ok {
+		return nil
+	}
+
+	var text string
+	switch {
+	case ref.def != nil:
+		kind := string(ref.def.kind)
+		if kind == "" {
+			kind = "unknown"
+		}
+		text = fmt.Sprintf("%s %s: %s", strings.ToLower(string(ref.def.scope)), ref.ident.Value, kind)
+		if ref.def.parameter {
+			text = fmt.Sprintf("parameter %s (local)", ref.ident.Value)
+		}
+	case ref.builtin:
+		text = fmt.Sprintf("builtin %s: %s", ref.ident.Value, object.BUILTIN_OBJ)
+	default:
+		text = fmt.Sprintf("undefined %s", ref.ident.Value)
+	}
+
+	return Hover{
+		Contents: MarkupContent{Kind: "plaintext", Value: text},
+		Range:    identRange(ref.ident),
+	}
+}
+
+func (s *Server) definition(doc *document, pos Position) interface{} {
+	ref, ok := doc.index.referenceAt(pos)
+	if !ok || ref.def == nil {
+		return nil
+	}
+
+	return []Location{{URI: doc.uri, Range: identRange(ref.def.ident)}}
+}
+
+func (s *Server) completion(doc *document, pos Position) interface{} {
+	items := []CompletionItem{}
+
+	for _, def := range doc.index.visibleAt(pos) {
+		kind := CompletionKindVariable
+		if def.kind == object.FUNCTION_OBJ {
+			kind = CompletionKindFunction
+		}
+		items = append(items, CompletionItem{Label: def.ident.Value, Kind: kind, Detail: string(def.kind)})
+	}
+
+	for _, name := range evaluator.BuiltinNames() {
+		items = append(items, CompletionItem{Label: name, Kind: CompletionKindFunction, Detail: object.BUILTIN_OBJ})
+	}
+
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Label < items[j].Label })
+	return items
+}
+
+func (s *Server) documentSymbols(uri string) []DocumentSymbol {
+	doc, ok := s.documents[uri]
+	if !ok || doc.index == nil {
+		return []DocumentSymbol{}
+	}
+	return symbolsOf(doc.index.globals)
+}
+
+func symbolsOf(defs []*definition) []DocumentSymbol {
+	symbols := []DocumentSymbol{}
+
+	for _, def := range defs {
+		if def.parameter {
+			continue
+		}
+
+		kind := SymbolKindVariable
+		if def.kind == object.FUNCTION_OBJ {
+			kind = SymbolKindFunction
+		}
+
+		symbol := DocumentSymbol{
+			Name:           def.ident.Value,
+			Detail:         string(def.kind),
+			Kind:           kind,
+			Range:          identRange(def.ident),
+			SelectionRange: identRange(def.ident),
+		}
+		if children := symbolsOf(def.children); len(children) > 0 {
+			symbol.Children = children
+		}
+		symbols = append(symbols, symbol)
+	}
+
+	return symbols
+}
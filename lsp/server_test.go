@@ -0,0 +1,403 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"monkey-compiler/evaluator"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+const testURI = "file:///test.mk"
+
+// client is an in-process JSON-RPC client talking to a Server over pipes
+type client struct {
+	t      *testing.T
+	w      io.Writer
+	nextID int
+
+	messages      chan *message
+	notifications []*message
+}
+
+func newClient(t *testing.T) (*client, func()) {
+	t.Helper()
+
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+
+	server := NewServer(serverIn, serverOut)
+	done := make(chan error)
+	go func() {
+		done <- server.Run()
+		serverOut.Close()
+	}()
+
+	c := &client{t: t, w: clientOut, messages: make(chan *message, 100)}
+	go func() {
+		r := bufio.NewReader(clientIn)
+		for {
+			msg, err := readMessage(r)
+			if err != nil {
+				close(c.messages)
+				return
+			}
+			c.messages <- msg
+		}
+	}()
+
+	return c, func() {
+		c.notify("exit", nil)
+		if err := <-done; err != nil {
+			t.Errorf("server returned error: %s", err)
+		}
+		clientOut.Close()
+	}
+}
+
+func (c *client) send(msg *message) {
+	c.t.Helper()
+	if err := writeMessage(c.w, msg); err != nil {
+		c.t.Fatalf("could not write message: %s", err)
+	}
+}
+
+func (c *client) notify(method string, params interface{}) {
+	c.t.Helper()
+	raw, _ := json.Marshal(params)
+	c.send(&message{Method: method, Params: raw})
+}
+
+// call sends a request and waits for its response, collecting the
+// notifications received in the meantime
+func (c *client) call(method string, params interface{}, result interface{}) *responseError {
+	c.t.Helper()
+
+	c.nextID++
+	id := json.RawMessage(fmtInt(c.nextID))
+	raw, _ := json.Marshal(params)
+	c.send(&message{ID: &id, Method: method, Params: raw})
+
+	for msg := range c.messages {
+		if msg.ID == nil {
+			c.notifications = append(c.notifications, msg)
+			continue
+		}
+		if string(*msg.ID) != string(id) {
+			c.t.Fatalf("unexpected response id. want=%s, got=%s", id, *msg.ID)
+		}
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if result != nil {
+			if err := json.Unmarshal(msg.Result, result); err != nil {
+				c.t.Fatalf("could not decode result %s: %s", msg.Result, err)
+			}
+		}
+		return nil
+	}
+
+	c.t.Fatalf("connection closed before response to %s", method)
+	return nil
+}
+
+// diagnostics waits for the next publishDiagnostics notification
+func (c *client) diagnostics() PublishDiagnosticsParams {
+	c.t.Helper()
+
+	for msg := range c.messages {
+		if msg.Method != "textDocument/publishDiagnostics" {
+			c.notifications = append(c.notifications, msg)
+			continue
+		}
+		var params PublishDiagnosticsParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			c.t.Fatalf("could not decode diagnostics: %s", err)
+		}
+		return params
+	}
+
+	c.t.Fatalf("connection closed before diagnostics were published")
+	return PublishDiagnosticsParams{}
+}
+
+func fmtInt(i int) string {
+	raw, _ := json.Marshal(i)
+	return string(raw)
+}
+
+func (c *client) open(text string) {
+	c.t.Helper()
+	c.notify("textDocument/didOpen", DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: testURI, LanguageID: "monkey", Version: 1, Text: text},
+	})
+}
+
+func at(line, character int) TextDocumentPositionParams {
+	return TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: testURI},
+		Position:     Position{Line: line, Character: character},
+	}
+}
+
+func rng(line, start, end int) Range {
+	return Range{Start: Position{Line: line, Character: start}, End: Position{Line: line, Character: end}}
+}
+
+func TestInitialize(t *testing.T) {
+	c, stop := newClient(t)
+	defer stop()
+
+	var result InitializeResult
+	if err := c.call("initialize", map[string]interface{}{}, &result); err != nil {
+		t.Fatalf("initialize failed: %+v", err)
+	}
+
+	caps := result.Capabilities
+	if caps.TextDocumentSync != textDocumentSyncFull || !caps.HoverProvider ||
+		!caps.DefinitionProvider || !caps.DocumentSymbolProvider || caps.CompletionProvider == nil {
+		t.Errorf("wrong capabilities. got=%+v", caps)
+	}
+
+	if err := c.call("unknown/method", nil, nil); err == nil || err.Code != codeMethodNotFound {
+		t.Errorf("expected method not found error. got=%+v", err)
+	}
+
+	if err := c.call("shutdown", nil, nil); err != nil {
+		t.Errorf("shutdown failed: %+v", err)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	c, stop := newClient(t)
+	defer stop()
+
+	tests := []struct {
+		text     string
+		expected []Diagnostic
+	}{
+		{
+			"let x = 1;\nx + 1;",
+			[]Diagnostic{},
+		},
+		{
+			"let x = 1;\nlet = 2;",
+			[]Diagnostic{
+				{rng(1, 4, 5), SeverityError, diagnosticSource, "expected next token to be IDENT, got = instead"},
+				{rng(1, 4, 5), SeverityError, diagnosticSource, "no prefix parse function for = found"},
+			},
+		},
+		{
+			"let x = 1;\nx + y;",
+			[]Diagnostic{
+				{rng(1, 4, 5), SeverityError, diagnosticSource, "undefined variable: y"},
+			},
+		},
+		{
+			// macros are not run by the server
+			"let m = macro() { puts(1); let f = fn(n) { f(n + 1) }; f(0) };\nm();",
+			[]Diagnostic{},
+		},
+		{
+			"let m = macro(x) { quote(unquote(x)) };\nm(y);",
+			[]Diagnostic{
+				{rng(1, 2, 3), SeverityError, diagnosticSource, "undefined variable: y"},
+			},
+		},
+	}
+
+	c.open(tests[0].text)
+	for i, tt := range tests {
+		if i > 0 {
+			c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+				TextDocument:   TextDocumentIdentifier{URI: testURI},
+				ContentChanges: []TextDocumentContentChangeEvent{{Text: tt.text}},
+			})
+		}
+
+		published := c.diagnostics()
+		if published.URI != testURI {
+			t.Errorf("wrong uri. got=%q", published.URI)
+		}
+		if !reflect.DeepEqual(published.Diagnostics, tt.expected) {
+			t.Errorf("wrong diagnostics for %q.\nwant=%+v\ngot=%+v", tt.text, tt.expected, published.Diagnostics)
+		}
+	}
+}
+
+func TestDiagnosticsImports(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsp")
+	if err != nil {
+		t.Fatalf("cannot create directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	lib := filepath.Join(dir, "lib.mk")
+	if err := ioutil.WriteFile(lib, []byte("export let x = 1;"), 0644); err != nil {
+		t.Fatalf("cannot write module: %s", err)
+	}
+
+	c, stop := newClient(t)
+	defer stop()
+
+	tests := []struct {
+		text     string
+		expected []Diagnostic
+	}{
+		{
+			"let lib = import \"./lib\";\nlib[\"x\"] + 1;",
+			[]Diagnostic{},
+		},
+		{
+			"let lib = import \"./missing\";",
+			[]Diagnostic{
+				{rng(0, 10, 16), SeverityError, diagnosticSource, `module "./missing.mk" not found`},
+			},
+		},
+	}
+
+	uri := "file://" + filepath.ToSlash(filepath.Join(dir, "main.mk"))
+	for _, tt := range tests {
+		c.notify("textDocument/didOpen", DidOpenTextDocumentParams{
+			TextDocument: TextDocumentItem{URI: uri, LanguageID: "monkey", Version: 1, Text: tt.text},
+		})
+
+		published := c.diagnostics()
+		if !reflect.DeepEqual(published.Diagnostics, tt.expected) {
+			t.Errorf("wrong diagnostics for %q.\nwant=%+v\ngot=%+v", tt.text, tt.expected, published.Diagnostics)
+		}
+	}
+}
+
+const testProgram = `let limit = 10;
+let add = fn(a, b) {
+  let sum = a + b;
+  sum
+};
+add(limit, len("x"));
+try { limit } catch (err) { err };
+`
+
+func TestHover(t *testing.T) {
+	c, stop := newClient(t)
+	defer stop()
+	c.open(testProgram)
+
+	tests := []struct {
+		position TextDocumentPositionParams
+		expected string
+	}{
+		{at(0, 5), "global limit: INTEGER"},
+		{at(5, 6), "global limit: INTEGER"},
+		{at(1, 5), "global add: FUNCTION"},
+		{at(2, 17), "parameter b (local)"},
+		{at(3, 3), "local sum: unknown"},
+		{at(5, 13), "builtin len: BUILTIN"},
+		{at(6, 22), "local err: unknown"},
+		{at(6, 29), "local err: unknown"},
+	}
+
+	for _, tt := range tests {
+		var hover Hover
+		if err := c.call("textDocument/hover", tt.position, &hover); err != nil {
+			t.Fatalf("hover failed: %+v", err)
+		}
+		if hover.Contents.Value != tt.expected {
+			t.Errorf("wrong hover at %+v. want=%q, got=%q", tt.position.Position, tt.expected, hover.Contents.Value)
+		}
+	}
+}
+
+func TestDefinition(t *testing.T) {
+	c, stop := newClient(t)
+	defer stop()
+	c.open(testProgram)
+
+	tests := []struct {
+		position TextDocumentPositionParams
+		expected []Location
+	}{
+		{at(5, 1), []Location{{testURI, rng(1, 4, 7)}}},
+		{at(5, 8), []Location{{testURI, rng(0, 4, 9)}}},
+		{at(2, 12), []Location{{testURI, rng(1, 13, 14)}}},
+		{at(3, 2), []Location{{testURI, rng(2, 6, 9)}}},
+		{at(5, 12), nil},
+		{at(6, 29), []Location{{testURI, rng(6, 21, 24)}}},
+	}
+
+	for _, tt := range tests {
+		var locations []Location
+		if err := c.call("textDocument/definition", tt.position, &locations); err != nil {
+			t.Fatalf("definition failed: %+v", err)
+		}
+		if !reflect.DeepEqual(locations, tt.expected) {
+			t.Errorf("wrong definition at %+v. want=%+v, got=%+v", tt.position.Position, tt.expected, locations)
+		}
+	}
+}
+
+func TestDocumentSymbols(t *testing.T) {
+	c, stop := newClient(t)
+	defer stop()
+	c.open(testProgram)
+
+	var symbols []DocumentSymbol
+	params := DocumentSymbolParams{TextDocument: TextDocumentIdentifier{URI: testURI}}
+	if err := c.call("textDocument/documentSymbol", params, &symbols); err != nil {
+		t.Fatalf("documentSymbol failed: %+v", err)
+	}
+
+	expected := []DocumentSymbol{
+		{Name: "limit", Detail: "INTEGER", Kind: SymbolKindVariable, Range: rng(0, 4, 9), SelectionRange: rng(0, 4, 9)},
+		{Name: "add", Detail: "FUNCTION", Kind: SymbolKindFunction, Range: rng(1, 4, 7), SelectionRange: rng(1, 4, 7),
+			Children: []DocumentSymbol{
+				{Name: "sum", Kind: SymbolKindVariable, Range: rng(2, 6, 9), SelectionRange: rng(2, 6, 9)},
+			},
+		},
+	}
+
+	if !reflect.DeepEqual(symbols, expected) {
+		t.Errorf("wrong symbols.\nwant=%+v\ngot=%+v", expected, symbols)
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	c, stop := newClient(t)
+	defer stop()
+	c.open(testProgram)
+
+	labels := func(pos TextDocumentPositionParams) []string {
+		var items []CompletionItem
+		if err := c.call("textDocument/completion", pos, &items); err != nil {
+			t.Fatalf("completion failed: %+v", err)
+		}
+		result := []string{}
+		for _, item := range items {
+			result = append(result, item.Label)
+		}
+		return result
+	}
+
+	inside := labels(at(3, 2))
+	expectedInside := withBuiltins("a", "add", "b", "limit", "sum")
+	if !reflect.DeepEqual(inside, expectedInside) {
+		t.Errorf("wrong completion inside function.\nwant=%v\ngot=%v", expectedInside, inside)
+	}
+
+	outside := labels(at(5, 0))
+	expectedOutside := withBuiltins("add", "limit")
+	if !reflect.DeepEqual(outside, expectedOutside) {
+		t.Errorf("wrong completion outside function.\nwant=%v\ngot=%v", expectedOutside, outside)
+	}
+}
+
+// withBuiltins returns names and the names of the builtins, sorted
+func withBuiltins(names ...string) []string {
+	result := append(names, evaluator.BuiltinNames()...)
+	sort.Strings(result)
+	return result
+}
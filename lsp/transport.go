@@ -0,0 +1,81 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// readMessage reads a single message framed by a Content-Length header
+func readMessage(r *bufio.Reader) (*message, error) {
+	length := -1
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+
+		name, value := line, ""
+		if i := strings.Index(line, ":"); i >= 0 {
+			name, value = line[:i], strings.TrimSpace(line[i+1:])
+		}
+
+		if strings.EqualFold(name, "Content-Length") {
+			length, err = strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid Content-Length: %q", value)
+			}
+		}
+	}
+
+	if length < 0 {
+		return nil, fmt.Errorf("missing Content-Length header")
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+
+	msg := &message{}
+	if err := json.Unmarshal(body, msg); err != nil {
+		return nil, &parseError{err}
+	}
+
+	return msg, nil
+}
+
+// writeMessage writes msg with a Content-Length header
+func writeMessage(w io.Writer, msg *message) error {
+	msg.JSONRPC = "2.0"
+
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(w, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = w.Write(body)
+	return err
+}
+
+// parseError is returned by readMessage for a well framed message whose body
+// is not valid JSON. The connection stays usable after it.
+type parseError struct {
+	err error
+}
+
+func (e *parseError) Error() string {
+	return "invalid message: " + e.err.Error()
+}
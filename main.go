@@ -8,6 +8,19 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "bench":
+			os.Exit(runBench(os.Args[2:]))
+		case "fmt":
+			os.Exit(runFmt(os.Args[2:]))
+		case "lint":
+			os.Exit(runLint(os.Args[2:]))
+		case "lsp":
+			os.Exit(runLsp(os.Args[2:]))
+		}
+	}
+
 	usr, err := user.Current()
 	if err != nil {
 		panic(err)
@@ -0,0 +1,132 @@
+// Package module locates and parses the files imported by Monkey programs.
+// Compiling or evaluating a module is left to each backend; the loader
+// only resolves import paths, caches parsed files and detects import
+// cycles.
+package module
+
+import (
+	"fmt"
+	"io/ioutil"
+	"monkey-compiler/ast"
+	"monkey-compiler/lexer"
+	"monkey-compiler/parser"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Ext is the extension added to import paths without one
+const Ext = ".mk"
+
+// PathEnv is the environment variable listing the default search path
+const PathEnv = "MONKEYPATH"
+
+// DefaultPath returns the search path listed in $MONKEYPATH
+func DefaultPath() []string {
+	return filepath.SplitList(os.Getenv(PathEnv))
+}
+
+// Loader finds and parses modules. Paths starting with "./" or "../" are
+// resolved relative to the importing file, absolute paths are used as
+// they are, and any other path is looked up in the directories of Path in
+// order.
+type Loader struct {
+	// Path lists the directories searched for non-relative imports
+	Path []string
+
+	programs map[string]*ast.Program // parsed modules by file
+	loading  []string                // files being loaded, outermost first
+}
+
+// NewLoader returns a loader searching path for non-relative imports
+func NewLoader(path ...string) *Loader {
+	return &Loader{Path: path, programs: make(map[string]*ast.Program)}
+}
+
+// Resolve returns the absolute file imported as name by code in file.
+// file is "" for code not read from a file, whose relative imports are
+// resolved against the working directory.
+func (l *Loader) Resolve(name, file string) (string, error) {
+	if filepath.Ext(name) == "" {
+		name += Ext
+	}
+
+	var candidates []string
+	switch {
+	case filepath.IsAbs(name):
+		candidates = []string{name}
+	case strings.HasPrefix(name, "./") || strings.HasPrefix(name, "../"):
+		dir := "."
+		if file != "" {
+			dir = filepath.Dir(file)
+		}
+		candidates = []string{filepath.Join(dir, name)}
+	default:
+		for _, dir := range l.Path {
+			candidates = append(candidates, filepath.Join(dir, name))
+		}
+	}
+
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return filepath.Abs(candidate)
+		}
+	}
+	return "", fmt.Errorf("module %q not found", name)
+}
+
+// Begin marks file as being loaded, failing if it is already being loaded
+// by one of the modules importing it. Every successful Begin must be
+// followed by an End once the module is loaded.
+func (l *Loader) Begin(file string) error {
+	for i, loading := range l.loading {
+		if loading == file {
+			cycle := append(append([]string{}, l.loading[i:]...), file)
+			return fmt.Errorf("import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	l.loading = append(l.loading, file)
+	return nil
+}
+
+// End marks the module loaded last by Begin as loaded
+func (l *Loader) End() {
+	l.loading = l.loading[:len(l.loading)-1]
+}
+
+// Parse returns the program in file, reading and parsing it only once
+func (l *Loader) Parse(file string) (*ast.Program, error) {
+	if program, ok := l.programs[file]; ok {
+		return program, nil
+	}
+
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("parse error in %s: %s", file, strings.Join(p.Errors(), "; "))
+	}
+
+	l.programs[file] = program
+	return program, nil
+}
+
+// Exports returns the names bound by the exported let statements of
+// program, in order of appearance
+func Exports(program *ast.Program) []string {
+	names := []string{}
+	seen := make(map[string]bool)
+	for _, stmt := range program.Statements {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok || !let.Exported || seen[let.Name.Value] {
+			continue
+		}
+		seen[let.Name.Value] = true
+		names = append(names, let.Name.Value)
+	}
+	return names
+}
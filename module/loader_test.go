@@ -0,0 +1,128 @@
+package module
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.mk":         "",
+		"lib/util.mk":     "",
+		"lib/sub/deep.mk": "",
+		"path/shared.mk":  "",
+	})
+	defer os.RemoveAll(dir)
+
+	loader := NewLoader(filepath.Join(dir, "path"), filepath.Join(dir, "lib"))
+	main := filepath.Join(dir, "main.mk")
+	util := filepath.Join(dir, "lib", "util.mk")
+
+	tests := []struct {
+		name     string
+		file     string
+		expected string
+	}{
+		{"./lib/util", main, util},
+		{"./lib/util.mk", main, util},
+		{"../main", util, main},
+		{"./sub/deep", util, filepath.Join(dir, "lib", "sub", "deep.mk")},
+		{"shared", main, filepath.Join(dir, "path", "shared.mk")},
+		{"util", main, util},
+		{"sub/deep", main, filepath.Join(dir, "lib", "sub", "deep.mk")},
+		{main, "", main},
+	}
+
+	for _, tt := range tests {
+		actual, err := loader.Resolve(tt.name, tt.file)
+		if err != nil {
+			t.Errorf("Resolve(%q, %q) returned error: %s", tt.name, tt.file, err)
+			continue
+		}
+		if actual != tt.expected {
+			t.Errorf("Resolve(%q, %q) wrong. want=%q, got=%q", tt.name, tt.file, tt.expected, actual)
+		}
+	}
+
+	for _, name := range []string{"./util", "missing", "./lib"} {
+		if _, err := loader.Resolve(name, main); err == nil {
+			t.Errorf("expected error resolving %q", name)
+		}
+	}
+}
+
+func TestBeginDetectsCycles(t *testing.T) {
+	loader := NewLoader()
+
+	if err := loader.Begin("a.mk"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := loader.Begin("b.mk"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	err := loader.Begin("a.mk")
+	if err == nil || err.Error() != "import cycle: a.mk -> b.mk -> a.mk" {
+		t.Fatalf("wrong error. got=%v", err)
+	}
+
+	loader.End()
+	loader.End()
+	if err := loader.Begin("a.mk"); err != nil {
+		t.Errorf("unexpected error after loading: %s", err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"ok.mk":  "export let a = 1; let b = 2; export let c = fn() { a };",
+		"bad.mk": "let = 1;",
+	})
+	defer os.RemoveAll(dir)
+
+	loader := NewLoader()
+	ok := filepath.Join(dir, "ok.mk")
+
+	program, err := loader.Parse(ok)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if exports := Exports(program); !reflect.DeepEqual(exports, []string{"a", "c"}) {
+		t.Errorf("wrong exports. got=%v", exports)
+	}
+
+	again, _ := loader.Parse(ok)
+	if again != program {
+		t.Errorf("module parsed twice")
+	}
+
+	_, err = loader.Parse(filepath.Join(dir, "bad.mk"))
+	if err == nil || !strings.HasPrefix(err.Error(), "parse error in ") {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
+
+// writeFiles writes files, keyed by slash-separated path, into a new
+// temporary directory and returns it
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "module")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
@@ -0,0 +1,128 @@
+package monkey
+
+import (
+	"fmt"
+	"math"
+	"monkey-compiler/object"
+	"monkey-compiler/vm"
+	"reflect"
+	"sort"
+)
+
+// ToObject converts a Go value to a Monkey object. nil, booleans, strings,
+// integers, slices and maps with string keys are supported. Objects are
+// returned unchanged.
+func ToObject(v interface{}) (object.Object, error) {
+	switch v := v.(type) {
+	case nil:
+		return vm.Null, nil
+	case object.Object:
+		return v, nil
+	case bool:
+		// the VM tells booleans apart by identity
+		if v {
+			return vm.True, nil
+		}
+		return vm.False, nil
+	case string:
+		return &object.String{Value: v}, nil
+	case int:
+		return object.NewInteger(int64(v)), nil
+	case int64:
+		return object.NewInteger(v), nil
+	case []interface{}:
+		return sliceToArray(reflect.ValueOf(v))
+	case map[string]interface{}:
+		return mapToHash(reflect.ValueOf(v))
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return object.NewInteger(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if rv.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("integer %d overflows INTEGER", rv.Uint())
+		}
+		return object.NewInteger(int64(rv.Uint())), nil
+	case reflect.Slice, reflect.Array:
+		return sliceToArray(rv)
+	case reflect.Map:
+		if rv.Type().Key().Kind() == reflect.String {
+			return mapToHash(rv)
+		}
+	}
+
+	return nil, fmt.Errorf("cannot convert %T to a Monkey object", v)
+}
+
+func sliceToArray(rv reflect.Value) (object.Object, error) {
+	elements := make([]object.Object, rv.Len())
+	for i := range elements {
+		el, err := ToObject(rv.Index(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+		elements[i] = el
+	}
+	return &object.Array{Elements: elements}, nil
+}
+
+func mapToHash(rv reflect.Value) (object.Object, error) {
+	// insert keys in a fixed order so that equal maps make equal hashes
+	keys := rv.MapKeys()
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+
+	hash := object.NewHash(len(keys))
+	for _, key := range keys {
+		value, err := ToObject(rv.MapIndex(key).Interface())
+		if err != nil {
+			return nil, err
+		}
+		hash.Set(&object.String{Value: key.String()}, value)
+	}
+	return hash, nil
+}
+
+// ToGo converts a Monkey object to a Go value: INTEGER to int64, STRING to
+// string, BOOLEAN to bool, NULL to nil, ARRAY to []interface{} and HASH to
+// map[string]interface{}. Hashes must only have string keys. Functions and
+// other objects without a Go counterpart are returned unchanged.
+func ToGo(obj object.Object) (interface{}, error) {
+	switch obj := obj.(type) {
+	case nil, *object.Null:
+		return nil, nil
+	case *object.Integer:
+		return obj.Value, nil
+	case *object.String:
+		return obj.Value, nil
+	case *object.Boolean:
+		return obj.Value, nil
+	case *object.Array:
+		elements := make([]interface{}, len(obj.Elements))
+		for i, el := range obj.Elements {
+			v, err := ToGo(el)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = v
+		}
+		return elements, nil
+	case *object.Hash:
+		m := make(map[string]interface{}, obj.Len())
+		for _, pair := range obj.OrderedPairs() {
+			key, ok := pair.Key.(*object.String)
+			if !ok {
+				return nil, fmt.Errorf("cannot convert hash with %s key to a Go map", pair.Key.Type())
+			}
+			v, err := ToGo(pair.Value)
+			if err != nil {
+				return nil, err
+			}
+			m[key.Value] = v
+		}
+		return m, nil
+	}
+
+	return obj, nil
+}
@@ -0,0 +1,87 @@
+package monkey
+
+import (
+	"monkey-compiler/object"
+	"monkey-compiler/vm"
+	"reflect"
+	"testing"
+)
+
+func TestToObject(t *testing.T) {
+	tests := []struct {
+		input    interface{}
+		expected string
+		typ      object.ObjectType
+	}{
+		{nil, "null", object.NULL_OBJ},
+		{true, "true", object.BOOLEAN_OBJ},
+		{"hi", "hi", object.STRING_OBJ},
+		{42, "42", object.INTEGER_OBJ},
+		{int8(-3), "-3", object.INTEGER_OBJ},
+		{uint16(9), "9", object.INTEGER_OBJ},
+		{[]interface{}{1, "a"}, "[1, a]", object.ARRAY_OBJ},
+		{[]string{"a", "b"}, "[a, b]", object.ARRAY_OBJ},
+		{map[string]interface{}{"k": []int{1}}, "{k: [1]}", object.HASH_OBJ},
+		{&object.Integer{Value: 5}, "5", object.INTEGER_OBJ},
+	}
+
+	for _, tt := range tests {
+		obj, err := ToObject(tt.input)
+		if err != nil {
+			t.Errorf("ToObject(%#v) returned error: %s", tt.input, err)
+			continue
+		}
+		if obj.Type() != tt.typ || obj.Inspect() != tt.expected {
+			t.Errorf("ToObject(%#v) wrong. want=%s %s, got=%s %s",
+				tt.input, tt.typ, tt.expected, obj.Type(), obj.Inspect())
+		}
+	}
+
+	if obj, _ := ToObject(false); obj != vm.False {
+		t.Errorf("booleans must be the VM's singletons")
+	}
+
+	for _, input := range []interface{}{1.5, uint64(1 << 63), map[int]int{1: 1}, struct{}{}, []interface{}{1.5}} {
+		if _, err := ToObject(input); err == nil {
+			t.Errorf("ToObject(%#v) should fail", input)
+		}
+	}
+}
+
+func TestToGo(t *testing.T) {
+	hash, _ := ToObject(map[string]interface{}{"a": []interface{}{int64(1), nil}})
+
+	tests := []struct {
+		input    object.Object
+		expected interface{}
+	}{
+		{vm.Null, nil},
+		{&object.Integer{Value: 1}, int64(1)},
+		{&object.String{Value: "s"}, "s"},
+		{vm.True, true},
+		{hash, map[string]interface{}{"a": []interface{}{int64(1), nil}}},
+	}
+
+	for _, tt := range tests {
+		actual, err := ToGo(tt.input)
+		if err != nil {
+			t.Errorf("ToGo(%s) returned error: %s", tt.input.Inspect(), err)
+			continue
+		}
+		if !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("ToGo(%s) wrong. want=%#v, got=%#v", tt.input.Inspect(), tt.expected, actual)
+		}
+	}
+
+	closure := &object.Closure{Fn: &object.CompiledFunction{}}
+	if actual, _ := ToGo(closure); actual != closure {
+		t.Errorf("objects without Go counterpart should be returned as they are")
+	}
+
+	key := &object.Integer{Value: 1}
+	intKeyed := object.NewHash(1)
+	intKeyed.Set(key, key)
+	if _, err := ToGo(intKeyed); err == nil {
+		t.Errorf("hash with integer keys should not convert")
+	}
+}
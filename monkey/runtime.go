@@ -0,0 +1,261 @@
+// Package monkey runs Monkey code from Go programs.
+//
+//	rt := monkey.NewRuntime()
+//	rt.Set("limit", 10)
+//	rt.RegisterFunc("double", func(args ...interface{}) (interface{}, error) {
+//		return args[0].(int64) * 2, nil
+//	})
+//	result, err := rt.Eval("double(limit) + 1") // int64(21)
+package monkey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"monkey-compiler/compiler"
+	"monkey-compiler/evaluator"
+	"monkey-compiler/lexer"
+	"monkey-compiler/limit"
+	"monkey-compiler/module"
+	"monkey-compiler/object"
+	"monkey-compiler/parser"
+	"monkey-compiler/vm"
+	"strings"
+)
+
+// Func is a Go function callable from Monkey. Arguments are converted with
+// ToGo and the result with ToObject. A returned error becomes a Monkey
+// error value.
+type Func func(args ...interface{}) (interface{}, error)
+
+// Runtime compiles and runs Monkey code on the VM. Globals defined by a
+// program stay visible to the programs run after it.
+type Runtime struct {
+	symbolTable *compiler.SymbolTable
+	constants   []object.Object // shared so functions outlive their program
+	globals     []object.Object
+	builtins    []*object.Builtin
+	builtinIDs  map[string]int // indexes of builtins by name
+	macroEnv    *object.Environment
+	limits      limit.Limits
+	loader      *module.Loader
+}
+
+// Program is code compiled by a runtime, ready to be run on it
+type Program struct {
+	runtime  *Runtime
+	byteCode *compiler.ByteCode
+	hasValue bool // the program ends with a statement that has a value
+}
+
+// ParseError holds the syntax errors of a source
+type ParseError struct {
+	Messages []string
+}
+
+func (e *ParseError) Error() string {
+	return "parse error: " + strings.Join(e.Messages, "; ")
+}
+
+// NewRuntime returns a runtime with the builtins of object.DefaultSandbox
+// and no globals
+func NewRuntime() *Runtime {
+	return NewSandboxedRuntime(object.DefaultSandbox)
+}
+
+// NewSandboxedRuntime returns a runtime with the builtins granted by
+// sandbox and no globals. Code using other builtins fails to compile.
+func NewSandboxedRuntime(sandbox *object.Sandbox) *Runtime {
+	r := &Runtime{
+		symbolTable: compiler.NewSymbolTable(),
+		constants:   []object.Object{},
+		builtinIDs:  map[string]int{},
+		macroEnv:    object.NewEnvironment(),
+		loader:      module.NewLoader(),
+	}
+
+	builtins := sandbox.Builtins()
+	for _, def := range builtins {
+		r.defineBuiltin(def.Name, def.Builtin)
+	}
+	// macros run on the evaluator, which must be sandboxed too
+	r.macroEnv.SetBuiltins(builtins)
+
+	return r
+}
+
+// maxBuiltins is the number of builtins the one-byte operand of
+// OpGetBuiltin can refer to
+const maxBuiltins = 1 << 8
+
+// defineBuiltin defines builtin as name, replacing the builtin of that
+// name if there is one
+func (r *Runtime) defineBuiltin(name string, builtin *object.Builtin) error {
+	index, ok := r.builtinIDs[name]
+	if ok {
+		r.builtins[index] = builtin
+	} else {
+		if len(r.builtins) == maxBuiltins {
+			return fmt.Errorf("too many builtins to define %s", name)
+		}
+		index = len(r.builtins)
+		r.builtins = append(r.builtins, builtin)
+		r.builtinIDs[name] = index
+	}
+
+	r.symbolTable.DefineBuiltin(index, name)
+	return nil
+}
+
+// SetLimits bounds the resources each program run afterwards may use
+func (r *Runtime) SetLimits(limits limit.Limits) {
+	r.limits = limits
+}
+
+// SetLoader makes code compiled afterwards import modules with loader.
+// The default loader has an empty search path.
+func (r *Runtime) SetLoader(loader *module.Loader) {
+	r.loader = loader
+}
+
+// RegisterFunc makes fn callable from Monkey code compiled afterwards as
+// name. It replaces a function registered or a builtin of the same name and
+// shadows a global. An error is returned when there are too many builtins
+// already.
+func (r *Runtime) RegisterFunc(name string, fn Func) error {
+	return r.defineBuiltin(name, &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			goArgs := make([]interface{}, len(args))
+			for i, arg := range args {
+				v, err := ToGo(arg)
+				if err != nil {
+					return &object.Error{Message: fmt.Sprintf("%s: %s", name, err)}
+				}
+				goArgs[i] = v
+			}
+
+			result, err := fn(goArgs...)
+			if err != nil {
+				return &object.Error{Message: fmt.Sprintf("%s: %s", name, err)}
+			}
+
+			obj, err := ToObject(result)
+			if err != nil {
+				return &object.Error{Message: fmt.Sprintf("%s: %s", name, err)}
+			}
+			return obj
+		},
+	})
+}
+
+// Compile parses and compiles src. Globals it defines are known to the
+// runtime from then on, but only get their values once the program runs.
+func (r *Runtime) Compile(src string) (*Program, error) {
+	return r.CompileContext(context.Background(), src)
+}
+
+// CompileContext is like Compile, but stops expanding macros when ctx is
+// done or the macros exceed the limits of the runtime
+func (r *Runtime) CompileContext(ctx context.Context, src string) (*Program, error) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, &ParseError{Messages: p.Errors()}
+	}
+
+	evaluator.DefineMacros(program, r.macroEnv)
+	expanded, err := evaluator.ExpandMacrosContext(ctx, program, r.macroEnv, r.limits)
+	if err != nil {
+		return nil, err
+	}
+
+	// a failed compilation must not leave definitions behind
+	symbolTable := r.symbolTable.Clone()
+	comp := compiler.NewWithState(symbolTable, r.constants)
+	comp.SetLoader(r.loader, "")
+	if err := comp.Compile(expanded); err != nil {
+		return nil, err
+	}
+
+	byteCode := comp.ByteCode()
+	r.symbolTable, r.constants = symbolTable, byteCode.Constants
+
+	return &Program{runtime: r, byteCode: byteCode, hasValue: compiler.EndsWithValue(expanded)}, nil
+}
+
+// Run runs the program and returns the value of its last expression
+// statement converted with ToGo. A Monkey error value is returned as error.
+func (p *Program) Run() (interface{}, error) {
+	return p.RunContext(context.Background())
+}
+
+// RunContext is like Run, but stops the program when ctx is done or it
+// exceeds the limits of the runtime
+func (p *Program) RunContext(ctx context.Context) (interface{}, error) {
+	r := p.runtime
+	r.globals = vm.GrowGlobals(r.globals, p.byteCode.NumGlobals)
+	machine := vm.NewWithBuiltins(p.byteCode, r.globals, r.builtins)
+	machine.SetLimits(r.limits)
+	if err := machine.RunContext(ctx); err != nil {
+		return nil, err
+	}
+	// the stack holds leftovers of let statements too
+	if !p.hasValue {
+		return nil, nil
+	}
+
+	result := machine.LastPopped()
+	if err, ok := result.(*object.Error); ok {
+		return nil, errors.New(err.Message)
+	}
+	return ToGo(result)
+}
+
+// Eval compiles and runs src
+func (r *Runtime) Eval(src string) (interface{}, error) {
+	return r.EvalContext(context.Background(), src)
+}
+
+// EvalContext compiles src with CompileContext and runs it with RunContext
+func (r *Runtime) EvalContext(ctx context.Context, src string) (interface{}, error) {
+	program, err := r.CompileContext(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+	return program.RunContext(ctx)
+}
+
+// Set assigns value, converted with ToObject, to the global name, defining
+// it if needed
+func (r *Runtime) Set(name string, value interface{}) error {
+	obj, err := ToObject(value)
+	if err != nil {
+		return err
+	}
+
+	symbol, ok := r.symbolTable.Resolve(name)
+	if !ok || symbol.Scope != compiler.GlobalScope {
+		symbol = r.symbolTable.Define(name)
+	}
+	if symbol.Index >= vm.GlobalsSize {
+		return fmt.Errorf("too many globals to define %s", name)
+	}
+
+	r.globals = vm.GrowGlobals(r.globals, symbol.Index+1)
+	r.globals[symbol.Index] = obj
+	return nil
+}
+
+// Get returns the value of the global name converted with ToGo
+func (r *Runtime) Get(name string) (interface{}, error) {
+	symbol, ok := r.symbolTable.Resolve(name)
+	if !ok || symbol.Scope != compiler.GlobalScope {
+		return nil, fmt.Errorf("undefined global: %s", name)
+	}
+	// globals of programs not run yet hold nothing
+	var obj object.Object
+	if symbol.Index < len(r.globals) {
+		obj = r.globals[symbol.Index]
+	}
+	return ToGo(obj)
+}
@@ -0,0 +1,367 @@
+package monkey
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"monkey-compiler/limit"
+	"monkey-compiler/object"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1 + 2", int64(3)},
+		{`"mon" + "key"`, "monkey"},
+		{"1 < 2", true},
+		{"if (false) { 1 }", nil},
+		{"[1, \"two\", [true]]", []interface{}{int64(1), "two", []interface{}{true}}},
+		{`{"a": 1, "b": [2]}`, map[string]interface{}{"a": int64(1), "b": []interface{}{int64(2)}}},
+		{"let add = fn(a, b) { a + b }; add(20, 22)", int64(42)},
+		{"len(\"four\")", int64(4)},
+		{"1 + 2; let x = 5;", nil},
+		{"let x = 5; return x;", int64(5)},
+		{"", nil},
+	}
+
+	for _, tt := range tests {
+		actual, err := NewRuntime().Eval(tt.input)
+		if err != nil {
+			t.Errorf("Eval(%q) returned error: %s", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("Eval(%q) wrong. want=%#v, got=%#v", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let = 1", "parse error: expected next token to be IDENT, got = instead; no prefix parse function for = found"},
+		{"x + 1", "undefined variable: x"},
+		{"1 + true", "type mismatch: INTEGER + BOOLEAN"},
+		{"len(1)", "argument to `len` not supported, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		_, err := NewRuntime().Eval(tt.input)
+		if err == nil {
+			t.Errorf("Eval(%q) should fail", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("Eval(%q) wrong error. want=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+
+	var parseErr *ParseError
+	if _, err := NewRuntime().Eval("let"); !errors.As(err, &parseErr) {
+		t.Errorf("syntax errors should be *ParseError. got=%T", err)
+	}
+}
+
+func TestGlobalsPersist(t *testing.T) {
+	rt := NewRuntime()
+
+	if _, err := rt.Eval("let counter = 1; let inc = fn(x) { x + 1 };"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := rt.Eval("let counter = inc(counter);"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	counter, err := rt.Get("counter")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if counter != int64(2) {
+		t.Errorf("wrong counter. want=2, got=%#v", counter)
+	}
+
+	// functions read the globals of the runtime after they grow
+	if _, err := rt.Eval("let get = fn() { counter };"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for i := 0; i < 100; i++ {
+		if err := rt.Set(fmt.Sprintf("global%d", i), i); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if err := rt.Set("counter", 5); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if counter, err := rt.Eval("get()"); err != nil || counter != int64(5) {
+		t.Errorf("wrong counter read by a function. want=5, got=%#v (%v)", counter, err)
+	}
+
+	// a failed compilation leaves no definitions behind
+	if _, err := rt.Eval("let broken = missing;"); err == nil {
+		t.Fatalf("expected compile error")
+	}
+	if _, err := rt.Get("broken"); err == nil {
+		t.Errorf("broken should not be defined")
+	}
+}
+
+func TestSetAndGet(t *testing.T) {
+	rt := NewRuntime()
+
+	values := map[string]interface{}{
+		"n":     int64(7),
+		"s":     "seven",
+		"b":     true,
+		"list":  []interface{}{int64(1), "a"},
+		"table": map[string]interface{}{"k": false},
+	}
+	for name, value := range values {
+		if err := rt.Set(name, value); err != nil {
+			t.Fatalf("Set(%q) failed: %s", name, err)
+		}
+	}
+
+	result, err := rt.Eval(`[n * 2, s + "!", !b, len(list), table["k"]]`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []interface{}{int64(14), "seven!", false, int64(2), false}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("wrong result. want=%#v, got=%#v", expected, result)
+	}
+
+	for name, value := range values {
+		actual, err := rt.Get(name)
+		if err != nil {
+			t.Fatalf("Get(%q) failed: %s", name, err)
+		}
+		if !reflect.DeepEqual(actual, value) {
+			t.Errorf("Get(%q) wrong. want=%#v, got=%#v", name, value, actual)
+		}
+	}
+
+	if err := rt.Set("n", 8); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result, _ := rt.Eval("n"); result != int64(8) {
+		t.Errorf("Set should overwrite existing global. got=%#v", result)
+	}
+
+	if _, err := rt.Get("undefined"); err == nil || err.Error() != "undefined global: undefined" {
+		t.Errorf("wrong error for undefined global. got=%v", err)
+	}
+	if err := rt.Set("f", 1.5); err == nil {
+		t.Errorf("expected error setting float")
+	}
+}
+
+func TestRegisterFunc(t *testing.T) {
+	rt := NewRuntime()
+	rt.RegisterFunc("join", func(args ...interface{}) (interface{}, error) {
+		parts := []string{}
+		for _, arg := range args[0].([]interface{}) {
+			s, ok := arg.(string)
+			if !ok {
+				return nil, errors.New("elements must be strings")
+			}
+			parts = append(parts, s)
+		}
+		return strings.Join(parts, args[1].(string)), nil
+	})
+	rt.RegisterFunc("pair", func(args ...interface{}) (interface{}, error) {
+		return map[string]interface{}{"first": args[0], "second": args[1]}, nil
+	})
+
+	result, err := rt.Eval(`let words = ["a", "b"]; join(words, "-") + "!"`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result != "a-b!" {
+		t.Errorf("wrong result. got=%#v", result)
+	}
+
+	result, err = rt.Eval(`pair(1, "x")["second"]`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result != "x" {
+		t.Errorf("wrong result. got=%#v", result)
+	}
+
+	_, err = rt.Eval(`join([1], "-")`)
+	if err == nil || err.Error() != "join: elements must be strings" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+
+	// functions can be passed around like builtins
+	result, err = rt.Eval(`let apply = fn(f, a, b) { f(a, b) }; apply(join, ["c", "d"], "+")`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result != "c+d" {
+		t.Errorf("wrong result. got=%#v", result)
+	}
+}
+
+func TestRegisterFuncAgain(t *testing.T) {
+	rt := NewRuntime()
+	constant := func(v int64) Func {
+		return func(args ...interface{}) (interface{}, error) { return v, nil }
+	}
+
+	for i := int64(0); i < 300; i++ {
+		if err := rt.RegisterFunc("f", constant(i)); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if err := rt.RegisterFunc("len", constant(-1)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	result, err := rt.Eval(`[f(), len("abc")]`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(result, []interface{}{int64(299), int64(-1)}) {
+		t.Errorf("wrong result. got=%#v", result)
+	}
+}
+
+func TestRegisterFuncLimit(t *testing.T) {
+	rt := NewRuntime()
+	fn := func(args ...interface{}) (interface{}, error) { return nil, nil }
+
+	var err error
+	name := ""
+	for i := 0; err == nil; i++ {
+		name = fmt.Sprintf("f%d", i)
+		err = rt.RegisterFunc(name, fn)
+	}
+	if err.Error() != "too many builtins to define "+name {
+		t.Errorf("wrong error. got=%q", err)
+	}
+	if len(rt.builtins) != maxBuiltins {
+		t.Errorf("wrong number of builtins. got=%d", len(rt.builtins))
+	}
+
+	result, err := rt.Eval(`len("abc")`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result != int64(3) {
+		t.Errorf("wrong result. got=%#v", result)
+	}
+}
+
+func TestCompileOnceRunTwice(t *testing.T) {
+	rt := NewRuntime()
+	rt.Set("x", 1)
+
+	program, err := rt.Compile("x * 10")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, x := range []int64{1, 2} {
+		rt.Set("x", x)
+		result, err := program.Run()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if result != x*10 {
+			t.Errorf("wrong result. want=%d, got=%#v", x*10, result)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	rt := NewRuntime()
+	rt.SetLimits(limit.Limits{MaxDepth: 10})
+
+	_, err := rt.Eval("let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(100)")
+	var limitErr *limit.LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != limit.Depth {
+		t.Fatalf("expected call depth LimitError. got=%v", err)
+	}
+
+	result, err := rt.Eval("f(5)")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result != int64(5) {
+		t.Errorf("wrong result. got=%#v", result)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := rt.EvalContext(ctx, "f(5)"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected error to wrap context.Canceled. got=%v", err)
+	}
+}
+
+func TestMacroLimits(t *testing.T) {
+	loop := "let m = macro() { let f = fn(n) { f(n + 1) }; f(0) }; m()"
+
+	rt := NewRuntime()
+	rt.SetLimits(limit.Limits{MaxInstructions: 100000})
+	_, err := rt.Eval(loop)
+	var limitErr *limit.LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != limit.Instructions {
+		t.Errorf("expected instruction LimitError. got=%v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := NewRuntime().EvalContext(ctx, loop); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected error to wrap context.DeadlineExceeded. got=%v", err)
+	}
+}
+
+func TestSandboxedRuntime(t *testing.T) {
+	var out bytes.Buffer
+	rt := NewSandboxedRuntime(&object.Sandbox{Modules: []string{object.ModuleStdout}, Stdout: &out})
+
+	if _, err := rt.Eval(`puts("hello")`); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if out.String() != "hello\n" {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+
+	_, err := rt.Eval(`read_file("/etc/passwd")`)
+	expected := "builtin read_file is not allowed: module fs is not granted"
+	if err == nil || err.Error() != expected {
+		t.Errorf("wrong error. want=%q, got=%v", expected, err)
+	}
+
+	// macros are sandboxed too
+	_, err = rt.Eval(`let m = macro() { quote(unquote(read_file("/etc/passwd"))) }; m()`)
+	expected = "macro m: identifier not found: read_file"
+	if err == nil || err.Error() != expected {
+		t.Errorf("wrong error. want=%q, got=%v", expected, err)
+	}
+
+	out.Reset()
+	if _, err := rt.Eval(`let say = macro() { puts("expanding"); quote(1) }; say()`); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if out.String() != "expanding\n" {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+	out.Reset()
+	denied := NewSandboxedRuntime(&object.Sandbox{Stdout: &out})
+	_, err = denied.Eval(`let m = macro() { puts("leak"); quote(1) }; m()`)
+	expected = "macro m: identifier not found: puts"
+	if err == nil || err.Error() != expected {
+		t.Errorf("wrong error. want=%q, got=%v", expected, err)
+	}
+}
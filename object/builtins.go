@@ -0,0 +1,190 @@
+package object
+
+import "fmt"
+
+// BuiltinDef is a builtin function with the name it is bound to
+type BuiltinDef struct {
+	Name    string
+	Builtin *Builtin
+}
+
+// Builtins are the builtins granted by DefaultSandbox, shared by the
+// evaluator and the VM by default
+var Builtins = DefaultSandbox.Builtins()
+
+// catalog lists every builtin with the module granting it, "" for those
+// without side effects which every sandbox grants. The VM refers to
+// builtins by their index among the granted ones, so new builtins must be
+// appended.
+var catalog = []struct {
+	name   string
+	module string
+	new    func(s *Sandbox) *Builtin
+}{
+	{"len", "", pure(builtinLen)},
+	{"puts", ModuleStdout, newPuts},
+	{"first", "", pure(builtinFirst)},
+	{"last", "", pure(builtinLast)},
+	{"rest", "", pure(builtinRest)},
+	{"push", "", pure(builtinPush)},
+	{"read_file", ModuleFS, newReadFile},
+	{"write_file", ModuleFS, newWriteFile},
+	{"now", ModuleTime, newNow},
+	{"getenv", ModuleEnv, newGetenv},
+	{"map", "", higherOrder(builtinMap)},
+	{"filter", "", higherOrder(builtinFilter)},
+	{"reduce", "", higherOrder(builtinReduce)},
+	{"sort", "", higherOrder(builtinSort)},
+	{"reverse", "", pure(builtinReverse)},
+	{"contains", "", pure(builtinContains)},
+	{"keys", "", pure(builtinKeys)},
+	{"values", "", pure(builtinValues)},
+	{"delete", "", pure(builtinDelete)},
+	{"merge", "", pure(builtinMerge)},
+	{"range", "", sized(builtinRange, rangeSize)},
+	{"slice", "", pure(builtinSlice)},
+	{"join", "", sized(builtinJoin, joinSize)},
+	{"zip", "", pure(builtinZip)},
+	{"split", "", pure(builtinSplit)},
+	{"index_of", "", pure(builtinIndexOf)},
+	{"starts_with", "", pure(builtinStartsWith)},
+	{"ends_with", "", pure(builtinEndsWith)},
+	{"upper", "", pure(builtinUpper)},
+	{"lower", "", pure(builtinLower)},
+	{"trim", "", pure(builtinTrim)},
+	{"replace", "", sized(builtinReplace, replaceSize)},
+	{"repeat", "", sized(builtinRepeat, repeatSize)},
+	{"char", "", pure(builtinChar)},
+	{"ord", "", pure(builtinOrd)},
+	{"format", "", pure(builtinFormat)},
+	{"type", "", pure(builtinType)},
+	{"str", "", pure(builtinStr)},
+	{"int", "", pure(builtinInt)},
+	{"bool", "", pure(builtinBool)},
+	{"inspect", "", pure(builtinInspect)},
+	{"json_parse", "", pure(builtinJSONParse)},
+	{"json_stringify", "", pure(builtinJSONStringify)},
+	{"error", "", pure(builtinError)},
+	{"is_error", "", pure(builtinIsError)},
+}
+
+func pure(fn BuiltinFunction) func(s *Sandbox) *Builtin {
+	return func(*Sandbox) *Builtin {
+		return &Builtin{Fn: fn}
+	}
+}
+
+func sized(fn BuiltinFunction, size func(args ...Object) int) func(s *Sandbox) *Builtin {
+	return func(*Sandbox) *Builtin {
+		return &Builtin{Fn: fn, Size: size}
+	}
+}
+
+func builtinLen(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *Array:
+		return NewInteger(int64(len(arg.Elements)))
+	case *String:
+		return NewInteger(int64(len(arg.Value)))
+	default:
+		return newError("argument to `len` not supported, got %s",
+			args[0].Type())
+	}
+}
+
+func builtinFirst(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+	if args[0].Type() != ARRAY_OBJ {
+		return newError("argument to `first` must be ARRAY, got %s",
+			args[0].Type())
+	}
+
+	arr := args[0].(*Array)
+	if len(arr.Elements) > 0 {
+		return arr.Elements[0]
+	}
+
+	return nil
+}
+
+func builtinLast(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+	if args[0].Type() != ARRAY_OBJ {
+		return newError("argument to `last` must be ARRAY, got %s",
+			args[0].Type())
+	}
+
+	arr := args[0].(*Array)
+	length := len(arr.Elements)
+	if length > 0 {
+		return arr.Elements[length-1]
+	}
+
+	return nil
+}
+
+func builtinRest(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+	if args[0].Type() != ARRAY_OBJ {
+		return newError("argument to `rest` must be ARRAY, got %s",
+			args[0].Type())
+	}
+
+	arr := args[0].(*Array)
+	length := len(arr.Elements)
+	if length > 0 {
+		newElements := make([]Object, length-1, length-1)
+		copy(newElements, arr.Elements[1:length])
+		return &Array{Elements: newElements}
+	}
+
+	return nil
+}
+
+func builtinPush(args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2",
+			len(args))
+	}
+	if args[0].Type() != ARRAY_OBJ {
+		return newError("argument to `push` must be ARRAY, got %s",
+			args[0].Type())
+	}
+
+	arr := args[0].(*Array)
+	length := len(arr.Elements)
+
+	newElements := make([]Object, length+1, length+1)
+	copy(newElements, arr.Elements)
+	newElements[length] = args[1]
+
+	return &Array{Elements: newElements}
+}
+
+// GetBuiltinByName returns the builtin called name, or nil if there is none
+func GetBuiltinByName(name string) *Builtin {
+	for _, def := range Builtins {
+		if def.Name == name {
+			return def.Builtin
+		}
+	}
+	return nil
+}
+
+func newError(format string, a ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...)}
+}
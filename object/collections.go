@@ -0,0 +1,521 @@
+package object
+
+import (
+	"sort"
+	"strings"
+)
+
+func higherOrder(fn HigherOrderFunction) func(s *Sandbox) *Builtin {
+	return func(*Sandbox) *Builtin {
+		return &Builtin{HigherOrder: fn}
+	}
+}
+
+func builtinMap(call CallFunction, args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2",
+			len(args))
+	}
+	arr, ok := args[0].(*Array)
+	if !ok {
+		return newError("first argument to `map` must be ARRAY, got %s",
+			args[0].Type())
+	}
+
+	elements := make([]Object, len(arr.Elements))
+	for i, el := range arr.Elements {
+		result := call(args[1], el)
+		if isError(result) {
+			return result
+		}
+		elements[i] = result
+	}
+	return &Array{Elements: elements}
+}
+
+func builtinFilter(call CallFunction, args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2",
+			len(args))
+	}
+	arr, ok := args[0].(*Array)
+	if !ok {
+		return newError("first argument to `filter` must be ARRAY, got %s",
+			args[0].Type())
+	}
+
+	elements := []Object{}
+	for _, el := range arr.Elements {
+		result := call(args[1], el)
+		if isError(result) {
+			return result
+		}
+		if isTruthy(result) {
+			elements = append(elements, el)
+		}
+	}
+	return &Array{Elements: elements}
+}
+
+func builtinReduce(call CallFunction, args ...Object) Object {
+	if len(args) != 3 {
+		return newError("wrong number of arguments. got=%d, want=3",
+			len(args))
+	}
+	arr, ok := args[0].(*Array)
+	if !ok {
+		return newError("first argument to `reduce` must be ARRAY, got %s",
+			args[0].Type())
+	}
+
+	result := args[1]
+	for _, el := range arr.Elements {
+		result = call(args[2], result, el)
+		if isError(result) {
+			return result
+		}
+	}
+	return result
+}
+
+// builtinSort sorts integers or strings in ascending order, or any
+// elements with a function telling whether its first argument goes before
+// its second one
+func builtinSort(call CallFunction, args ...Object) Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2",
+			len(args))
+	}
+	arr, ok := args[0].(*Array)
+	if !ok {
+		return newError("first argument to `sort` must be ARRAY, got %s",
+			args[0].Type())
+	}
+
+	elements := make([]Object, len(arr.Elements))
+	copy(elements, arr.Elements)
+
+	var failed Object
+	less := func(i, j int) bool {
+		if failed != nil {
+			return false
+		}
+
+		if len(args) == 2 {
+			result := call(args[1], elements[i], elements[j])
+			if isError(result) {
+				failed = result
+				return false
+			}
+			return isTruthy(result)
+		}
+
+		switch left := elements[i].(type) {
+		case *Integer:
+			if right, ok := elements[j].(*Integer); ok {
+				return left.Value < right.Value
+			}
+		case *String:
+			if right, ok := elements[j].(*String); ok {
+				return left.Value < right.Value
+			}
+		}
+		failed = newError("cannot sort %s and %s", elements[i].Type(), elements[j].Type())
+		return false
+	}
+	sort.SliceStable(elements, less)
+
+	if failed != nil {
+		return failed
+	}
+	return &Array{Elements: elements}
+}
+
+func builtinReverse(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+	arr, ok := args[0].(*Array)
+	if !ok {
+		return newError("argument to `reverse` must be ARRAY, got %s",
+			args[0].Type())
+	}
+
+	length := len(arr.Elements)
+	elements := make([]Object, length)
+	for i, el := range arr.Elements {
+		elements[length-1-i] = el
+	}
+	return &Array{Elements: elements}
+}
+
+// builtinContains tells whether an array has an element, a hash has a key
+// or a string has a substring
+func builtinContains(args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2",
+			len(args))
+	}
+
+	switch container := args[0].(type) {
+	case *Array:
+		for _, el := range container.Elements {
+			if Equal(el, args[1]) {
+				return nativeBool(true)
+			}
+		}
+		return nativeBool(false)
+	case *Hash:
+		key, ok := args[1].(Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", args[1].Type())
+		}
+		_, ok = container.Get(key)
+		return nativeBool(ok)
+	case *String:
+		sub, ok := args[1].(*String)
+		if !ok {
+			return newError("second argument to `contains` must be STRING, got %s",
+				args[1].Type())
+		}
+		return nativeBool(strings.Contains(container.Value, sub.Value))
+	default:
+		return newError("first argument to `contains` not supported, got %s",
+			args[0].Type())
+	}
+}
+
+func builtinKeys(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+	hash, ok := args[0].(*Hash)
+	if !ok {
+		return newError("argument to `keys` must be HASH, got %s",
+			args[0].Type())
+	}
+
+	pairs := hash.OrderedPairs()
+	elements := make([]Object, len(pairs))
+	for i, pair := range pairs {
+		elements[i] = pair.Key
+	}
+	return &Array{Elements: elements}
+}
+
+func builtinValues(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+	hash, ok := args[0].(*Hash)
+	if !ok {
+		return newError("argument to `values` must be HASH, got %s",
+			args[0].Type())
+	}
+
+	pairs := hash.OrderedPairs()
+	elements := make([]Object, len(pairs))
+	for i, pair := range pairs {
+		elements[i] = pair.Value
+	}
+	return &Array{Elements: elements}
+}
+
+// builtinDelete returns a copy of a hash without a key
+func builtinDelete(args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2",
+			len(args))
+	}
+	hash, ok := args[0].(*Hash)
+	if !ok {
+		return newError("first argument to `delete` must be HASH, got %s",
+			args[0].Type())
+	}
+	key, ok := args[1].(Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", args[1].Type())
+	}
+
+	result := NewHash(hash.Len())
+	for _, pair := range hash.OrderedPairs() {
+		result.Set(pair.Key.(Hashable), pair.Value)
+	}
+	result.Delete(key)
+	return result
+}
+
+// builtinMerge returns a hash with the pairs of both hashes, the values of
+// the second one winning
+func builtinMerge(args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2",
+			len(args))
+	}
+	left, ok := args[0].(*Hash)
+	if !ok {
+		return newError("first argument to `merge` must be HASH, got %s",
+			args[0].Type())
+	}
+	right, ok := args[1].(*Hash)
+	if !ok {
+		return newError("second argument to `merge` must be HASH, got %s",
+			args[1].Type())
+	}
+
+	result := NewHash(left.Len() + right.Len())
+	for _, pair := range append(left.OrderedPairs(), right.OrderedPairs()...) {
+		result.Set(pair.Key.(Hashable), pair.Value)
+	}
+	return result
+}
+
+// builtinRange returns the integers from start up to but not including
+// end: range(end), range(start, end) or range(start, end, step)
+func builtinRange(args ...Object) Object {
+	start, end, step, err := rangeArgs(args)
+	if err != nil {
+		return err
+	}
+	length := rangeLength(start, end, step)
+	if length > MaxLength {
+		return newError("range of %d integers exceeds the maximum length of %d",
+			length, MaxLength)
+	}
+
+	// counted rather than compared to end, which i may overflow past
+	elements := make([]Object, length)
+	i := start
+	for n := range elements {
+		elements[n] = NewInteger(i)
+		i += step
+	}
+	return &Array{Elements: elements}
+}
+
+func rangeSize(args ...Object) int {
+	start, end, step, err := rangeArgs(args)
+	if err != nil {
+		return 1
+	}
+	// the elements and the array
+	n := rangeLength(start, end, step)
+	if n < uint64(maxInt) {
+		n++
+	}
+	return clampSize(n)
+}
+
+func rangeArgs(args []Object) (start, end, step int64, err *Error) {
+	if len(args) < 1 || len(args) > 3 {
+		return 0, 0, 0, newError("wrong number of arguments. got=%d, want=1 to 3",
+			len(args))
+	}
+
+	bounds := make([]int64, len(args))
+	for i, arg := range args {
+		integer, ok := arg.(*Integer)
+		if !ok {
+			return 0, 0, 0, newError("arguments to `range` must be INTEGER, got %s",
+				arg.Type())
+		}
+		bounds[i] = integer.Value
+	}
+
+	start, end, step = 0, bounds[0], 1
+	if len(bounds) > 1 {
+		start, end = bounds[0], bounds[1]
+	}
+	if len(bounds) > 2 {
+		step = bounds[2]
+	}
+	if step == 0 {
+		return 0, 0, 0, newError("step of `range` must not be 0")
+	}
+	return start, end, step, nil
+}
+
+// rangeLength returns the number of integers from start up to but not
+// including end by step, computed without overflowing
+func rangeLength(start, end, step int64) uint64 {
+	var distance, stride uint64
+	switch {
+	case step > 0 && start < end:
+		distance, stride = uint64(end)-uint64(start), uint64(step)
+	case step < 0 && start > end:
+		distance, stride = uint64(start)-uint64(end), -uint64(step)
+	default:
+		return 0
+	}
+
+	n := distance / stride
+	if distance%stride != 0 {
+		n++
+	}
+	return n
+}
+
+// builtinSlice returns the elements of an array or the bytes of a string
+// from start up to but not including end, which defaults to the length.
+// Negative indexes count from the end and indexes out of range are
+// clamped.
+func builtinSlice(args ...Object) Object {
+	if len(args) != 2 && len(args) != 3 {
+		return newError("wrong number of arguments. got=%d, want=2 or 3",
+			len(args))
+	}
+
+	switch seq := args[0].(type) {
+	case *Array:
+		start, end, err := sliceBounds(len(seq.Elements), args[1:])
+		if err != nil {
+			return err
+		}
+
+		elements := make([]Object, end-start)
+		copy(elements, seq.Elements[start:end])
+		return &Array{Elements: elements}
+	case *String:
+		start, end, err := sliceBounds(len(seq.Value), args[1:])
+		if err != nil {
+			return err
+		}
+		return &String{Value: seq.Value[start:end]}
+	default:
+		return newError("first argument to `slice` not supported, got %s",
+			args[0].Type())
+	}
+}
+
+// sliceBounds converts the bound arguments of a slice of a sequence of
+// length elements into indexes
+func sliceBounds(length int, args []Object) (int, int, *Error) {
+	bounds := []int{0, length}
+	for i, arg := range args {
+		integer, ok := arg.(*Integer)
+		if !ok {
+			return 0, 0, newError("indexes to `slice` must be INTEGER, got %s",
+				arg.Type())
+		}
+
+		index := int(integer.Value)
+		if index < 0 {
+			index += length
+		}
+		if index < 0 {
+			index = 0
+		}
+		if index > length {
+			index = length
+		}
+		bounds[i] = index
+	}
+
+	if bounds[1] < bounds[0] {
+		bounds[1] = bounds[0]
+	}
+	return bounds[0], bounds[1], nil
+}
+
+// builtinJoin concatenates an array of strings, putting a separator
+// between them
+func builtinJoin(args ...Object) Object {
+	parts, sep, err := joinArgs(args)
+	if err != nil {
+		return err
+	}
+	if length := joinLength(parts, sep); length > MaxLength {
+		return newError("joining %d strings makes %d bytes, exceeding the maximum length of %d",
+			len(parts), length, MaxLength)
+	}
+	return &String{Value: strings.Join(parts, sep)}
+}
+
+func joinSize(args ...Object) int {
+	parts, sep, err := joinArgs(args)
+	if err != nil {
+		return 1
+	}
+	// calls failing make nothing but their error
+	length := joinLength(parts, sep)
+	if length > MaxLength {
+		return 1
+	}
+	return StringSize(int(length))
+}
+
+func joinArgs(args []Object) (parts []string, sep string, err *Error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, "", newError("wrong number of arguments. got=%d, want=1 or 2",
+			len(args))
+	}
+	arr, ok := args[0].(*Array)
+	if !ok {
+		return nil, "", newError("first argument to `join` must be ARRAY, got %s",
+			args[0].Type())
+	}
+	if len(args) == 2 {
+		str, ok := args[1].(*String)
+		if !ok {
+			return nil, "", newError("second argument to `join` must be STRING, got %s",
+				args[1].Type())
+		}
+		sep = str.Value
+	}
+
+	parts = make([]string, len(arr.Elements))
+	for i, el := range arr.Elements {
+		str, ok := el.(*String)
+		if !ok {
+			return nil, "", newError("elements to `join` must be STRING, got %s",
+				el.Type())
+		}
+		parts[i] = str.Value
+	}
+	return parts, sep, nil
+}
+
+// joinLength returns the length of parts joined by sep
+func joinLength(parts []string, sep string) uint64 {
+	if len(parts) == 0 {
+		return 0
+	}
+	length := uint64(len(sep)) * uint64(len(parts)-1)
+	for _, part := range parts {
+		length += uint64(len(part))
+	}
+	return length
+}
+
+// builtinZip pairs up the elements of two arrays, stopping at the end of
+// the shorter one
+func builtinZip(args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2",
+			len(args))
+	}
+	left, ok := args[0].(*Array)
+	if !ok {
+		return newError("first argument to `zip` must be ARRAY, got %s",
+			args[0].Type())
+	}
+	right, ok := args[1].(*Array)
+	if !ok {
+		return newError("second argument to `zip` must be ARRAY, got %s",
+			args[1].Type())
+	}
+
+	length := len(left.Elements)
+	if len(right.Elements) < length {
+		length = len(right.Elements)
+	}
+
+	elements := make([]Object, length)
+	for i := range elements {
+		elements[i] = &Array{Elements: []Object{left.Elements[i], right.Elements[i]}}
+	}
+	return &Array{Elements: elements}
+}
@@ -0,0 +1,96 @@
+package object
+
+import (
+	"strconv"
+	"strings"
+)
+
+// builtinType returns the name of the type of its argument
+func builtinType(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+	return &String{Value: string(args[0].Type())}
+}
+
+// builtinStr converts its argument to a string, strings being left as
+// they are
+func builtinStr(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+	if str, ok := args[0].(*String); ok {
+		return str
+	}
+	return &String{Value: args[0].Inspect()}
+}
+
+// builtinInt converts a decimal string or a boolean to an integer
+func builtinInt(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *Integer:
+		return arg
+	case *String:
+		value, err := strconv.ParseInt(strings.TrimSpace(arg.Value), 10, 64)
+		if err != nil {
+			return newError("cannot convert %q to INTEGER", arg.Value)
+		}
+		return NewInteger(value)
+	case *Boolean:
+		if arg.Value {
+			return NewInteger(1)
+		}
+		return NewInteger(0)
+	default:
+		return newError("argument to `int` not supported, got %s",
+			args[0].Type())
+	}
+}
+
+// builtinBool converts its argument to a boolean by truthiness, as if
+// statements do
+func builtinBool(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+	return nativeBool(isTruthy(args[0]))
+}
+
+// builtinInspect returns a representation of its argument for debugging,
+// telling strings apart from other values by quoting them
+func builtinInspect(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+	return &String{Value: inspect(args[0])}
+}
+
+func inspect(obj Object) string {
+	switch obj := obj.(type) {
+	case *String:
+		return strconv.Quote(obj.Value)
+	case *Array:
+		elements := make([]string, len(obj.Elements))
+		for i, el := range obj.Elements {
+			elements[i] = inspect(el)
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case *Hash:
+		pairs := []string{}
+		for _, pair := range obj.OrderedPairs() {
+			pairs = append(pairs, inspect(pair.Key)+": "+inspect(pair.Value))
+		}
+		return "{" + strings.Join(pairs, ", ") + "}"
+	default:
+		return obj.Inspect()
+	}
+}
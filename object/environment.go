@@ -1,5 +1,10 @@
 package object
 
+import (
+	"monkey-compiler/limit"
+	"sort"
+)
+
 func NewEnclosedEnvironment(outer *Environment) *Environment {
 	env := NewEnvironment()
 	env.outer = outer
@@ -14,6 +19,29 @@ func NewEnvironment() *Environment {
 type Environment struct {
 	store map[string]Object
 	outer *Environment
+	meter *limit.Meter
+
+	builtins map[string]*Builtin
+	importer Importer
+
+	importedBy *Environment // main program environment, for module roots
+	calls      []string     // names of the functions being called
+}
+
+// Importer loads the modules imported by code evaluated in an environment
+type Importer interface {
+	// Import returns the exports of the module imported as path by code
+	// evaluated in env, or an error object
+	Import(path string, env *Environment) Object
+}
+
+// NewModuleEnvironment returns an empty outermost environment for a module
+// imported from env. It shares the meter and builtins of env, but not its
+// importer.
+func NewModuleEnvironment(env *Environment) *Environment {
+	module := NewEnvironment()
+	module.importedBy = env.host()
+	return module
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
@@ -28,3 +56,99 @@ func (e *Environment) Set(name string, val Object) Object {
 	e.store[name] = val
 	return val
 }
+
+// Names returns the names bound directly in e, sorted
+func (e *Environment) Names() []string {
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetMeter sets the meter that accounts for evaluations in e and in every
+// environment enclosed by it
+func (e *Environment) SetMeter(m *limit.Meter) {
+	e.meter = m
+}
+
+// Meter returns the meter of the outermost environment of the main
+// program, nil if there is none
+func (e *Environment) Meter() *limit.Meter {
+	if e == nil {
+		return nil
+	}
+	return e.host().meter
+}
+
+// EnterCall records a call of the function called name by the program e
+// belongs to, "" for an anonymous function. LeaveCall records its return.
+func (e *Environment) EnterCall(name string) {
+	host := e.host()
+	host.calls = append(host.calls, name)
+}
+
+func (e *Environment) LeaveCall() {
+	host := e.host()
+	host.calls = host.calls[:len(host.calls)-1]
+}
+
+// CallStack returns the names of the functions being called by the
+// program e belongs to, innermost first
+func (e *Environment) CallStack() []string {
+	calls := e.host().calls
+	stack := make([]string, 0, len(calls))
+	for i := len(calls) - 1; i >= 0; i-- {
+		name := calls[i]
+		if name == "" {
+			name = AnonymousFunction
+		}
+		stack = append(stack, name)
+	}
+	return stack
+}
+
+// SetBuiltins makes builtins, such as those granted by a sandbox, the
+// builtins visible in e and every environment enclosed by it
+func (e *Environment) SetBuiltins(builtins []BuiltinDef) {
+	e.builtins = make(map[string]*Builtin, len(builtins))
+	for _, def := range builtins {
+		e.builtins[def.Name] = def.Builtin
+	}
+}
+
+// Builtins returns the builtins set on the outermost environment of the
+// main program, nil if none were set
+func (e *Environment) Builtins() map[string]*Builtin {
+	return e.host().builtins
+}
+
+// SetImporter sets the importer of the modules imported by code evaluated
+// in e and every environment enclosed by it
+func (e *Environment) SetImporter(i Importer) {
+	e.importer = i
+}
+
+// Importer returns the importer of the outermost environment, nil if there
+// is none
+func (e *Environment) Importer() Importer {
+	return e.root().importer
+}
+
+func (e *Environment) root() *Environment {
+	for e.outer != nil {
+		e = e.outer
+	}
+	return e
+}
+
+// host returns the outermost environment of the program that imported the
+// module e belongs to, directly or not
+func (e *Environment) host() *Environment {
+	root := e.root()
+	if root.importedBy != nil {
+		return root.importedBy
+	}
+	return root
+}
@@ -0,0 +1,20 @@
+package object
+
+// builtinError returns an error with a message as a value, which can be
+// thrown or returned like any other
+func builtinError(args ...Object) Object {
+	values, err := stringArgs("error", 1, args)
+	if err != nil {
+		return err
+	}
+	return &Error{Message: values[0], Held: true}
+}
+
+func builtinIsError(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+	_, ok := args[0].(*Error)
+	return nativeBool(ok)
+}
@@ -0,0 +1,172 @@
+package object
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// JSON numbers are decoded to integers, as Monkey has no other numbers.
+// Objects are decoded to hashes with string keys.
+
+// builtinJSONParse decodes a JSON document
+func builtinJSONParse(args ...Object) Object {
+	values, err := stringArgs("json_parse", 1, args)
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(strings.NewReader(values[0]))
+	dec.UseNumber()
+	result := decodeJSON(dec)
+	if isError(result) {
+		return result
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return newError("json_parse: unexpected data after JSON value")
+	}
+	return result
+}
+
+func decodeJSON(dec *json.Decoder) Object {
+	tok, err := dec.Token()
+	if err != nil {
+		return jsonSyntaxError(err)
+	}
+
+	switch tok := tok.(type) {
+	case json.Delim:
+		if tok == '[' {
+			elements := []Object{}
+			for dec.More() {
+				el := decodeJSON(dec)
+				if isError(el) {
+					return el
+				}
+				elements = append(elements, el)
+			}
+			if _, err := dec.Token(); err != nil {
+				return jsonSyntaxError(err)
+			}
+			return &Array{Elements: elements}
+		}
+
+		hash := NewHash(0)
+		for dec.More() {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return jsonSyntaxError(err)
+			}
+			key := &String{Value: keyTok.(string)}
+			value := decodeJSON(dec)
+			if isError(value) {
+				return value
+			}
+			hash.Set(key, value)
+		}
+		if _, err := dec.Token(); err != nil {
+			return jsonSyntaxError(err)
+		}
+		return hash
+	case json.Number:
+		value, err := tok.Int64()
+		if err != nil {
+			return newError("json_parse: number %s is not a 64-bit integer", tok)
+		}
+		return NewInteger(value)
+	case string:
+		return &String{Value: tok}
+	case bool:
+		return nativeBool(tok)
+	default:
+		return NULL
+	}
+}
+
+func jsonSyntaxError(err error) *Error {
+	if err == io.EOF {
+		return newError("json_parse: unexpected end of JSON input")
+	}
+	return newError("json_parse: %s", err)
+}
+
+// builtinJSONStringify encodes a value as JSON, indenting it when the
+// second argument is true. Hash keys are written in insertion order.
+func builtinJSONStringify(args ...Object) Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2",
+			len(args))
+	}
+	pretty := false
+	if len(args) == 2 {
+		flag, ok := args[1].(*Boolean)
+		if !ok {
+			return newError("second argument to `json_stringify` must be BOOLEAN, got %s",
+				args[1].Type())
+		}
+		pretty = flag.Value
+	}
+
+	var out bytes.Buffer
+	if err := encodeJSON(&out, args[0]); err != nil {
+		return err
+	}
+	if pretty {
+		var indented bytes.Buffer
+		json.Indent(&indented, out.Bytes(), "", "  ")
+		return &String{Value: indented.String()}
+	}
+	return &String{Value: out.String()}
+}
+
+func encodeJSON(out *bytes.Buffer, obj Object) *Error {
+	switch obj := obj.(type) {
+	case *Integer, *Boolean:
+		out.WriteString(obj.Inspect())
+	case *Null:
+		out.WriteString("null")
+	case *String:
+		encodeJSONString(out, obj.Value)
+	case *Array:
+		out.WriteByte('[')
+		for i, el := range obj.Elements {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			if err := encodeJSON(out, el); err != nil {
+				return err
+			}
+		}
+		out.WriteByte(']')
+	case *Hash:
+		out.WriteByte('{')
+		for i, pair := range obj.OrderedPairs() {
+			key, ok := pair.Key.(*String)
+			if !ok {
+				return newError("json_stringify: keys must be STRING, got %s",
+					pair.Key.Type())
+			}
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			encodeJSONString(out, key.Value)
+			out.WriteByte(':')
+			if err := encodeJSON(out, pair.Value); err != nil {
+				return err
+			}
+		}
+		out.WriteByte('}')
+	default:
+		return newError("json_stringify: cannot encode %s", obj.Type())
+	}
+	return nil
+}
+
+func encodeJSONString(out *bytes.Buffer, s string) {
+	enc := json.NewEncoder(out)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	// Encode ends the value with a newline
+	out.Truncate(out.Len() - 1)
+}
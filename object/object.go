@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"hash/fnv"
 	"monkey-compiler/ast"
+	"monkey-compiler/code"
 	"strings"
 )
 
@@ -27,6 +28,13 @@ const (
 
 	ARRAY_OBJ = "ARRAY"
 	HASH_OBJ  = "HASH"
+
+	QUOTE_OBJ = "QUOTE"
+	MACRO_OBJ = "MACRO"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+	CLOSURE_OBJ           = "CLOSURE"
+	MODULE_OBJ            = "MODULE"
 )
 
 type HashKey struct {
@@ -35,6 +43,7 @@ type HashKey struct {
 }
 
 type Hashable interface {
+	Object
 	HashKey() HashKey
 }
 
@@ -53,12 +62,52 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+// Integers from minSmallInteger to maxSmallInteger are made once and shared,
+// as integers are never modified
+const (
+	minSmallInteger = -128
+	maxSmallInteger = 1024
+)
+
+var smallIntegers = func() []*Integer {
+	integers := make([]*Integer, maxSmallInteger-minSmallInteger+1)
+	for i := range integers {
+		integers[i] = &Integer{Value: int64(i + minSmallInteger)}
+	}
+	return integers
+}()
+
+// NewInteger returns an integer of value, which is only allocated if it is
+// not a small one
+func NewInteger(value int64) *Integer {
+	if value >= minSmallInteger && value <= maxSmallInteger {
+		return smallIntegers[value-minSmallInteger]
+	}
+	return &Integer{Value: value}
+}
+
 type Boolean struct {
 	Value bool
 }
 
 func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
 func (b *Boolean) Inspect() string  { return fmt.Sprintf("%t", b.Value) }
+
+// True and False are the only booleans the evaluator and the VM create, so
+// that booleans can be compared by identity. NULL is likewise the only
+// null.
+var (
+	True  = &Boolean{Value: true}
+	False = &Boolean{Value: false}
+	NULL  = &Null{}
+)
+
+func nativeBool(b bool) *Boolean {
+	if b {
+		return True
+	}
+	return False
+}
 func (b *Boolean) HashKey() HashKey {
 	var value uint64
 
@@ -85,15 +134,70 @@ func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
 type Error struct {
 	Message string
+	// Stack lists the functions being called when the error was raised,
+	// innermost first. It is nil until the error is first caught or leaves
+	// a function.
+	Stack []string
+	// Held marks an error held as an ordinary value, such as a caught one,
+	// rather than being raised. The evaluator only unwinds errors that are
+	// not held.
+	Held bool
+	// Line and Column locate the node raising the error, 0 when unknown
+	Line   int
+	Column int
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
 func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
 
+// Field returns the field of e read by indexing it with name: "message",
+// "stack", "line" or "column". The position is null when unknown.
+func (e *Error) Field(name string) (Object, bool) {
+	switch name {
+	case "message":
+		return &String{Value: e.Message}, true
+	case "stack":
+		return stringArray(e.Stack), true
+	case "line", "column":
+		if e.Line == 0 {
+			return NULL, true
+		}
+		if name == "line" {
+			return NewInteger(int64(e.Line)), true
+		}
+		return NewInteger(int64(e.Column)), true
+	}
+	return nil, false
+}
+
+// AnonymousFunction is the name of functions not bound by a let statement
+// in error stacks
+const AnonymousFunction = "<anonymous>"
+
+// Thrown returns the error raised by throwing value: errors are raised
+// again with their stack and position, and anything else becomes the
+// message of a new error
+func Thrown(value Object) *Error {
+	switch value := value.(type) {
+	case *Error:
+		return &Error{
+			Message: value.Message,
+			Stack:   value.Stack,
+			Line:    value.Line,
+			Column:  value.Column,
+		}
+	case *String:
+		return &Error{Message: value.Value}
+	default:
+		return &Error{Message: value.Inspect()}
+	}
+}
+
 type Function struct {
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
+	Name       string // name the function is bound to by a let statement
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
@@ -115,21 +219,41 @@ func (f *Function) Inspect() string {
 	return out.String()
 }
 
+// String is an immutable string. Value must not change once the string is
+// used as a hash key, as its hash is computed only once.
 type String struct {
 	Value string
+
+	hash uint64 // FNV-1a hash of Value, 0 until computed
 }
 
 func (s *String) Type() ObjectType { return STRING_OBJ }
 func (s *String) Inspect() string  { return s.Value }
 func (s *String) HashKey() HashKey {
-	h := fnv.New64a()
-	_, _ = h.Write([]byte(s.Value))
+	if s.hash == 0 {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(s.Value))
+		s.hash = h.Sum64()
+	}
 
-	return HashKey{Type: s.Type(), Value: h.Sum64()}
+	return HashKey{Type: s.Type(), Value: s.hash}
 }
 
+// CallFunction calls a Monkey function on behalf of a builtin, returning
+// its result or an error object
+type CallFunction func(fn Object, args ...Object) Object
+
+// HigherOrderFunction is a builtin calling Monkey functions through call
+type HigherOrderFunction func(call CallFunction, args ...Object) Object
+
 type Builtin struct {
 	Fn BuiltinFunction
+	// HigherOrder replaces Fn for builtins taking functions as arguments
+	HigherOrder HigherOrderFunction
+	// Size, if set, returns the number of objects a call with args
+	// allocates, for engines to account for before making the call.
+	// Otherwise they account for the Size of the result once it returns.
+	Size func(args ...Object) int
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
@@ -160,8 +284,89 @@ type HashPair struct {
 	Value Object
 }
 
+// Hash maps hashable keys to values, remembering the order in which keys
+// were first set. Pairs are bucketed by HashKey and keys within a bucket are
+// compared with Equal, so keys whose hashes collide do not overwrite each
+// other.
 type Hash struct {
-	Pairs map[HashKey]HashPair
+	buckets map[HashKey][]int // indexes into pairs by hash key
+	pairs   []HashPair        // in insertion order
+}
+
+// NewHash returns an empty hash with room for size pairs
+func NewHash(size int) *Hash {
+	return &Hash{
+		buckets: make(map[HashKey][]int, size),
+		pairs:   make([]HashPair, 0, size),
+	}
+}
+
+// Set binds key to value. A key that is already set keeps its position.
+func (h *Hash) Set(key Hashable, value Object) {
+	hashKey := key.HashKey()
+	if i, ok := h.index(hashKey, key); ok {
+		h.pairs[i].Value = value
+		return
+	}
+	h.buckets[hashKey] = append(h.buckets[hashKey], len(h.pairs))
+	h.pairs = append(h.pairs, HashPair{Key: key, Value: value})
+}
+
+// Get returns the value bound to key
+func (h *Hash) Get(key Hashable) (Object, bool) {
+	i, ok := h.index(key.HashKey(), key)
+	if !ok {
+		return nil, false
+	}
+	return h.pairs[i].Value, true
+}
+
+// Delete unbinds key, reporting whether it was set. The other pairs keep
+// their order.
+func (h *Hash) Delete(key Hashable) bool {
+	i, ok := h.index(key.HashKey(), key)
+	if !ok {
+		return false
+	}
+
+	h.pairs = append(h.pairs[:i], h.pairs[i+1:]...)
+	// the pairs after the deleted one moved down
+	for hashKey, bucket := range h.buckets {
+		kept := bucket[:0]
+		for _, j := range bucket {
+			switch {
+			case j < i:
+				kept = append(kept, j)
+			case j > i:
+				kept = append(kept, j-1)
+			}
+		}
+		if len(kept) == 0 {
+			delete(h.buckets, hashKey)
+		} else {
+			h.buckets[hashKey] = kept
+		}
+	}
+	return true
+}
+
+func (h *Hash) index(hashKey HashKey, key Object) (int, bool) {
+	for _, i := range h.buckets[hashKey] {
+		if Equal(h.pairs[i].Key, key) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// Len returns the number of pairs of h
+func (h *Hash) Len() int { return len(h.pairs) }
+
+// OrderedPairs returns the pairs of h in insertion order
+func (h *Hash) OrderedPairs() []HashPair {
+	pairs := make([]HashPair, len(h.pairs))
+	copy(pairs, h.pairs)
+	return pairs
 }
 
 func (h *Hash) Type() ObjectType { return HASH_OBJ }
@@ -169,7 +374,7 @@ func (h *Hash) Inspect() string {
 	var out bytes.Buffer
 
 	pairs := make([]string, 0)
-	for _, pair := range h.Pairs {
+	for _, pair := range h.OrderedPairs() {
 		pairs = append(pairs, fmt.Sprintf("%s: %s",
 			pair.Key.Inspect(), pair.Value.Inspect()))
 	}
@@ -180,3 +385,129 @@ func (h *Hash) Inspect() string {
 
 	return out.String()
 }
+
+type Quote struct {
+	Node ast.Node
+}
+
+func (q *Quote) Type() ObjectType { return QUOTE_OBJ }
+func (q *Quote) Inspect() string {
+	return "QUOTE(" + q.Node.String() + ")"
+}
+
+type Macro struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+func (m *Macro) Type() ObjectType { return MACRO_OBJ }
+func (m *Macro) Inspect() string {
+	var out bytes.Buffer
+
+	params := make([]string, 0)
+	for _, p := range m.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString("macro")
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	out.WriteString(m.Body.String())
+	out.WriteString("\n}")
+
+	return out.String()
+}
+
+// CompiledFunction is a function literal compiled to bytecode
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	Positions     code.Positions // source positions of the instructions
+	NumLocals     int
+	NumParameters int
+	Name          string // name the function is bound to by a let statement
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// Closure is a compiled function together with the free variables it
+// captured when it was created
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+	// Globals are the globals of the module the closure was created in,
+	// nil for the main program, whose globals are those of the VM running
+	// the closure
+	Globals []Object
+}
+
+func (c *Closure) Type() ObjectType { return CLOSURE_OBJ }
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
+}
+
+// Module is a compiled module. Running Fn in a fresh set of NumGlobals
+// globals returns the hash of the module's exports.
+type Module struct {
+	Name       string
+	Fn         *CompiledFunction
+	NumGlobals int
+}
+
+func (m *Module) Type() ObjectType { return MODULE_OBJ }
+func (m *Module) Inspect() string {
+	return fmt.Sprintf("Module[%s]", m.Name)
+}
+
+// Equal tells whether two objects are equal: integers, strings and
+// booleans by value, arrays element by element and anything else by
+// identity
+func Equal(a, b Object) bool {
+	switch a := a.(type) {
+	case *Integer:
+		b, ok := b.(*Integer)
+		return ok && a.Value == b.Value
+	case *String:
+		b, ok := b.(*String)
+		return ok && a.Value == b.Value
+	case *Boolean:
+		b, ok := b.(*Boolean)
+		return ok && a.Value == b.Value
+	case *Null:
+		_, ok := b.(*Null)
+		return ok
+	case *Array:
+		b, ok := b.(*Array)
+		if !ok || len(a.Elements) != len(b.Elements) {
+			return false
+		}
+		for i := range a.Elements {
+			if !Equal(a.Elements[i], b.Elements[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a == b
+	}
+}
+
+func isTruthy(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Boolean:
+		return obj.Value
+	case *Null:
+		return false
+	default:
+		return true
+	}
+}
+
+func isError(obj Object) bool {
+	err, ok := obj.(*Error)
+	return ok && !err.Held
+}
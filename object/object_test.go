@@ -1,6 +1,10 @@
 package object
 
-import "testing"
+import (
+	"math"
+	"strings"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -58,3 +62,225 @@ func TestIntegerHashKey(t *testing.T) {
 		t.Errorf("integers with twoerent content have same hash keys")
 	}
 }
+
+func TestNewInteger(t *testing.T) {
+	for _, value := range []int64{minSmallInteger, -1, 0, 1, maxSmallInteger} {
+		if NewInteger(value) != NewInteger(value) {
+			t.Errorf("small integer %d not shared", value)
+		}
+	}
+	for _, value := range []int64{minSmallInteger - 1, maxSmallInteger + 1} {
+		if NewInteger(value) == NewInteger(value) {
+			t.Errorf("integer %d shared", value)
+		}
+	}
+	for _, value := range []int64{minSmallInteger - 1, minSmallInteger, 42, maxSmallInteger, maxSmallInteger + 1} {
+		if actual := NewInteger(value).Value; actual != value {
+			t.Errorf("NewInteger(%d) has value %d", value, actual)
+		}
+	}
+}
+
+func TestHashOrder(t *testing.T) {
+	hash := NewHash(0)
+	for _, key := range []string{"c", "a", "b", "a"} {
+		hash.Set(&String{Value: key}, &String{Value: key + key})
+	}
+
+	if hash.Len() != 3 {
+		t.Fatalf("hash has wrong length. got=%d", hash.Len())
+	}
+	if actual := hash.Inspect(); actual != "{c: cc, a: aa, b: bb}" {
+		t.Errorf("pairs are not in insertion order. got=%s", actual)
+	}
+
+	value, ok := hash.Get(&String{Value: "a"})
+	if !ok || value.Inspect() != "aa" {
+		t.Errorf("wrong value for key a. got=%v", value)
+	}
+	if _, ok := hash.Get(&Integer{Value: 1}); ok {
+		t.Errorf("unset key should not be found")
+	}
+}
+
+func TestHashCollisions(t *testing.T) {
+	// strings whose hashes were already computed to collide
+	a := &String{Value: "a", hash: 42}
+	b := &String{Value: "b", hash: 42}
+	if a.HashKey() != b.HashKey() {
+		t.Fatalf("hash keys should collide")
+	}
+
+	hash := NewHash(0)
+	hash.Set(a, &Integer{Value: 1})
+	hash.Set(b, &Integer{Value: 2})
+	hash.Set(&String{Value: "a", hash: 42}, &Integer{Value: 3})
+
+	if hash.Len() != 2 {
+		t.Fatalf("colliding keys should not overwrite each other. got=%s", hash.Inspect())
+	}
+	for key, expected := range map[*String]string{a: "3", b: "2"} {
+		value, ok := hash.Get(key)
+		if !ok || value.Inspect() != expected {
+			t.Errorf("wrong value for key %s. want=%s, got=%v", key.Value, expected, value)
+		}
+	}
+	if _, ok := hash.Get(&String{Value: "c", hash: 42}); ok {
+		t.Errorf("key with colliding hash should not be found")
+	}
+}
+
+func TestHashDelete(t *testing.T) {
+	// strings whose hashes were already computed to collide
+	a := &String{Value: "a", hash: 42}
+	b := &String{Value: "b", hash: 42}
+	c := &String{Value: "c"}
+
+	hash := NewHash(0)
+	hash.Set(a, &Integer{Value: 1})
+	hash.Set(c, &Integer{Value: 2})
+	hash.Set(b, &Integer{Value: 3})
+
+	if hash.Delete(&String{Value: "d", hash: 42}) {
+		t.Errorf("deleted a key that was not set")
+	}
+	if !hash.Delete(a) {
+		t.Fatalf("key a was not deleted")
+	}
+	if hash.Inspect() != "{c: 2, b: 3}" {
+		t.Errorf("deleting a removed other keys. got=%s", hash.Inspect())
+	}
+	if _, ok := hash.Get(a); ok {
+		t.Errorf("deleted key should not be found")
+	}
+	for key, expected := range map[*String]string{b: "3", c: "2"} {
+		value, ok := hash.Get(key)
+		if !ok || value.Inspect() != expected {
+			t.Errorf("wrong value for key %s. want=%s, got=%v", key.Value, expected, value)
+		}
+	}
+}
+
+func TestBuiltinDeleteCollisions(t *testing.T) {
+	a := &String{Value: "a", hash: 42}
+	b := &String{Value: "b", hash: 42}
+
+	hash := NewHash(0)
+	hash.Set(a, &Integer{Value: 1})
+	hash.Set(b, &Integer{Value: 2})
+
+	result := builtinDelete(hash, a)
+	if result.Inspect() != "{b: 2}" {
+		t.Errorf("delete removed a colliding key. got=%s", result.Inspect())
+	}
+	if hash.Len() != 2 {
+		t.Errorf("delete changed its argument. got=%s", hash.Inspect())
+	}
+}
+
+func TestStringHashKeyCached(t *testing.T) {
+	str := &String{Value: "Hello World"}
+	key := str.HashKey()
+	if str.hash != key.Value {
+		t.Fatalf("hash was not cached")
+	}
+	if str.HashKey() != key {
+		t.Errorf("cached hash key differs")
+	}
+}
+
+func TestSize(t *testing.T) {
+	tests := []struct {
+		obj      Object
+		expected int
+	}{
+		{NewInteger(1), 1},
+		{&String{Value: "short"}, 1},
+		{&String{Value: strings.Repeat("a", 100)}, 7},
+		{&Array{Elements: []Object{NewInteger(1), &Array{Elements: []Object{NewInteger(2)}}}}, 3},
+		{NewHash(0), 1},
+	}
+
+	for _, tt := range tests {
+		if size := Size(tt.obj); size != tt.expected {
+			t.Errorf("wrong size of %s. want=%d, got=%d", tt.obj.Inspect(), tt.expected, size)
+		}
+	}
+}
+
+func TestRangeSize(t *testing.T) {
+	tests := []struct {
+		args     []Object
+		expected int
+	}{
+		{[]Object{NewInteger(10)}, 11},
+		{[]Object{NewInteger(10), NewInteger(0)}, 1},
+		{[]Object{NewInteger(0), NewInteger(10), NewInteger(3)}, 5},
+		{[]Object{NewInteger(10), NewInteger(0), NewInteger(-3)}, 5},
+		{[]Object{NewInteger(math.MinInt64), NewInteger(math.MaxInt64)}, maxInt},
+		{[]Object{NewInteger(math.MaxInt64), NewInteger(math.MinInt64), NewInteger(math.MinInt64)}, 3},
+		{[]Object{&String{Value: "x"}}, 1},
+	}
+
+	for _, tt := range tests {
+		if size := rangeSize(tt.args...); size != tt.expected {
+			t.Errorf("wrong size of range%v. want=%d, got=%d", tt.args, tt.expected, size)
+		}
+	}
+}
+
+func TestRepeatSize(t *testing.T) {
+	tests := []struct {
+		args     []Object
+		expected int
+	}{
+		{[]Object{&String{Value: "ab"}, NewInteger(3)}, 1},
+		{[]Object{&String{Value: "ab"}, NewInteger(80)}, 11},
+		{[]Object{&String{Value: "ab"}, NewInteger(math.MaxInt64)}, 1},
+		{[]Object{&String{Value: "ab"}, NewInteger(-1)}, 1},
+	}
+
+	for _, tt := range tests {
+		if size := repeatSize(tt.args...); size != tt.expected {
+			t.Errorf("wrong size of repeat%v. want=%d, got=%d", tt.args, tt.expected, size)
+		}
+	}
+}
+
+func TestReplaceSize(t *testing.T) {
+	tests := []struct {
+		args     []Object
+		expected int
+	}{
+		{[]Object{&String{Value: "abab"}, &String{Value: "b"}, &String{Value: "c"}}, 1},
+		{[]Object{&String{Value: "abab"}, &String{Value: ""}, &String{Value: "0123456789"}}, 4},
+		{[]Object{&String{Value: "abab"}, &String{Value: "ab"}, &String{Value: ""}}, 1},
+		{[]Object{&String{Value: "abab"}, NewInteger(1), &String{Value: ""}}, 1},
+	}
+
+	for _, tt := range tests {
+		if size := replaceSize(tt.args...); size != tt.expected {
+			t.Errorf("wrong size of replace%v. want=%d, got=%d", tt.args, tt.expected, size)
+		}
+	}
+}
+
+func TestJoinSize(t *testing.T) {
+	long := &String{Value: strings.Repeat("a", 16)}
+
+	tests := []struct {
+		args     []Object
+		expected int
+	}{
+		{[]Object{&Array{Elements: []Object{long, long}}}, 3},
+		{[]Object{&Array{Elements: []Object{long, long}}, &String{Value: strings.Repeat("-", 16)}}, 4},
+		{[]Object{&Array{Elements: []Object{}}}, 1},
+		{[]Object{&Array{Elements: []Object{long, NewInteger(1)}}}, 1},
+	}
+
+	for _, tt := range tests {
+		if size := joinSize(tt.args...); size != tt.expected {
+			t.Errorf("wrong size of join%v. want=%d, got=%d", tt.args, tt.expected, size)
+		}
+	}
+}
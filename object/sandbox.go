@@ -0,0 +1,182 @@
+package object
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Builtin modules a sandbox may grant
+const (
+	ModuleStdout = "stdout" // puts
+	ModuleFS     = "fs"     // read_file, write_file
+	ModuleTime   = "time"   // now
+	ModuleEnv    = "env"    // getenv
+)
+
+// Modules are the names of all builtin modules
+var Modules = []string{ModuleStdout, ModuleFS, ModuleTime, ModuleEnv}
+
+// DefaultSandbox grants output to os.Stdout and nothing else
+var DefaultSandbox = &Sandbox{Modules: []string{ModuleStdout}}
+
+// Sandbox decides which side-effecting builtins a script gets. Builtins
+// without side effects are always granted.
+type Sandbox struct {
+	// Modules are the names of the granted modules
+	Modules []string
+	// Stdout receives the output of the stdout module, os.Stdout if nil
+	Stdout io.Writer
+	// Dir confines the fs module, the working directory if empty. Paths are
+	// resolved inside it, so scripts cannot reach files outside.
+	Dir string
+}
+
+// Builtins returns the builtins granted by s. A compiler and a VM running
+// its code must be given the builtins of the same sandbox.
+func (s *Sandbox) Builtins() []BuiltinDef {
+	defs := []BuiltinDef{}
+	for _, entry := range catalog {
+		if entry.module == "" || s.grants(entry.module) {
+			defs = append(defs, BuiltinDef{Name: entry.name, Builtin: entry.new(s)})
+		}
+	}
+	return defs
+}
+
+func (s *Sandbox) grants(module string) bool {
+	for _, m := range s.Modules {
+		if m == module {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Sandbox) stdout() io.Writer {
+	if s.Stdout == nil {
+		return os.Stdout
+	}
+	return s.Stdout
+}
+
+// path resolves name inside s.Dir. Cleaning name as an absolute path first
+// drops any ".." leading out of the directory.
+func (s *Sandbox) path(name string) string {
+	dir := s.Dir
+	if dir == "" {
+		dir = "."
+	}
+	return filepath.Join(dir, filepath.Clean("/"+name))
+}
+
+// BuiltinModule returns the module granting the builtin called name, ""
+// for builtins granted by every sandbox. ok is false if there is no such
+// builtin.
+func BuiltinModule(name string) (module string, ok bool) {
+	for _, entry := range catalog {
+		if entry.name == name {
+			return entry.module, true
+		}
+	}
+	return "", false
+}
+
+func newPuts(s *Sandbox) *Builtin {
+	return &Builtin{
+		Fn: func(args ...Object) Object {
+			out := s.stdout()
+			for _, arg := range args {
+				fmt.Fprintln(out, arg.Inspect())
+			}
+
+			return nil
+		},
+	}
+}
+
+func newReadFile(s *Sandbox) *Builtin {
+	return &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			name, ok := args[0].(*String)
+			if !ok {
+				return newError("argument to `read_file` must be STRING, got %s",
+					args[0].Type())
+			}
+
+			content, err := ioutil.ReadFile(s.path(name.Value))
+			if err != nil {
+				return newError("read_file: cannot read %s", name.Value)
+			}
+			return &String{Value: string(content)}
+		},
+	}
+}
+
+func newWriteFile(s *Sandbox) *Builtin {
+	return &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+			name, ok := args[0].(*String)
+			if !ok {
+				return newError("first argument to `write_file` must be STRING, got %s",
+					args[0].Type())
+			}
+			content, ok := args[1].(*String)
+			if !ok {
+				return newError("second argument to `write_file` must be STRING, got %s",
+					args[1].Type())
+			}
+
+			if err := ioutil.WriteFile(s.path(name.Value), []byte(content.Value), 0644); err != nil {
+				return newError("write_file: cannot write %s", name.Value)
+			}
+			return nil
+		},
+	}
+}
+
+func newNow(s *Sandbox) *Builtin {
+	return &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 0 {
+				return newError("wrong number of arguments. got=%d, want=0",
+					len(args))
+			}
+			// milliseconds since the Unix epoch
+			return NewInteger(time.Now().UnixNano() / int64(time.Millisecond))
+		},
+	}
+}
+
+func newGetenv(s *Sandbox) *Builtin {
+	return &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			name, ok := args[0].(*String)
+			if !ok {
+				return newError("argument to `getenv` must be STRING, got %s",
+					args[0].Type())
+			}
+
+			value, ok := os.LookupEnv(name.Value)
+			if !ok {
+				return nil
+			}
+			return &String{Value: value}
+		},
+	}
+}
@@ -0,0 +1,131 @@
+package object
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSandboxBuiltins(t *testing.T) {
+	tests := []struct {
+		modules  []string
+		expected []string // granted builtins with side effects
+	}{
+		{nil, []string{}},
+		{[]string{ModuleStdout}, []string{"puts"}},
+		{[]string{ModuleEnv, ModuleTime}, []string{"now", "getenv"}},
+		{Modules, []string{"puts", "read_file", "write_file", "now", "getenv"}},
+	}
+
+	for _, tt := range tests {
+		builtins := (&Sandbox{Modules: tt.modules}).Builtins()
+		if builtins[0].Name != "len" {
+			t.Errorf("builtins for %v do not start with len. got=%s", tt.modules, builtins[0].Name)
+		}
+
+		names := []string{}
+		for _, def := range builtins {
+			if module, _ := BuiltinModule(def.Name); module != "" {
+				names = append(names, def.Name)
+			}
+		}
+		if !reflect.DeepEqual(names, tt.expected) {
+			t.Errorf("wrong builtins for %v. want=%v, got=%v", tt.modules, tt.expected, names)
+		}
+	}
+}
+
+func TestSandboxStdout(t *testing.T) {
+	var out bytes.Buffer
+	puts := sandboxBuiltin(t, &Sandbox{Modules: []string{ModuleStdout}, Stdout: &out}, "puts")
+
+	puts.Fn(&String{Value: "hello"}, &Integer{Value: 1})
+
+	if out.String() != "hello\n1\n" {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+}
+
+func TestSandboxFS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sandbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sandbox := &Sandbox{Modules: []string{ModuleFS}, Dir: dir}
+	writeFile := sandboxBuiltin(t, sandbox, "write_file")
+	readFile := sandboxBuiltin(t, sandbox, "read_file")
+
+	// ".." cannot leave the directory
+	if result := writeFile.Fn(&String{Value: "../escaped.txt"}, &String{Value: "data"}); result != nil {
+		t.Fatalf("write_file returned %s", result.Inspect())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escaped.txt")); err != nil {
+		t.Errorf("file not written inside the sandbox: %s", err)
+	}
+
+	result := readFile.Fn(&String{Value: "/escaped.txt"})
+	str, ok := result.(*String)
+	if !ok || str.Value != "data" {
+		t.Errorf("wrong read_file result. got=%s", result.Inspect())
+	}
+
+	result = readFile.Fn(&String{Value: "missing.txt"})
+	if err, ok := result.(*Error); !ok || err.Message != "read_file: cannot read missing.txt" {
+		t.Errorf("wrong read_file error. got=%s", result.Inspect())
+	}
+}
+
+func TestSandboxEnv(t *testing.T) {
+	os.Setenv("MONKEY_SANDBOX_TEST", "banana")
+	defer os.Unsetenv("MONKEY_SANDBOX_TEST")
+
+	getenv := sandboxBuiltin(t, &Sandbox{Modules: []string{ModuleEnv}}, "getenv")
+
+	result := getenv.Fn(&String{Value: "MONKEY_SANDBOX_TEST"})
+	if str, ok := result.(*String); !ok || str.Value != "banana" {
+		t.Errorf("wrong getenv result. got=%v", result)
+	}
+	if result := getenv.Fn(&String{Value: "MONKEY_SANDBOX_UNSET"}); result != nil {
+		t.Errorf("expected nil for unset variable. got=%s", result.Inspect())
+	}
+}
+
+func TestBuiltinModule(t *testing.T) {
+	tests := []struct {
+		name   string
+		module string
+		ok     bool
+	}{
+		{"len", "", true},
+		{"puts", ModuleStdout, true},
+		{"read_file", ModuleFS, true},
+		{"now", ModuleTime, true},
+		{"getenv", ModuleEnv, true},
+		{"nope", "", false},
+	}
+
+	for _, tt := range tests {
+		module, ok := BuiltinModule(tt.name)
+		if module != tt.module || ok != tt.ok {
+			t.Errorf("BuiltinModule(%q) wrong. want=(%q, %t), got=(%q, %t)",
+				tt.name, tt.module, tt.ok, module, ok)
+		}
+	}
+}
+
+func sandboxBuiltin(t *testing.T, s *Sandbox, name string) *Builtin {
+	t.Helper()
+
+	for _, def := range s.Builtins() {
+		if def.Name == name {
+			return def.Builtin
+		}
+	}
+	t.Fatalf("builtin %s not granted", name)
+	return nil
+}
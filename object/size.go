@@ -0,0 +1,44 @@
+package object
+
+// bytesPerObject is the number of bytes of a string that count as one
+// object against limits
+const bytesPerObject = 16
+
+// MaxLength bounds the number of elements of arrays and bytes of strings
+// made by builtins whose result size is set by an argument, such as range
+// and repeat, so that a single call cannot exhaust memory
+const MaxLength = 1 << 22
+
+// maxInt is the largest int, which sizes too large to count are clamped to
+const maxInt = int(^uint(0) >> 1)
+
+// Size returns the number of objects obj counts as against limits: one
+// for the object itself, plus one for each element of an array, pair of a
+// hash, or bytesPerObject bytes of a string. Elements are not counted
+// recursively, as they are accounted for when they are made.
+func Size(obj Object) int {
+	switch obj := obj.(type) {
+	case *Array:
+		return 1 + len(obj.Elements)
+	case *Hash:
+		return 1 + obj.Len()
+	case *String:
+		return StringSize(len(obj.Value))
+	default:
+		return 1
+	}
+}
+
+// StringSize returns the number of objects a string of n bytes counts as
+// against limits
+func StringSize(n int) int {
+	return 1 + n/bytesPerObject
+}
+
+// clampSize converts a size computed without overflow to an int
+func clampSize(n uint64) int {
+	if n > uint64(maxInt) {
+		return maxInt
+	}
+	return int(n)
+}
@@ -0,0 +1,298 @@
+package object
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// String builtins index strings by byte, like len does
+
+// stringArgs checks that args are count strings and returns their values
+func stringArgs(name string, count int, args []Object) ([]string, *Error) {
+	if len(args) != count {
+		return nil, newError("wrong number of arguments. got=%d, want=%d",
+			len(args), count)
+	}
+
+	values := make([]string, count)
+	for i, arg := range args {
+		str, ok := arg.(*String)
+		if !ok {
+			return nil, newError("arguments to `%s` must be STRING, got %s",
+				name, arg.Type())
+		}
+		values[i] = str.Value
+	}
+	return values, nil
+}
+
+// builtinSplit splits a string around a separator, or around runs of
+// white space without one
+func builtinSplit(args ...Object) Object {
+	if len(args) == 1 {
+		values, err := stringArgs("split", 1, args)
+		if err != nil {
+			return err
+		}
+		return stringArray(strings.Fields(values[0]))
+	}
+
+	values, err := stringArgs("split", 2, args)
+	if err != nil {
+		return err
+	}
+	return stringArray(strings.Split(values[0], values[1]))
+}
+
+// builtinIndexOf returns the index of the first occurrence of a substring
+// in a string or of an element in an array, -1 if there is none
+func builtinIndexOf(args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2",
+			len(args))
+	}
+
+	switch container := args[0].(type) {
+	case *String:
+		sub, ok := args[1].(*String)
+		if !ok {
+			return newError("second argument to `index_of` must be STRING, got %s",
+				args[1].Type())
+		}
+		return NewInteger(int64(strings.Index(container.Value, sub.Value)))
+	case *Array:
+		for i, el := range container.Elements {
+			if Equal(el, args[1]) {
+				return NewInteger(int64(i))
+			}
+		}
+		return NewInteger(-1)
+	default:
+		return newError("first argument to `index_of` not supported, got %s",
+			args[0].Type())
+	}
+}
+
+func builtinStartsWith(args ...Object) Object {
+	values, err := stringArgs("starts_with", 2, args)
+	if err != nil {
+		return err
+	}
+	return nativeBool(strings.HasPrefix(values[0], values[1]))
+}
+
+func builtinEndsWith(args ...Object) Object {
+	values, err := stringArgs("ends_with", 2, args)
+	if err != nil {
+		return err
+	}
+	return nativeBool(strings.HasSuffix(values[0], values[1]))
+}
+
+func builtinUpper(args ...Object) Object {
+	values, err := stringArgs("upper", 1, args)
+	if err != nil {
+		return err
+	}
+	return &String{Value: strings.ToUpper(values[0])}
+}
+
+func builtinLower(args ...Object) Object {
+	values, err := stringArgs("lower", 1, args)
+	if err != nil {
+		return err
+	}
+	return &String{Value: strings.ToLower(values[0])}
+}
+
+// builtinTrim removes leading and trailing white space
+func builtinTrim(args ...Object) Object {
+	values, err := stringArgs("trim", 1, args)
+	if err != nil {
+		return err
+	}
+	return &String{Value: strings.TrimSpace(values[0])}
+}
+
+// builtinReplace replaces every occurrence of a substring
+func builtinReplace(args ...Object) Object {
+	values, err := stringArgs("replace", 3, args)
+	if err != nil {
+		return err
+	}
+	if length := replaceLength(values[0], values[1], values[2]); length > MaxLength {
+		return newError("replacing in %d bytes makes %d bytes, exceeding the maximum length of %d",
+			len(values[0]), length, MaxLength)
+	}
+	return &String{Value: strings.Replace(values[0], values[1], values[2], -1)}
+}
+
+func replaceSize(args ...Object) int {
+	values, err := stringArgs("replace", 3, args)
+	if err != nil {
+		return 1
+	}
+	// calls failing make nothing but their error
+	length := replaceLength(values[0], values[1], values[2])
+	if length > MaxLength {
+		return 1
+	}
+	return StringSize(int(length))
+}
+
+// replaceLength returns the length of s with every old replaced by new. An
+// empty old matches around every character, as with strings.Replace.
+func replaceLength(s, old, new string) uint64 {
+	n := uint64(strings.Count(s, old))
+	if len(new) >= len(old) {
+		return uint64(len(s)) + n*uint64(len(new)-len(old))
+	}
+	return uint64(len(s)) - n*uint64(len(old)-len(new))
+}
+
+func builtinRepeat(args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2",
+			len(args))
+	}
+	str, ok := args[0].(*String)
+	if !ok {
+		return newError("first argument to `repeat` must be STRING, got %s",
+			args[0].Type())
+	}
+	count, ok := args[1].(*Integer)
+	if !ok {
+		return newError("second argument to `repeat` must be INTEGER, got %s",
+			args[1].Type())
+	}
+	if count.Value < 0 {
+		return newError("count to `repeat` must not be negative, got %d", count.Value)
+	}
+	// compared by dividing, as multiplying may overflow
+	if count.Value > 0 && int64(len(str.Value)) > MaxLength/count.Value {
+		return newError("repeating %d bytes %d times exceeds the maximum length of %d",
+			len(str.Value), count.Value, MaxLength)
+	}
+
+	return &String{Value: strings.Repeat(str.Value, int(count.Value))}
+}
+
+func repeatSize(args ...Object) int {
+	if len(args) != 2 {
+		return 1
+	}
+	str, _ := args[0].(*String)
+	count, _ := args[1].(*Integer)
+	// calls failing make nothing but their error
+	if str == nil || count == nil || count.Value <= 0 ||
+		int64(len(str.Value)) > MaxLength/count.Value {
+		return 1
+	}
+	return 1 + len(str.Value)*int(count.Value)/bytesPerObject
+}
+
+// builtinChar returns the string of a Unicode code point
+func builtinChar(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+	code, ok := args[0].(*Integer)
+	if !ok {
+		return newError("argument to `char` must be INTEGER, got %s",
+			args[0].Type())
+	}
+	if code.Value < 0 || code.Value > utf8.MaxRune || !utf8.ValidRune(rune(code.Value)) {
+		return newError("invalid code point for `char`: %d", code.Value)
+	}
+
+	return &String{Value: string(rune(code.Value))}
+}
+
+// builtinOrd returns the Unicode code point of a one-character string
+func builtinOrd(args ...Object) Object {
+	values, err := stringArgs("ord", 1, args)
+	if err != nil {
+		return err
+	}
+
+	r, size := utf8.DecodeRuneInString(values[0])
+	if size == 0 || size != len(values[0]) {
+		return newError("argument to `ord` must be a single character, got %q", values[0])
+	}
+	return NewInteger(int64(r))
+}
+
+// builtinFormat formats its arguments according to a format string. %d
+// takes an integer, %s a string or the representation of anything else,
+// %v the representation of anything, and %% is a literal percent sign.
+func builtinFormat(args ...Object) Object {
+	if len(args) < 1 {
+		return newError("wrong number of arguments. got=%d, want=at least 1",
+			len(args))
+	}
+	format, ok := args[0].(*String)
+	if !ok {
+		return newError("first argument to `format` must be STRING, got %s",
+			args[0].Type())
+	}
+
+	var out strings.Builder
+	rest := args[1:]
+	verbs := format.Value
+	for i := 0; i < len(verbs); i++ {
+		if verbs[i] != '%' {
+			out.WriteByte(verbs[i])
+			continue
+		}
+
+		i++
+		if i == len(verbs) {
+			return newError("format: missing verb at end of format string")
+		}
+		verb := verbs[i]
+		if verb == '%' {
+			out.WriteByte('%')
+			continue
+		}
+
+		if len(rest) == 0 {
+			return newError("format: missing argument for %%%c", verb)
+		}
+		arg := rest[0]
+		rest = rest[1:]
+
+		switch verb {
+		case 'd':
+			integer, ok := arg.(*Integer)
+			if !ok {
+				return newError("format: %%d expects INTEGER, got %s", arg.Type())
+			}
+			out.WriteString(strconv.FormatInt(integer.Value, 10))
+		case 's':
+			if str, ok := arg.(*String); ok {
+				out.WriteString(str.Value)
+			} else {
+				out.WriteString(arg.Inspect())
+			}
+		case 'v':
+			out.WriteString(arg.Inspect())
+		default:
+			return newError("format: unknown verb %%%c", verb)
+		}
+	}
+
+	if len(rest) != 0 {
+		return newError("format: %d arguments left unused", len(rest))
+	}
+	return &String{Value: out.String()}
+}
+
+func stringArray(values []string) *Array {
+	elements := make([]Object, len(values))
+	for i, value := range values {
+		elements[i] = &String{Value: value}
+	}
+	return &Array{Elements: elements}
+}
@@ -38,9 +38,15 @@ type (
 	infixParseFn  func(ast.Expression) ast.Expression
 )
 
+// Error is a syntax error together with the token it was found at
+type Error struct {
+	Message string
+	Token   token.Token
+}
+
 type Parser struct {
 	l      *lexer.Lexer
-	errors []string
+	errors []Error
 
 	curToken  token.Token
 	peekToken token.Token
@@ -52,7 +58,7 @@ type Parser struct {
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
 		l:      l,
-		errors: []string{},
+		errors: []Error{},
 	}
 
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
@@ -68,6 +74,9 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
+	p.registerPrefix(token.IMPORT, p.parseImportExpression)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
@@ -92,6 +101,10 @@ func New(l *lexer.Lexer) *Parser {
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+
+	for p.peekToken.Type == token.COMMENT {
+		p.peekToken = p.l.NextToken()
+	}
 }
 
 func (p *Parser) curTokenIs(t token.TokenType) bool {
@@ -113,18 +126,29 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 }
 
 func (p *Parser) Errors() []string {
+	messages := make([]string, 0, len(p.errors))
+	for _, err := range p.errors {
+		messages = append(messages, err.Message)
+	}
+	return messages
+}
+
+// DetailedErrors returns the errors along with the tokens they were found at
+func (p *Parser) DetailedErrors() []Error {
 	return p.errors
 }
 
+func (p *Parser) addError(tok token.Token, format string, a ...interface{}) {
+	p.errors = append(p.errors, Error{Message: fmt.Sprintf(format, a...), Token: tok})
+}
+
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead",
+	p.addError(p.peekToken, "expected next token to be %s, got %s instead",
 		t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.addError(p.curToken, "no prefix parse function for %s found", t)
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
@@ -148,6 +172,10 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.EXPORT:
+		return p.parseExportStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -191,6 +219,20 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	stmt := &ast.ThrowStatement{Token: p.curToken}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	stmt := &ast.ExpressionStatement{Token: p.curToken}
 
@@ -250,8 +292,7 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.addError(p.curToken, "could not parse %q as integer", p.curToken.Literal)
 		return nil
 	}
 
@@ -260,6 +301,31 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return lit
 }
 
+// parseExportStatement parses a let statement preceded by 'export'
+func (p *Parser) parseExportStatement() ast.Statement {
+	if !p.expectPeek(token.LET) {
+		return nil
+	}
+
+	stmt := p.parseLetStatement()
+	if stmt == nil {
+		return nil
+	}
+	stmt.Exported = true
+	return stmt
+}
+
+func (p *Parser) parseImportExpression() ast.Expression {
+	exp := &ast.ImportExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+	exp.Path = p.curToken.Literal
+
+	return exp
+}
+
 func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
@@ -340,6 +406,52 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expression
 }
 
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	expression.Block = p.parseBlockStatement()
+
+	if !p.expectPeek(token.CATCH) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	expression.Param = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	expression.Catch = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+
+		expression.Finally = p.parseBlockStatement()
+	}
+
+	return expression
+}
+
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
@@ -354,6 +466,8 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		p.nextToken()
 	}
 
+	block.Rbrace = p.curToken
+
 	return block
 }
 
@@ -371,6 +485,7 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	}
 
 	lit.Body = p.parseBlockStatement()
+	ast.MarkTailCalls(lit)
 
 	return lit
 }
@@ -469,6 +584,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		value := p.parseExpression(LOWEST)
 
 		hash.Pairs[key] = value
+		hash.Keys = append(hash.Keys, key)
 
 		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
 			return nil
@@ -482,6 +598,24 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	return hash
 }
 
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	lit := &ast.MacroLiteral{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	lit.Parameters = p.parseFunctionParameters()
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	lit.Body = p.parseBlockStatement()
+
+	return lit
+}
+
 func (p *Parser) registerPrefix(tokenType token.TokenType, fn prefixParseFn) {
 	p.prefixParseFns[tokenType] = fn
 }
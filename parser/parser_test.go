@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"monkey-compiler/ast"
 	"monkey-compiler/lexer"
+	"strings"
 	"testing"
 )
 
@@ -556,6 +557,53 @@ func TestFunctionLiteralParsing(t *testing.T) {
 	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
 }
 
+func TestMacroLiteralParsing(t *testing.T) {
+	input := `macro(x, y) { x + y; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	macro, ok := stmt.Expression.(*ast.MacroLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MacroLiteral. got=%T",
+			stmt.Expression)
+	}
+
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("macro literal parameters wrong. want 2, got=%d\n",
+			len(macro.Parameters))
+	}
+
+	testLiteralExpression(t, macro.Parameters[0], "x")
+	testLiteralExpression(t, macro.Parameters[1], "y")
+
+	if len(macro.Body.Statements) != 1 {
+		t.Fatalf("macro.Body.Statements has not 1 statements. got=%d\n",
+			len(macro.Body.Statements))
+	}
+
+	bodyStmt, ok := macro.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("macro body stmt is not ast.ExpressionStatement. got=%T",
+			macro.Body.Statements[0])
+	}
+
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+}
+
 func TestFunctionParameterParsing(t *testing.T) {
 	tests := []struct {
 		input          string
@@ -697,6 +745,151 @@ func TestStringLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestImportExpression(t *testing.T) {
+	input := `import "lib/math";`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	imp, ok := stmt.Expression.(*ast.ImportExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.ImportExpression. got=%T", stmt.Expression)
+	}
+	if imp.Path != "lib/math" {
+		t.Errorf("imp.Path not %q. got=%q", "lib/math", imp.Path)
+	}
+}
+
+func TestExportStatement(t *testing.T) {
+	input := `export let x = 5; let y = 6;`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+	for i, exported := range []bool{true, false} {
+		let, ok := program.Statements[i].(*ast.LetStatement)
+		if !ok {
+			t.Fatalf("statement %d not *ast.LetStatement. got=%T", i, program.Statements[i])
+		}
+		if let.Exported != exported {
+			t.Errorf("statement %d: Exported not %t", i, exported)
+		}
+	}
+	if program.String() != "export let x = 5;let y = 6;" {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+
+	p = New(lexer.New("export 5;"))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Errorf("expected parse error for export without let")
+	}
+}
+
+func TestTryExpression(t *testing.T) {
+	tests := []struct {
+		input      string
+		hasFinally bool
+		expected   string
+	}{
+		{"try { x } catch (e) { y }", false, "try x catch (e) y"},
+		{"try { x } catch (e) { y } finally { z }", true, "try x catch (e) y finally z"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		try, ok := stmt.Expression.(*ast.TryExpression)
+		if !ok {
+			t.Fatalf("exp not *ast.TryExpression. got=%T", stmt.Expression)
+		}
+		if try.Param.Value != "e" {
+			t.Errorf("try.Param not %q. got=%q", "e", try.Param.Value)
+		}
+		if (try.Finally != nil) != tt.hasFinally {
+			t.Errorf("try.Finally wrong. want finally=%t, got=%v", tt.hasFinally, try.Finally)
+		}
+		if try.String() != tt.expected {
+			t.Errorf("try.String() wrong. want=%q, got=%q", tt.expected, try.String())
+		}
+	}
+
+	for _, input := range []string{"try { x }", "try { x } catch { y }", "try { x } catch (1) { y }"} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parse error for %q", input)
+		}
+	}
+}
+
+func TestThrowStatement(t *testing.T) {
+	p := New(lexer.New(`throw "boom"; 1`))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ThrowStatement)
+	if !ok {
+		t.Fatalf("statement not *ast.ThrowStatement. got=%T", program.Statements[0])
+	}
+	if str, ok := stmt.Value.(*ast.StringLiteral); !ok || str.Value != "boom" {
+		t.Fatalf("stmt.Value not \"boom\". got=%T(%+v)", stmt.Value, stmt.Value)
+	}
+	if stmt.String() != `throw boom;` {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"f(); g()", []string{}},
+		{"fn() { f(); g() }", []string{"g()"}},
+		{"fn() { f(g()) }", []string{"f(g())"}},
+		{"fn() { 1 + f() }", []string{}},
+		{"fn() { let x = f(); x }", []string{}},
+		{"fn() { if (x) { f() } else { g(); h() } }", []string{"f()", "h()"}},
+		{"fn() { if (x) { return f() }; g() }", []string{"f()", "g()"}},
+		{"fn() { try { f() } catch (e) { g() } }", []string{}},
+		{"fn() { try { return f() } catch (e) { return g() } }", []string{}},
+		{"fn() { fn() { f() } }", []string{"f()"}},
+		{"fn() { fn() { f() }() }", []string{"fn() f()()", "f()"}},
+		{"macro() { quote(f()) }", []string{}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		tail := []string{}
+		ast.Inspect(program, func(node ast.Node) bool {
+			if call, ok := node.(*ast.CallExpression); ok && call.Tail {
+				tail = append(tail, call.String())
+			}
+			return true
+		})
+
+		if strings.Join(tail, "; ") != strings.Join(tt.expected, "; ") {
+			t.Errorf("wrong tail calls for %q. want=%q, got=%q", tt.input, tt.expected, tail)
+		}
+	}
+}
+
 func TestParsingEmptyArrayLiterals(t *testing.T) {
 	input := "[]"
 
@@ -817,6 +1010,53 @@ func TestParsingHashLiteralsStringKeys(t *testing.T) {
 	}
 }
 
+func TestParsingHashLiteralKeyOrder(t *testing.T) {
+	input := `{"b": 1, "a": 2, "c": 3}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	expected := []string{"b", "a", "c"}
+	if len(hash.Keys) != len(expected) {
+		t.Fatalf("hash.Keys has wrong length. got=%d", len(hash.Keys))
+	}
+
+	for i, key := range hash.Keys {
+		if key.String() != expected[i] {
+			t.Errorf("hash.Keys[%d] wrong. want=%q, got=%q", i, expected[i], key.String())
+		}
+	}
+}
+
+func TestCommentsAreSkipped(t *testing.T) {
+	input := `// header
+let x = 1; // trailing
+// between
+x // last`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d",
+			len(program.Statements))
+	}
+
+	if program.String() != "let x = 1;x" {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+}
+
 func TestParsingHashLiteralsBooleanKeys(t *testing.T) {
 	input := `{true: 1, false: 2}`
 
@@ -1081,3 +1321,26 @@ func checkParserErrors(t *testing.T, p *Parser) {
 	}
 	t.FailNow()
 }
+
+func TestDetailedErrorPositions(t *testing.T) {
+	input := "let x = 1;\nlet = 2;"
+
+	p := New(lexer.New(input))
+	p.ParseProgram()
+
+	errors := p.DetailedErrors()
+	if len(errors) == 0 {
+		t.Fatalf("expected parser errors")
+	}
+
+	first := errors[0]
+	if first.Message != "expected next token to be IDENT, got = instead" {
+		t.Errorf("wrong message. got=%q", first.Message)
+	}
+	if first.Token.Line != 2 || first.Token.Column != 5 {
+		t.Errorf("wrong position. want=2:5, got=%d:%d", first.Token.Line, first.Token.Column)
+	}
+	if p.Errors()[0] != first.Message {
+		t.Errorf("Errors() and DetailedErrors() disagree. got=%q", p.Errors()[0])
+	}
+}
@@ -0,0 +1,210 @@
+package repl
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"monkey-compiler/ast"
+	"monkey-compiler/compiler"
+	"monkey-compiler/evaluator"
+	"monkey-compiler/object"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+type command struct {
+	usage string
+	help  string
+	run   func(s *session, arg string)
+}
+
+// commands are the REPL meta-commands, invoked as `:name argument`
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"ast":      {":ast <code>", "print the syntax tree of code", (*session).printAST},
+		"bytecode": {":bytecode <code>", "print the instructions and constants code compiles to", (*session).printBytecode},
+		"globals":  {":globals", "list the global bindings and their values", (*session).printGlobals},
+		"type":     {":type <code>", "print the type of the value code evaluates to", (*session).printType},
+		"reset":    {":reset", "drop every binding", (*session).resetCommand},
+		"load":     {":load <file>", "evaluate the code in file", (*session).load},
+		"backend":  {":backend [eval|vm]", "print or switch the backend code runs on, dropping every binding", (*session).switchBackend},
+		"help":     {":help", "list the commands", (*session).printHelp},
+	}
+}
+
+// command runs the meta-command in input
+func (s *session) command(input string) {
+	input = strings.TrimPrefix(strings.TrimSpace(input), ":")
+	name, arg := input, ""
+	if i := strings.IndexAny(input, " \t\n"); i >= 0 {
+		name, arg = input[:i], strings.TrimSpace(input[i:])
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(s.out, "unknown command :%s, try :help\n", name)
+		return
+	}
+	cmd.run(s, arg)
+}
+
+func (s *session) printHelp(string) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(s.out, "%-20s %s\n", commands[name].usage, commands[name].help)
+	}
+}
+
+func (s *session) printAST(arg string) {
+	program, ok := s.parse(arg)
+	if !ok {
+		return
+	}
+	ast.Walk(&treePrinter{out: s.out}, program)
+}
+
+func (s *session) printBytecode(arg string) {
+	program, ok := s.parse(arg)
+	if !ok {
+		return
+	}
+
+	// macros defined here must not outlive the command
+	macroEnv := object.NewEnclosedEnvironment(s.macroEnv)
+	evaluator.DefineMacros(program, macroEnv)
+	expanded, err := evaluator.ExpandMacros(program, macroEnv)
+	if err != nil {
+		fmt.Fprintf(s.out, "error during macro expansion: %v\n", err)
+		return
+	}
+
+	comp := compiler.NewWithState(s.symbolTable.Clone(), s.constants)
+	comp.SetLoader(s.loader, "")
+	if err := comp.Compile(expanded); err != nil {
+		fmt.Fprintf(s.out, "error during compilation: %v\n", err)
+		return
+	}
+
+	byteCode := comp.ByteCode()
+	io.WriteString(s.out, "instructions:\n")
+	io.WriteString(s.out, byteCode.Instructions.String())
+	io.WriteString(s.out, "constants:\n")
+	for i, constant := range byteCode.Constants {
+		fmt.Fprintf(s.out, "%04d %s (%s)\n", i, constant.Inspect(), constant.Type())
+	}
+}
+
+func (s *session) printGlobals(string) {
+	if s.backend == backendEval {
+		for _, name := range s.env.Names() {
+			value, _ := s.env.Get(name)
+			fmt.Fprintf(s.out, "%s = %s\n", name, value.Inspect())
+		}
+		return
+	}
+
+	symbols := []compiler.Symbol{}
+	for _, symbol := range s.symbolTable.Symbols() {
+		if symbol.Scope == compiler.GlobalScope {
+			symbols = append(symbols, symbol)
+		}
+	}
+	sort.Slice(symbols, func(i, j int) bool { return symbols[i].Index < symbols[j].Index })
+
+	for _, symbol := range symbols {
+		value := "<unset>"
+		if global := s.globals[symbol.Index]; global != nil {
+			value = global.Inspect()
+		}
+		fmt.Fprintf(s.out, "%d %s = %s\n", symbol.Index, symbol.Name, value)
+	}
+}
+
+func (s *session) printType(arg string) {
+	if result := s.eval(arg); result != nil {
+		fmt.Fprintln(s.out, result.Type())
+	}
+}
+
+func (s *session) resetCommand(string) {
+	s.reset()
+}
+
+func (s *session) load(arg string) {
+	if arg == "" {
+		fmt.Fprintln(s.out, "usage: :load <file>")
+		return
+	}
+
+	src, err := ioutil.ReadFile(arg)
+	if err != nil {
+		fmt.Fprintln(s.out, err)
+		return
+	}
+	s.run(string(src))
+}
+
+func (s *session) switchBackend(arg string) {
+	switch arg {
+	case "":
+	case s.backend:
+	case backendEval, backendVM:
+		if s.hasBindings() {
+			fmt.Fprintln(s.out, "dropping every binding, the backends cannot share them")
+		}
+		s.backend = arg
+		s.reset()
+	default:
+		fmt.Fprintf(s.out, "unknown backend %q, want %s or %s\n", arg, backendEval, backendVM)
+		return
+	}
+	fmt.Fprintf(s.out, "backend: %s\n", s.backend)
+}
+
+// treePrinter prints one line per node, indented by depth
+type treePrinter struct {
+	out   io.Writer
+	depth int
+}
+
+func (p *treePrinter) Visit(node ast.Node) ast.Visitor {
+	if node == nil {
+		p.depth--
+		return nil
+	}
+
+	line := strings.Repeat("  ", p.depth) + reflect.TypeOf(node).Elem().Name()
+	if detail := nodeDetail(node); detail != "" {
+		line += " " + detail
+	}
+	io.WriteString(p.out, line+"\n")
+
+	p.depth++
+	return p
+}
+
+func nodeDetail(node ast.Node) string {
+	switch node := node.(type) {
+	case *ast.Identifier:
+		return node.Value
+	case *ast.IntegerLiteral:
+		return fmt.Sprint(node.Value)
+	case *ast.Boolean:
+		return fmt.Sprint(node.Value)
+	case *ast.StringLiteral:
+		return fmt.Sprintf("%q", node.Value)
+	case *ast.PrefixExpression:
+		return node.Operator
+	case *ast.InfixExpression:
+		return node.Operator
+	}
+	return ""
+}
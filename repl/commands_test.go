@@ -0,0 +1,128 @@
+package repl
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCommands(t *testing.T) {
+	tests := []struct {
+		name     string
+		lines    []string
+		expected string
+	}{
+		{
+			"ast",
+			[]string{":ast let x = -1 + f(\"a\");"},
+			"Program\n" +
+				"  LetStatement\n" +
+				"    Identifier x\n" +
+				"    InfixExpression +\n" +
+				"      PrefixExpression -\n" +
+				"        IntegerLiteral 1\n" +
+				"      CallExpression\n" +
+				"        Identifier f\n" +
+				"        StringLiteral \"a\"\n",
+		},
+		{
+			"ast with parse error",
+			[]string{":ast let = 1"},
+			"Woops! We ran into some monkey business here!\n" +
+				" parser errors:\n" +
+				"\texpected next token to be IDENT, got = instead\n" +
+				"\tno prefix parse function for = found\n",
+		},
+		{
+			"bytecode",
+			[]string{":bytecode 1 + 2"},
+			"instructions:\n" +
+				"0000 OpConstant 0\n" +
+				"0003 OpConstant 1\n" +
+				"0006 OpAdd\n" +
+				"0007 OpPop\n" +
+				"constants:\n" +
+				"0000 1 (INTEGER)\n" +
+				"0001 2 (INTEGER)\n",
+		},
+		{
+			"bytecode does not define globals",
+			[]string{":bytecode let a = 1;", ":globals"},
+			"instructions:\n" +
+				"0000 OpConstant 0\n" +
+				"0003 OpSetGlobal 0\n" +
+				"constants:\n" +
+				"0000 1 (INTEGER)\n",
+		},
+		{
+			"globals",
+			[]string{"let a = 5;", "let b = a * 2;", ":globals"},
+			"0 a = 5\n1 b = 10\n",
+		},
+		{
+			"type",
+			[]string{":type 1 < 2", ":type 3"},
+			"BOOLEAN\nINTEGER\n",
+		},
+		{
+			"backend",
+			[]string{":backend", ":backend eval", "let f = fn(x) { x * 2 };", "f(21)", ":type f", ":globals"},
+			"backend: vm\n" +
+				"backend: eval\n" +
+				"42\n" +
+				"FUNCTION\n" +
+				"f = fn(x) {\n(x * 2)\n}\n",
+		},
+		{
+			"switching backends drops bindings",
+			[]string{"let f = fn() { 1 };", ":backend eval", "f()", ":backend eval"},
+			"dropping every binding, the backends cannot share them\n" +
+				"backend: eval\n" +
+				"ERROR: identifier not found: f\n" +
+				"backend: eval\n",
+		},
+		{
+			"unknown backend",
+			[]string{":backend jit"},
+			"unknown backend \"jit\", want eval or vm\n",
+		},
+		{
+			"reset",
+			[]string{":backend eval", "let a = 1;", ":reset", ":globals", "a"},
+			"backend: eval\nERROR: identifier not found: a\n",
+		},
+		{
+			"unknown command",
+			[]string{":frobnicate"},
+			"unknown command :frobnicate, try :help\n",
+		},
+	}
+
+	for _, tt := range tests {
+		if actual := runSession(t, tt.lines...); actual != tt.expected {
+			t.Errorf("%s: wrong output.\nwant=%q\ngot=%q", tt.name, tt.expected, actual)
+		}
+	}
+}
+
+func TestLoadCommand(t *testing.T) {
+	f, err := ioutil.TempFile("", "monkey-load")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("let a = 20;\nlet b = a + 1;\nb * 2\n")
+	f.Close()
+
+	actual := runSession(t, ":backend eval", ":load "+f.Name(), "a")
+	expected := "backend: eval\n42\n20\n"
+	if actual != expected {
+		t.Errorf("wrong output.\nwant=%q\ngot=%q", expected, actual)
+	}
+
+	actual = runSession(t, ":load /does/not/exist")
+	if !strings.Contains(actual, "no such file or directory") {
+		t.Errorf("missing file not reported. got=%q", actual)
+	}
+}
@@ -0,0 +1,319 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// errInterrupted is returned by readLine when the user presses Ctrl-C
+var errInterrupted = errors.New("interrupted")
+
+// lineReader reads the lines typed into the REPL
+type lineReader interface {
+	// readLine shows prompt and returns the next line without its line
+	// ending, or io.EOF once the input is exhausted
+	readLine(prompt string) (string, error)
+}
+
+// newLineReader returns a line editor when in is a terminal and a plain line
+// scanner otherwise
+func newLineReader(in io.Reader, out io.Writer, complete func(prefix string) []string) lineReader {
+	if f, ok := in.(*os.File); ok && isTerminal(f.Fd()) {
+		return &editor{
+			in:       bufio.NewReader(f),
+			out:      out,
+			history:  loadHistory(defaultHistoryPath()),
+			complete: complete,
+			raw:      func() (func(), error) { return makeRaw(f.Fd()) },
+		}
+	}
+	return &scannerReader{scanner: bufio.NewScanner(in), out: out}
+}
+
+type scannerReader struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+func (r *scannerReader) readLine(prompt string) (string, error) {
+	io.WriteString(r.out, prompt)
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return r.scanner.Text(), nil
+}
+
+// editor is a minimal emacs-style line editor for ANSI terminals with
+// history navigation and tab completion
+type editor struct {
+	in       *bufio.Reader
+	out      io.Writer
+	history  *history
+	complete func(prefix string) []string
+	raw      func() (func(), error) // switches the terminal to raw mode, nil if already raw
+
+	prompt string
+	buf    []rune
+	pos    int
+}
+
+// control keys
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyBackspace = 8
+	keyTab       = 9
+	keyLineFeed  = 10
+	keyCtrlK     = 11
+	keyEnter     = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+func (e *editor) readLine(prompt string) (string, error) {
+	if e.raw != nil {
+		restore, err := e.raw()
+		if err != nil {
+			return "", err
+		}
+		defer restore()
+	}
+
+	e.prompt, e.buf, e.pos = prompt, nil, 0
+	io.WriteString(e.out, prompt)
+
+	// index into history while browsing it; the line being typed is kept
+	// aside as the entry after the last one
+	browsing := len(e.history.entries)
+	var pending []rune
+
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			if err == io.EOF && len(e.buf) != 0 {
+				return e.accept(), nil
+			}
+			return "", err
+		}
+
+		switch r {
+		case keyEnter, keyLineFeed:
+			return e.accept(), nil
+		case keyCtrlC:
+			io.WriteString(e.out, "^C\r\n")
+			return "", errInterrupted
+		case keyCtrlD:
+			if len(e.buf) == 0 {
+				io.WriteString(e.out, "\r\n")
+				return "", io.EOF
+			}
+			e.deleteAt(e.pos)
+		case keyBackspace, keyDelete:
+			if e.pos > 0 {
+				e.pos--
+				e.deleteAt(e.pos)
+			}
+		case keyCtrlA:
+			e.pos = 0
+		case keyCtrlE:
+			e.pos = len(e.buf)
+		case keyCtrlB:
+			e.moveBy(-1)
+		case keyCtrlF:
+			e.moveBy(1)
+		case keyCtrlK:
+			e.buf = e.buf[:e.pos]
+		case keyCtrlU:
+			e.buf = append([]rune{}, e.buf[e.pos:]...)
+			e.pos = 0
+		case keyCtrlP:
+			browsing, pending = e.browse(browsing-1, browsing, pending)
+		case keyCtrlN:
+			browsing, pending = e.browse(browsing+1, browsing, pending)
+		case keyTab:
+			e.completeWord()
+		case keyEscape:
+			switch e.readEscape() {
+			case 'A':
+				browsing, pending = e.browse(browsing-1, browsing, pending)
+			case 'B':
+				browsing, pending = e.browse(browsing+1, browsing, pending)
+			case 'C':
+				e.moveBy(1)
+			case 'D':
+				e.moveBy(-1)
+			case 'H':
+				e.pos = 0
+			case 'F':
+				e.pos = len(e.buf)
+			case '~':
+				e.deleteAt(e.pos)
+			}
+		default:
+			if r < ' ' {
+				continue
+			}
+			e.insert([]rune{r})
+		}
+
+		e.refresh()
+	}
+}
+
+// accept finishes the current line and records it in the history
+func (e *editor) accept() string {
+	io.WriteString(e.out, "\r\n")
+	line := string(e.buf)
+	e.history.add(line)
+	return line
+}
+
+// readEscape reads the rest of an ANSI escape sequence and returns its final
+// byte, or 0 for sequences the editor does not handle. Delete is reported
+// as '~' when sent as ESC [ 3 ~.
+func (e *editor) readEscape() rune {
+	next, _, err := e.in.ReadRune()
+	if err != nil || next != '[' && next != 'O' {
+		return 0
+	}
+
+	param := ""
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return 0
+		}
+		if r >= '0' && r <= '9' || r == ';' {
+			param += string(r)
+			continue
+		}
+		if r == '~' && param != "3" {
+			return 0
+		}
+		return r
+	}
+}
+
+// browse replaces the line with history entry i. Leaving the history
+// restores the line that was being typed.
+func (e *editor) browse(i, current int, pending []rune) (int, []rune) {
+	n := len(e.history.entries)
+	if i < 0 || i > n {
+		return current, pending
+	}
+
+	if current == n {
+		pending = e.buf
+	}
+	if i == n {
+		e.buf = pending
+	} else {
+		e.buf = []rune(e.history.entries[i])
+	}
+	e.pos = len(e.buf)
+
+	return i, pending
+}
+
+func (e *editor) moveBy(n int) {
+	if pos := e.pos + n; pos >= 0 && pos <= len(e.buf) {
+		e.pos = pos
+	}
+}
+
+func (e *editor) insert(runes []rune) {
+	buf := make([]rune, 0, len(e.buf)+len(runes))
+	buf = append(buf, e.buf[:e.pos]...)
+	buf = append(buf, runes...)
+	e.buf = append(buf, e.buf[e.pos:]...)
+	e.pos += len(runes)
+}
+
+func (e *editor) deleteAt(pos int) {
+	if pos < len(e.buf) {
+		e.buf = append(e.buf[:pos], e.buf[pos+1:]...)
+	}
+}
+
+// completeWord completes the identifier before the cursor. Ambiguous
+// completions are extended to their common prefix, or listed when there is
+// nothing left to add.
+func (e *editor) completeWord() {
+	if e.complete == nil {
+		return
+	}
+
+	start := e.pos
+	for start > 0 && isIdentRune(e.buf[start-1]) {
+		start--
+	}
+	prefix := string(e.buf[start:e.pos])
+	if prefix == "" {
+		return
+	}
+
+	candidates := e.complete(prefix)
+	if len(candidates) == 0 {
+		return
+	}
+
+	common := candidates[0]
+	for _, c := range candidates[1:] {
+		for !strings.HasPrefix(c, common) {
+			common = common[:len(common)-1]
+		}
+	}
+
+	if len(common) > len(prefix) {
+		e.insert([]rune(common[len(prefix):]))
+		return
+	}
+	if len(candidates) > 1 {
+		fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+	}
+}
+
+// refresh redraws the prompt and the line and puts the cursor in place
+func (e *editor) refresh() {
+	line := "\r" + e.prompt + string(e.buf) + "\x1b[K\r"
+	if column := len([]rune(e.prompt)) + e.pos; column > 0 {
+		line += fmt.Sprintf("\x1b[%dC", column)
+	}
+	io.WriteString(e.out, line)
+}
+
+func isIdentRune(r rune) bool {
+	return 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || r == '_' || '0' <= r && r <= '9'
+}
+
+// completer returns a completion function offering the names defined in
+// the REPL session and the builtins
+func completer(names func() []string) func(prefix string) []string {
+	return func(prefix string) []string {
+		seen := map[string]bool{}
+		matches := []string{}
+		for _, name := range names() {
+			if strings.HasPrefix(name, prefix) && !seen[name] {
+				seen[name] = true
+				matches = append(matches, name)
+			}
+		}
+		sort.Strings(matches)
+		return matches
+	}
+}
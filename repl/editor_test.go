@@ -0,0 +1,135 @@
+package repl
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newTestEditor(input string, entries ...string) *editor {
+	return &editor{
+		in:      bufio.NewReader(strings.NewReader(input)),
+		out:     &bytes.Buffer{},
+		history: &history{entries: entries},
+		complete: completer(func() []string {
+			return []string{"len", "let_me", "limit", "first", "limit"}
+		}),
+	}
+}
+
+func TestEditorReadLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		history  []string
+		expected string
+	}{
+		{"plain", "let x = 1;\r", nil, "let x = 1;"},
+		{"line feed", "x\n", nil, "x"},
+		{"backspace", "abx\x7fc\r", nil, "abc"},
+		{"ctrl-h", "abx\x08c\r", nil, "abc"},
+		{"arrows", "ac\x1b[Db\x1b[C!\r", nil, "abc!"},
+		{"home and end", "bc\x01a\x05d\r", nil, "abcd"},
+		{"home and end keys", "bc\x1b[Ha\x1b[Fd\r", nil, "abcd"},
+		{"delete key", "abc\x01\x1b[3~\r", nil, "bc"},
+		{"ctrl-d deletes", "abc\x01\x04\r", nil, "bc"},
+		{"kill to end", "abcdef\x02\x02\x02\x0b\r", nil, "abc"},
+		{"kill to start", "abcdef\x02\x02\x15\r", nil, "ef"},
+		{"unicode", "\"héllo\x1b[D\x1b[Dé\x05\"\r", nil, "\"hélélo\""},
+		{"history up", "\x1b[A\r", []string{"1", "2"}, "2"},
+		{"history up twice", "\x1b[A\x1b[A\r", []string{"1", "2"}, "1"},
+		{"history past oldest", "\x1b[A\x1b[A\x1b[A\r", []string{"1", "2"}, "1"},
+		{"history back to typed line", "abc\x10\x0e\r", []string{"1"}, "abc"},
+		{"history edit", "\x1b[A+1\r", []string{"x"}, "x+1"},
+		{"complete unique", "fi\t(\r", nil, "first("},
+		{"complete common prefix", "l\t\r", nil, "l"},
+		{"complete extends prefix", "lim\t\r", nil, "limit"},
+		{"complete mid line", "(fi)\x1b[D\t\r", nil, "(first)"},
+		{"no candidates", "zz\t\r", nil, "zz"},
+		{"eof ends line", "abc", nil, "abc"},
+	}
+
+	for _, tt := range tests {
+		e := newTestEditor(tt.input, tt.history...)
+		actual, err := e.readLine(">> ")
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+			continue
+		}
+		if actual != tt.expected {
+			t.Errorf("%s: wrong line. want=%q, got=%q", tt.name, tt.expected, actual)
+		}
+	}
+}
+
+func TestEditorControl(t *testing.T) {
+	e := newTestEditor("abc\x03\x04")
+
+	if _, err := e.readLine(">> "); err != errInterrupted {
+		t.Errorf("ctrl-c should interrupt. got=%v", err)
+	}
+	if _, err := e.readLine(">> "); err != io.EOF {
+		t.Errorf("ctrl-d on empty line should return EOF. got=%v", err)
+	}
+}
+
+func TestEditorHistory(t *testing.T) {
+	e := newTestEditor("let x = 1;\r\rx\r\x1b[A\x1b[A\r")
+
+	for i := 0; i < 4; i++ {
+		if _, err := e.readLine(">> "); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	expected := []string{"let x = 1;", "x", "let x = 1;"}
+	if !reflect.DeepEqual(e.history.entries, expected) {
+		t.Errorf("wrong history. want=%q, got=%q", expected, e.history.entries)
+	}
+}
+
+func TestEditorListsCandidates(t *testing.T) {
+	e := newTestEditor("l\t\r")
+	out := e.out.(*bytes.Buffer)
+
+	if _, err := e.readLine(">> "); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !strings.Contains(out.String(), "len  let_me  limit\r\n") {
+		t.Errorf("candidates not listed. got=%q", out.String())
+	}
+}
+
+func TestReadInput(t *testing.T) {
+	input := "let add = fn(a, b) {\n  a +\n  b\n};\n1 + 2\n[1,\n"
+	out := &bytes.Buffer{}
+	reader := newLineReader(strings.NewReader(input), out, nil)
+
+	expected := []string{
+		"let add = fn(a, b) {\n  a +\n  b\n};",
+		"1 + 2",
+		"[1,",
+	}
+	for _, want := range expected {
+		got, err := readInput(reader)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got != want {
+			t.Errorf("wrong input. want=%q, got=%q", want, got)
+		}
+	}
+
+	if _, err := readInput(reader); err != io.EOF {
+		t.Errorf("expected EOF. got=%v", err)
+	}
+
+	prompts := ">> .. .. .. >> >> .. >> "
+	if out.String() != prompts {
+		t.Errorf("wrong prompts. want=%q, got=%q", prompts, out.String())
+	}
+}
@@ -0,0 +1,80 @@
+package repl
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	historyFile = ".monkey_history"
+	historySize = 1000
+)
+
+// history holds the lines entered in the REPL. When path is set, every
+// added line is appended to the file so that it survives the session.
+type history struct {
+	path    string
+	entries []string
+}
+
+// defaultHistoryPath returns the history file in the home directory, or ""
+// when there is no home directory to keep it in
+func defaultHistoryPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, historyFile)
+}
+
+// loadHistory reads the history kept at path. A missing file is an empty
+// history.
+func loadHistory(path string) *history {
+	h := &history{path: path}
+	if path == "" {
+		return h
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return h
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		h.entries = append(h.entries, scanner.Text())
+	}
+	if len(h.entries) > historySize {
+		h.entries = h.entries[len(h.entries)-historySize:]
+	}
+
+	return h
+}
+
+// add records line unless it is blank or repeats the previous entry
+func (h *history) add(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if n := len(h.entries); n > 0 && h.entries[n-1] == line {
+		return
+	}
+
+	h.entries = append(h.entries, line)
+	if len(h.entries) > historySize {
+		h.entries = h.entries[1:]
+	}
+
+	if h.path == "" {
+		return
+	}
+	f, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	f.WriteString(line + "\n")
+}
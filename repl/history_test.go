@@ -0,0 +1,38 @@
+package repl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestHistoryPersists(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monkey-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, historyFile)
+
+	h := loadHistory(path)
+	if len(h.entries) != 0 {
+		t.Fatalf("history of missing file not empty. got=%q", h.entries)
+	}
+
+	h.add("let x = 1;")
+	h.add("let x = 1;")
+	h.add("   ")
+	h.add("x + 1")
+
+	expected := []string{"let x = 1;", "x + 1"}
+	if !reflect.DeepEqual(h.entries, expected) {
+		t.Errorf("wrong entries. want=%q, got=%q", expected, h.entries)
+	}
+
+	reloaded := loadHistory(path)
+	if !reflect.DeepEqual(reloaded.entries, expected) {
+		t.Errorf("wrong reloaded entries. want=%q, got=%q", expected, reloaded.entries)
+	}
+}
@@ -0,0 +1,57 @@
+package repl
+
+import (
+	"monkey-compiler/lexer"
+	"monkey-compiler/token"
+)
+
+// isComplete reports whether src is ready to be evaluated. Input is
+// incomplete while brackets are left open, a string literal is not closed
+// or the last token is an operator still waiting for its operand.
+func isComplete(src string) bool {
+	depth := 0
+	var last token.Token
+
+	l := lexer.New(src)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.COMMENT:
+			continue
+		case token.LPAREN, token.LBRACE, token.LBRACKET:
+			depth++
+		case token.RPAREN, token.RBRACE, token.RBRACKET:
+			depth--
+		case token.STRING:
+			// an unterminated string runs up to the end of the input
+			if offset(src, tok)+1+len(tok.Literal) == len(src) {
+				return false
+			}
+		}
+		last = tok
+	}
+
+	if depth > 0 {
+		return false
+	}
+
+	switch last.Type {
+	case token.ASSIGN, token.PLUS, token.MINUS, token.BANG, token.ASTERISK, token.SLASH,
+		token.LT, token.GT, token.EQ, token.NOT_EQ, token.COMMA, token.COLON:
+		return false
+	}
+	return true
+}
+
+// offset returns the byte offset of tok in src
+func offset(src string, tok token.Token) int {
+	line := 1
+	for i := 0; i < len(src) && line < tok.Line; i++ {
+		if src[i] == '\n' {
+			line++
+			if line == tok.Line {
+				return i + tok.Column
+			}
+		}
+	}
+	return tok.Column - 1
+}
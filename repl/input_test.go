@@ -0,0 +1,41 @@
+package repl
+
+import "testing"
+
+func TestIsComplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"", true},
+		{"1 + 2", true},
+		{"let x = 5;", true},
+		{"let add = fn(a, b) {", false},
+		{"let add = fn(a, b) {\n  a + b\n};", true},
+		{"add(1,", false},
+		{"add(1,\n2)", true},
+		{"[1, 2", false},
+		{"{\"a\": 1", false},
+		{"{\"a\":", false},
+		{"1 +", false},
+		{"let x =", false},
+		{"x ==", false},
+		{"!", false},
+		{"\"abc", false},
+		{"\"abc\"", true},
+		{"\"\"", true},
+		{"1;\n\"ab", false},
+		{"1;\n\"ab\" + \"c\"", true},
+		{"\"{\"", true},
+		{"fn() { // }", false},
+		{"1 + // comment", false},
+		{"1 // comment", true},
+		{")", true},
+	}
+
+	for _, tt := range tests {
+		if actual := isComplete(tt.input); actual != tt.expected {
+			t.Errorf("isComplete(%q) wrong. want=%t, got=%t", tt.input, tt.expected, actual)
+		}
+	}
+}
@@ -1,58 +1,237 @@
 package repl
 
 import (
-	"bufio"
 	"fmt"
 	"io"
+	"monkey-compiler/ast"
 	"monkey-compiler/compiler"
+	"monkey-compiler/evaluator"
+	"monkey-compiler/module"
 	"monkey-compiler/object"
 	"monkey-compiler/vm"
+	"strings"
 
 	"monkey-compiler/lexer"
 	"monkey-compiler/parser"
 )
 
-const prompt = ">> "
+const (
+	prompt             = ">> "
+	continuationPrompt = ".. "
+)
+
+// Backends the REPL can run code on
+const (
+	backendVM   = "vm"
+	backendEval = "eval"
+)
+
+// session is the state of a REPL run. The backends make functions of
+// different kinds, so bindings cannot be carried from one backend to the
+// other and switching backends drops them.
+type session struct {
+	out      io.Writer
+	backend  string
+	builtins []object.BuiltinDef // every module, with output going to out
+	loader   *module.Loader
+
+	// compiler and VM state
+	constants   []object.Object
+	symbolTable *compiler.SymbolTable
+	globals     []object.Object
+
+	// evaluator state
+	env      *object.Environment
+	macroEnv *object.Environment
+}
+
+func newSession(out io.Writer) *session {
+	s := &session{out: out, backend: backendVM}
+	sandbox := &object.Sandbox{Modules: object.Modules, Stdout: out}
+	s.builtins = sandbox.Builtins()
+	s.loader = module.NewLoader(module.DefaultPath()...)
+	s.reset()
+	return s
+}
+
+// reset drops every binding
+func (s *session) reset() {
+	s.constants = make([]object.Object, 0)
+	s.symbolTable = compiler.NewSymbolTable()
+	for i, v := range s.builtins {
+		s.symbolTable.DefineBuiltin(i, v.Name)
+	}
+	s.globals = nil
+	s.env = object.NewEnvironment()
+	s.env.SetBuiltins(s.builtins)
+	s.env.SetImporter(evaluator.NewImporter(s.loader, ""))
+	s.macroEnv = object.NewEnvironment()
+	s.macroEnv.SetBuiltins(s.builtins)
+}
+
+// hasBindings tells whether anything was bound on the current backend
+func (s *session) hasBindings() bool {
+	if s.backend == backendEval {
+		return len(s.env.Names()) != 0
+	}
+	return numGlobals(s.symbolTable) != 0
+}
+
+// names returns the names that can be completed in the session
+func (s *session) names() []string {
+	names := []string{}
+	for _, symbol := range s.symbolTable.Symbols() {
+		names = append(names, symbol.Name)
+	}
+	return append(names, s.env.Names()...)
+}
+
+// vmBuiltins returns the builtins of the session as the VM indexes them
+func (s *session) vmBuiltins() []*object.Builtin {
+	builtins := make([]*object.Builtin, len(s.builtins))
+	for i, def := range s.builtins {
+		builtins[i] = def.Builtin
+	}
+	return builtins
+}
 
 // Start starts REPL of monkey
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-
-	constants := make([]object.Object, 0)
-	symbolTable := compiler.NewSymbolTable()
-	globals := make([]object.Object, vm.GlobalsSize)
+	s := newSession(out)
+	reader := newLineReader(in, out, completer(s.names))
 
 	for {
-		fmt.Printf(prompt)
-		scanned := scanner.Scan()
-		if !scanned {
+		input, err := readInput(reader)
+		if err == errInterrupted {
+			continue
+		}
+		if err != nil {
 			return
 		}
 
-		line := scanner.Text()
-		l := lexer.New(line)
-		p := parser.New(l)
-
-		program := p.ParseProgram()
-		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
+		if strings.TrimSpace(input) == "" {
 			continue
 		}
+		if isCommand(input) {
+			s.command(input)
+			continue
+		}
+		s.run(input)
+	}
+}
 
-		comp := compiler.NewWithState(symbolTable, constants)
-		if err := comp.Compile(program); err != nil {
-			io.WriteString(out, fmt.Sprintf("error during compilation: %v", err))
+// run evaluates input on the current backend and prints the result
+func (s *session) run(input string) {
+	if result := s.eval(input); result != nil {
+		io.WriteString(s.out, result.Inspect())
+		io.WriteString(s.out, "\n")
+	}
+}
+
+// eval evaluates input on the current backend. Errors are printed as they
+// occur.
+func (s *session) eval(input string) object.Object {
+	program, ok := s.parse(input)
+	if !ok {
+		return nil
+	}
+
+	evaluator.DefineMacros(program, s.macroEnv)
+	expanded, err := evaluator.ExpandMacros(program, s.macroEnv)
+	if err != nil {
+		fmt.Fprintf(s.out, "error during macro expansion: %v\n", err)
+		return nil
+	}
+
+	if s.backend == backendEval {
+		return evaluator.Eval(expanded, s.env)
+	}
+
+	// compile against a copy of the symbol table so that a failing input
+	// leaves no half-made definitions behind
+	symbolTable := s.symbolTable.Clone()
+	comp := compiler.NewWithState(symbolTable, s.constants)
+	comp.SetLoader(s.loader, "")
+	if err := comp.Compile(expanded); err != nil {
+		fmt.Fprintf(s.out, "error during compilation: %v\n", err)
+		return nil
+	}
+	byteCode := comp.ByteCode()
+
+	// globals assigned before an error are restored along with the symbol
+	// table
+	saved := make([]object.Object, s.symbolTable.NumDefinitions())
+	copy(saved, s.globals)
+	s.globals = vm.GrowGlobals(s.globals, byteCode.NumGlobals)
+
+	machine := vm.NewWithBuiltins(byteCode, s.globals, s.vmBuiltins())
+	if err := machine.Run(); err != nil {
+		fmt.Fprintf(s.out, "error during execution: %v\n", err)
+		for i := range s.globals[:symbolTable.NumDefinitions()] {
+			s.globals[i] = nil
 		}
+		copy(s.globals, saved)
+		return nil
+	}
+	s.symbolTable, s.constants = symbolTable, byteCode.Constants
 
-		machine := vm.NewWithGlobals(comp.ByteCode(), globals)
-		if err := machine.Run(); err != nil {
-			io.WriteString(out, fmt.Sprintf("error during execution: %v", err))
+	// the stack holds leftovers of let statements too
+	if !compiler.EndsWithValue(expanded) {
+		return nil
+	}
+	return machine.LastPopped()
+}
+
+// numGlobals returns the number of globals defined in symbolTable
+func numGlobals(symbolTable *compiler.SymbolTable) int {
+	n := 0
+	for _, symbol := range symbolTable.Symbols() {
+		if symbol.Scope == compiler.GlobalScope {
+			n++
 		}
+	}
+	return n
+}
+
+// parse parses input, printing the parser errors if there are any
+func (s *session) parse(input string) (*ast.Program, bool) {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(s.out, p.Errors())
+		return nil, false
+	}
+	return program, true
+}
+
+// readInput reads lines until they form a complete input, showing the
+// continuation prompt while brackets are left open
+func readInput(reader lineReader) (string, error) {
+	input, err := reader.readLine(prompt)
+	if err != nil {
+		return "", err
+	}
+	if isCommand(input) {
+		return input, nil
+	}
 
-		result := machine.LastPopped()
-		io.WriteString(out, result.Inspect())
-		io.WriteString(out, "\n")
+	for !isComplete(input) {
+		line, err := reader.readLine(continuationPrompt)
+		if err == io.EOF {
+			// let the parser report what is missing
+			return input, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		input += "\n" + line
 	}
+
+	return input, nil
+}
+
+func isCommand(input string) bool {
+	return strings.HasPrefix(strings.TrimSpace(input), ":")
 }
 
 func printParserErrors(out io.Writer, errors []string) {
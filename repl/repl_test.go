@@ -0,0 +1,124 @@
+package repl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// runSession feeds lines to a fresh session and returns what it printed
+// without the prompts
+func runSession(t *testing.T, lines ...string) string {
+	t.Helper()
+
+	out := &bytes.Buffer{}
+	Start(strings.NewReader(strings.Join(lines, "\n")+"\n"), out)
+
+	return strings.Replace(out.String(), prompt, "", -1)
+}
+
+func TestStartWritesToOut(t *testing.T) {
+	out := &bytes.Buffer{}
+	Start(strings.NewReader("1 + 2\nif (true) {\n  5\n}\n"), out)
+
+	expected := ">> 3\n>> .. .. 5\n>> "
+	if out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestPutsWritesToOut(t *testing.T) {
+	for _, backend := range []string{backendVM, backendEval} {
+		actual := runSession(t, ":backend "+backend, `puts("hi")`)
+		if !strings.HasSuffix(actual, "hi\nnull\n") {
+			t.Errorf("puts output missing on %s backend. got=%q", backend, actual)
+		}
+
+		actual = runSession(t, ":backend "+backend,
+			`let m = macro() { puts("expanding"); quote(1) };`, "m()")
+		if !strings.HasSuffix(actual, "expanding\n1\n") {
+			t.Errorf("puts output of macro missing on %s backend. got=%q", backend, actual)
+		}
+	}
+}
+
+func TestErrorHandling(t *testing.T) {
+	tests := []struct {
+		name     string
+		lines    []string
+		expected string
+	}{
+		{
+			"blank lines",
+			[]string{"", "   ", "1"},
+			"1\n",
+		},
+		{
+			"statements without value",
+			[]string{"let a = 1;", "// nothing to run", "a; let b = 2;"},
+			"",
+		},
+		{
+			"parse error",
+			[]string{"let 1", "2"},
+			"Woops! We ran into some monkey business here!\n" +
+				" parser errors:\n" +
+				"\texpected next token to be IDENT, got INT instead\n" +
+				"2\n",
+		},
+		{
+			"compile error stops",
+			[]string{"1 + x", "2"},
+			"error during compilation: undefined variable: x\n2\n",
+		},
+		{
+			"compile error rolls back definitions",
+			[]string{"let a = 1; let b = c;", "a", "let d = 4;", ":globals"},
+			"error during compilation: undefined variable: c\n" +
+				"error during compilation: undefined variable: a\n" +
+				"0 d = 4\n",
+		},
+		{
+			"runtime error stops",
+			[]string{"1 + true", "-true", "3"},
+			"error during execution: type mismatch: INTEGER + BOOLEAN\n" +
+				"error during execution: unknown operator: -BOOLEAN\n" +
+				"3\n",
+		},
+		{
+			"runtime error rolls back definitions",
+			[]string{"let a = 1 + true;", "a", "let b = 2;", "b"},
+			"error during execution: type mismatch: INTEGER + BOOLEAN\n" +
+				"error during compilation: undefined variable: a\n" +
+				"2\n",
+		},
+		{
+			"runtime error restores globals",
+			[]string{"let a = 1;", "let b = 2; let a = 3; 1 + true", "a", ":globals"},
+			"error during execution: type mismatch: INTEGER + BOOLEAN\n" +
+				"1\n" +
+				"0 a = 1\n",
+		},
+		{
+			"state survives errors",
+			[]string{"let a = 10;", "a + x", "a * 2"},
+			"error during compilation: undefined variable: x\n20\n",
+		},
+		{
+			"functions across inputs",
+			[]string{"let adder = fn(a) { fn(b) { a + b + 100 } }; 0", "let addTwo = adder(2); 1", "addTwo(3)"},
+			"0\n1\n105\n",
+		},
+		{
+			"evaluator errors",
+			[]string{":backend eval", "1 + true", "let a = 2;", "a"},
+			"backend: eval\nERROR: type mismatch: INTEGER + BOOLEAN\n2\n",
+		},
+	}
+
+	for _, tt := range tests {
+		if actual := runSession(t, tt.lines...); actual != tt.expected {
+			t.Errorf("%s: wrong output.\nwant=%q\ngot=%q", tt.name, tt.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+//go:build linux
+
+package repl
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+func getTermios(fd uintptr) (*syscall.Termios, error) {
+	termios := &syscall.Termios{}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TCGETS, uintptr(unsafe.Pointer(termios)))
+	if errno != 0 {
+		return nil, errno
+	}
+	return termios, nil
+}
+
+func setTermios(fd uintptr, termios *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TCSETS, uintptr(unsafe.Pointer(termios)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func isTerminal(fd uintptr) bool {
+	_, err := getTermios(fd)
+	return err == nil
+}
+
+// makeRaw puts the terminal into raw mode so that keys are read one at a
+// time without echo. Output processing stays on so "\n" still starts a new
+// line. The returned function restores the previous mode.
+func makeRaw(fd uintptr) (func(), error) {
+	old, err := getTermios(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := *old
+	raw.Iflag &^= syscall.BRKINT | syscall.ICRNL | syscall.INPCK | syscall.ISTRIP | syscall.IXON
+	raw.Cflag |= syscall.CS8
+	raw.Lflag &^= syscall.ECHO | syscall.ICANON | syscall.IEXTEN | syscall.ISIG
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+
+	if err := setTermios(fd, &raw); err != nil {
+		return nil, err
+	}
+	return func() { setTermios(fd, old) }, nil
+}
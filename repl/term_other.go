@@ -0,0 +1,16 @@
+//go:build !linux
+
+package repl
+
+import "errors"
+
+// line editing is only supported on linux terminals; elsewhere the REPL
+// reads plain lines
+
+func isTerminal(fd uintptr) bool {
+	return false
+}
+
+func makeRaw(fd uintptr) (func(), error) {
+	return nil, errors.New("raw terminal mode not supported")
+}
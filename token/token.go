@@ -5,6 +5,7 @@ type TokenType string
 const (
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
+	COMMENT = "COMMENT" // line comment starting with //
 
 	// Identifiers + literals
 	IDENT  = "IDENT"  // add, foobar, x, y, ...
@@ -45,21 +46,37 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	MACRO    = "MACRO"
+	IMPORT   = "IMPORT"
+	EXPORT   = "EXPORT"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
+	THROW    = "THROW"
 )
 
 type Token struct {
 	Type    TokenType
 	Literal string
+	Line    int // 1-based line of the first character of the token
+	Column  int // 1-based column of the first character of the token
 }
 
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
+	"fn":      FUNCTION,
+	"let":     LET,
+	"true":    TRUE,
+	"false":   FALSE,
+	"if":      IF,
+	"else":    ELSE,
+	"return":  RETURN,
+	"macro":   MACRO,
+	"import":  IMPORT,
+	"export":  EXPORT,
+	"try":     TRY,
+	"catch":   CATCH,
+	"finally": FINALLY,
+	"throw":   THROW,
 }
 
 func LookupIdent(ident string) TokenType {
@@ -0,0 +1,38 @@
+package vm
+
+import (
+	"monkey-compiler/code"
+	"monkey-compiler/object"
+)
+
+// Frame is the call frame of a running closure
+type Frame struct {
+	cl          *object.Closure
+	ip          int
+	basePointer int // stack pointer before the call; locals start here
+
+	module   *object.Module // module whose body runs in the frame, if any
+	handlers []handler      // try blocks being run, innermost last
+}
+
+// handler is a try block being run by a frame
+type handler struct {
+	catch    int  // position of the catch block
+	finally  int  // position of the finally block, 0 if there is none
+	sp       int  // stack pointer when the try block was entered
+	catching bool // the catch block is running
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
+
+// position returns the source position of the instruction being run, 0s
+// when it has none
+func (f *Frame) position() (line, column int) {
+	return f.cl.Fn.Positions.Lookup(f.ip)
+}
@@ -0,0 +1,110 @@
+package vm
+
+import (
+	"io/ioutil"
+	"monkey-compiler/compiler"
+	"monkey-compiler/module"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testModules = map[string]string{
+	"math.mk": `
+		let secret = 40;
+		let two = 2;
+		export let add = fn(a, b) { a + b };
+		export let answer = fn() { secret + two };
+	`,
+	"lib/double.mk": `
+		let math = import "../math";
+		export let double = fn(x) { math["add"](x, x) };
+	`,
+	"cycle/a.mk": `import "./b";`,
+	"cycle/b.mk": `import "./a";`,
+	"broken.mk":  `export let f = fn() { missing };`,
+}
+
+func TestModules(t *testing.T) {
+	dir := writeModules(t, testModules)
+	defer os.RemoveAll(dir)
+
+	testCases := []vmTestCase{
+		{`let m = import "math"; m["add"](1, 2)`, 3},
+		// the module's secret is not the main program's
+		{`let secret = 1; let m = import "math"; m["answer"]() + secret`, 43},
+		{`let m = import "math"; m["secret"]`, Null},
+		{`import "lib/double"["double"](21)`, 42},
+		// modules run once and are shared by every import
+		{`import "math" == import "math"`, true},
+		{`let f = fn() { import "math" }; f() == import "math"`, true},
+	}
+
+	for _, tc := range testCases {
+		vm := newModuleVM(t, dir, tc.input)
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error for %q: %s", tc.input, err)
+		}
+		testObject(t, tc.expected, vm.LastPopped())
+	}
+}
+
+func TestModuleErrors(t *testing.T) {
+	dir := writeModules(t, testModules)
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "missing"`, `module "missing.mk" not found`},
+		{`import "cycle/a"`, "import cycle: "},
+		{`import "broken"`, "broken.mk:1:23: undefined variable: missing"},
+	}
+
+	for _, tt := range tests {
+		c := compiler.New()
+		c.SetLoader(module.NewLoader(dir), "")
+		err := c.Compile(parse(tt.input))
+		if err == nil {
+			t.Errorf("expected compile error for %q", tt.input)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func newModuleVM(t *testing.T, dir, input string) *VM {
+	t.Helper()
+
+	c := compiler.New()
+	c.SetLoader(module.NewLoader(dir), "")
+	if err := c.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return New(c.ByteCode())
+}
+
+// writeModules writes files, keyed by slash-separated path, into a new
+// temporary directory and returns it
+func writeModules(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "modules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
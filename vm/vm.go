@@ -1,46 +1,187 @@
 package vm
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"monkey-compiler/code"
 	"monkey-compiler/compiler"
+	"monkey-compiler/limit"
 	"monkey-compiler/object"
 )
 
+// StackSize is the default maximum size of the stack
 const StackSize = 2048
+
+// InitialStackSize is the default size of the stack when a VM is made.
+// The stack grows on demand up to its maximum size.
+const InitialStackSize = 64
+
+// GlobalsSize is the maximum number of globals, as many as the operand of
+// OpGetGlobal and OpSetGlobal can address
 const GlobalsSize = 65536
 
-var True = &object.Boolean{Value: true}
-var False = &object.Boolean{Value: false}
-var Null = &object.Null{}
+// MaxFrames is the default maximum number of frames, the main one included
+const MaxFrames = 1024
+
+// Options sets the sizes of the memory of a VM. Zero fields take the
+// default sizes.
+type Options struct {
+	InitialStackSize int // initial size of the stack
+	MaxStackSize     int // size the stack may grow to
+	GlobalsSize      int // number of globals, by default those the byte code uses
+	MaxFrames        int // number of frames calls may use, the main one included
+}
+
+func (o Options) withDefaults() Options {
+	if o.MaxStackSize <= 0 {
+		o.MaxStackSize = StackSize
+	}
+	if o.InitialStackSize <= 0 {
+		o.InitialStackSize = InitialStackSize
+	}
+	if o.InitialStackSize > o.MaxStackSize {
+		o.InitialStackSize = o.MaxStackSize
+	}
+	if o.MaxFrames <= 0 {
+		o.MaxFrames = MaxFrames
+	}
+	return o
+}
+
+var True = object.True
+var False = object.False
+var Null = object.NULL
 
 type VM struct {
-	constants    []object.Object
-	instructions code.Instructions
+	constants []object.Object
+	builtins  []*object.Builtin
 
 	globals []object.Object
 
-	stack []object.Object
-	sp    int // stack pointer. top of the stack is stack[sp-1]
+	stack        []object.Object
+	sp           int // stack pointer. top of the stack is stack[sp-1]
+	maxStackSize int
+
+	frames      []*Frame
+	framesIndex int
+	maxFrames   int
+
+	modules map[*object.Module]object.Object // exports of the modules run
+
+	callbackErr error // error stopping a call made by a builtin
+
+	limits limit.Limits
+	meter  *limit.Meter // meter of the current run, nil when unlimited
 }
 
 func New(byteCode *compiler.ByteCode) *VM {
-	return &VM{
-		constants:    byteCode.Constants,
-		instructions: byteCode.Instructions,
+	return NewWithOptions(byteCode, Options{})
+}
 
-		globals: make([]object.Object, GlobalsSize),
+// NewWithOptions returns a VM with memory of the sizes set by opts
+func NewWithOptions(byteCode *compiler.ByteCode, opts Options) *VM {
+	opts = opts.withDefaults()
+	numGlobals := opts.GlobalsSize
+	if numGlobals <= 0 {
+		numGlobals = byteCode.NumGlobals
+	}
+	return makeVM(byteCode, make([]object.Object, numGlobals), nil, opts)
+}
 
-		stack: make([]object.Object, StackSize),
-		sp:    0,
+// GrowGlobals returns globals grown to hold n globals at least, for hosts
+// keeping globals between runs of programs compiled with the same symbol
+// table
+func GrowGlobals(globals []object.Object, n int) []object.Object {
+	if n <= len(globals) {
+		return globals
 	}
+	return append(globals, make([]object.Object, n-len(globals))...)
 }
 
 func NewWithGlobals(byteCode *compiler.ByteCode, globals []object.Object) *VM {
-	vm := New(byteCode)
-	vm.globals = globals
-	return vm
+	return makeVM(byteCode, globals, nil, Options{}.withDefaults())
+}
+
+// NewWithBuiltins returns a VM resolving OpGetBuiltin against builtins
+// instead of object.Builtins. The compiler's symbol table must define the
+// builtins at the same indexes.
+func NewWithBuiltins(byteCode *compiler.ByteCode, globals []object.Object, builtins []*object.Builtin) *VM {
+	return makeVM(byteCode, globals, builtins, Options{}.withDefaults())
+}
+
+func makeVM(
+	byteCode *compiler.ByteCode,
+	globals []object.Object,
+	builtins []*object.Builtin,
+	opts Options,
+) *VM {
+	mainFn := &object.CompiledFunction{
+		Instructions: byteCode.Instructions,
+		Positions:    byteCode.Positions,
+	}
+	mainClosure := &object.Closure{Fn: mainFn}
+	mainFrame := NewFrame(mainClosure, 0)
+
+	if builtins == nil {
+		builtins = make([]*object.Builtin, len(object.Builtins))
+		for i, def := range object.Builtins {
+			builtins[i] = def.Builtin
+		}
+	}
+
+	return &VM{
+		constants: byteCode.Constants,
+		builtins:  builtins,
+
+		globals: globals,
+
+		stack:        make([]object.Object, opts.InitialStackSize),
+		sp:           0,
+		maxStackSize: opts.MaxStackSize,
+
+		frames:      []*Frame{mainFrame},
+		framesIndex: 1,
+		maxFrames:   opts.MaxFrames,
+
+		modules: make(map[*object.Module]object.Object),
+	}
+}
+
+// SetLimits bounds the resources the following runs may use
+func (vm *VM) SetLimits(limits limit.Limits) {
+	vm.limits = limits
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+// globalsFor returns the globals of the current frame, those of the VM
+// for the main program, checking that they hold the global at index
+func (vm *VM) globalsFor(index int) ([]object.Object, error) {
+	globals := vm.currentFrame().cl.Globals
+	if globals == nil {
+		globals = vm.globals
+	}
+	if index >= len(globals) {
+		return nil, fmt.Errorf("global %d out of range of %d globals", index, len(globals))
+	}
+	return globals, nil
+}
+
+func (vm *VM) pushFrame(f *Frame) {
+	if vm.framesIndex == len(vm.frames) {
+		vm.frames = append(vm.frames, f)
+	} else {
+		vm.frames[vm.framesIndex] = f
+	}
+	vm.framesIndex++
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
 }
 
 func (vm *VM) StackTop() object.Object {
@@ -51,16 +192,66 @@ func (vm *VM) StackTop() object.Object {
 }
 
 func (vm *VM) Run() error {
-	for ip := 0; ip < len(vm.instructions); ip++ {
-		opcode := code.Opcode(vm.instructions[ip])
+	return vm.RunContext(context.Background())
+}
+
+// RunContext runs the program until it finishes, exceeds its limits or ctx
+// is done. Exceeded limits are reported as *limit.LimitError and
+// cancellation as *limit.CanceledError.
+func (vm *VM) RunContext(ctx context.Context) error {
+	vm.meter = limit.NewMeter(ctx, vm.limits)
+	return vm.run(0)
+}
+
+// Exception is an error raised by a program, by a throw statement or a
+// runtime error, and not caught
+type Exception struct {
+	Err *object.Error
+}
+
+func (e *Exception) Error() string {
+	return e.Err.Message
+}
+
+// run executes instructions until the frame at depth is returned to, or
+// the main program ends when depth is 0. Errors raised meanwhile are
+// handled by the try blocks of the frames run, if any.
+func (vm *VM) run(depth int) error {
+	for {
+		err := vm.execute(depth)
+		if err == nil {
+			return nil
+		}
+		if err = vm.handle(err, depth); err != nil {
+			return err
+		}
+	}
+}
+
+// execute runs instructions like run, stopping at the first error
+func (vm *VM) execute(depth int) error {
+	var ip int
+	var ins code.Instructions
+	var opcode code.Opcode
+
+	for vm.framesIndex > depth && vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		if err := vm.meter.Step(); err != nil {
+			return err
+		}
+		vm.currentFrame().ip++
+
+		ip = vm.currentFrame().ip
+		ins = vm.currentFrame().Instructions()
+		opcode = code.Opcode(ins[ip])
 
 		switch opcode {
 		case code.OpConstant:
-			index := code.ReadUint16(vm.instructions[ip+1:])
+			index := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
 			if err := vm.push(vm.constants[index]); err != nil {
 				return err
 			}
-			ip += 2
 		case code.OpTrue:
 			if err := vm.push(True); err != nil {
 				return err
@@ -85,33 +276,178 @@ func (vm *VM) Run() error {
 			if err := vm.executeBinaryOperation(opcode); err != nil {
 				return err
 			}
-		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan:
+		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan:
 			if err := vm.executeComparison(opcode); err != nil {
 				return err
 			}
 		case code.OpPop:
 			vm.pop()
 		case code.OpJump:
-			pos := int(code.ReadUint16(vm.instructions[ip+1:]))
-			ip = pos - 1
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip = pos - 1
 		case code.OpJumpNotTruthy:
-			pos := int(code.ReadUint16(vm.instructions[ip+1:]))
-			ip += 2
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
 
 			condition := vm.pop()
 			if !isTruthy(condition) {
-				ip = pos - 1
+				vm.currentFrame().ip = pos - 1
 			}
 		case code.OpSetGlobal:
-			index := int(code.ReadUint16(vm.instructions[ip+1:]))
-			ip += 2
+			index := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
 
-			vm.globals[index] = vm.pop()
+			globals, err := vm.globalsFor(index)
+			if err != nil {
+				return err
+			}
+			globals[index] = vm.pop()
 		case code.OpGetGlobal:
-			index := int(code.ReadUint16(vm.instructions[ip+1:]))
-			ip += 2
+			index := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
 
-			if err := vm.push(vm.globals[index]); err != nil {
+			globals, err := vm.globalsFor(index)
+			if err != nil {
+				return err
+			}
+			if err := vm.push(globals[index]); err != nil {
+				return err
+			}
+		case code.OpSetLocal:
+			index := int(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip++
+
+			frame := vm.currentFrame()
+			vm.stack[frame.basePointer+index] = vm.pop()
+		case code.OpGetLocal:
+			index := int(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip++
+
+			frame := vm.currentFrame()
+			if err := vm.push(vm.stack[frame.basePointer+index]); err != nil {
+				return err
+			}
+		case code.OpGetBuiltin:
+			index := int(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip++
+
+			if err := vm.push(vm.builtins[index]); err != nil {
+				return err
+			}
+		case code.OpGetFree:
+			index := int(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip++
+
+			if err := vm.push(vm.currentFrame().cl.Free[index]); err != nil {
+				return err
+			}
+		case code.OpImport:
+			constIndex := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			if err := vm.importModule(constIndex); err != nil {
+				return err
+			}
+		case code.OpCurrentClosure:
+			if err := vm.push(vm.currentFrame().cl); err != nil {
+				return err
+			}
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			if err := vm.meter.Alloc(1); err != nil {
+				return err
+			}
+			array := vm.buildArray(vm.sp-numElements, vm.sp)
+			vm.sp = vm.sp - numElements
+
+			if err := vm.push(array); err != nil {
+				return err
+			}
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			if err := vm.meter.Alloc(1); err != nil {
+				return err
+			}
+			hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
+			if err != nil {
+				return err
+			}
+			vm.sp = vm.sp - numElements
+
+			if err := vm.push(hash); err != nil {
+				return err
+			}
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+
+			if err := vm.executeIndexExpression(left, index); err != nil {
+				return err
+			}
+		case code.OpClosure:
+			constIndex := int(code.ReadUint16(ins[ip+1:]))
+			numFree := int(code.ReadUint8(ins[ip+3:]))
+			vm.currentFrame().ip += 3
+
+			if err := vm.pushClosure(constIndex, numFree); err != nil {
+				return err
+			}
+		case code.OpCall:
+			numArgs := int(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip++
+
+			if err := vm.executeCall(numArgs); err != nil {
+				return err
+			}
+		case code.OpTailCall:
+			numArgs := int(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip++
+
+			if err := vm.executeTailCall(numArgs); err != nil {
+				return err
+			}
+		case code.OpReturnValue:
+			ended, err := vm.returnValue(vm.pop())
+			if err != nil || ended {
+				return err
+			}
+		case code.OpReturn:
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+			vm.meter.Leave()
+
+			if err := vm.push(Null); err != nil {
+				return err
+			}
+		case code.OpSetupTry:
+			catch := int(code.ReadUint16(ins[ip+1:]))
+			finally := int(code.ReadUint16(ins[ip+3:]))
+			vm.currentFrame().ip += 4
+
+			frame := vm.currentFrame()
+			frame.handlers = append(frame.handlers, handler{catch: catch, finally: finally, sp: vm.sp})
+		case code.OpEndTry:
+			frame := vm.currentFrame()
+			frame.handlers = frame.handlers[:len(frame.handlers)-1]
+		case code.OpThrow:
+			return &Exception{Err: object.Thrown(vm.pop())}
+		case code.OpEndFinally:
+			pending := vm.pop()
+			if pending == Null {
+				break
+			}
+
+			// drop the value of the try expression
+			vm.pop()
+			if err, ok := pending.(*object.Error); ok {
+				return &Exception{Err: err}
+			}
+			ended, err := vm.returnValue(pending.(*object.ReturnValue).Value)
+			if err != nil || ended {
 				return err
 			}
 		}
@@ -120,9 +456,355 @@ func (vm *VM) Run() error {
 	return nil
 }
 
+// returnValue returns value from the current frame, reporting whether that
+// ended the main program. The finally block of a try block left by the
+// return runs first, returning value when it ends.
+func (vm *VM) returnValue(value object.Object) (bool, error) {
+	frame := vm.currentFrame()
+	for len(frame.handlers) > 0 {
+		h := frame.handlers[len(frame.handlers)-1]
+		frame.handlers = frame.handlers[:len(frame.handlers)-1]
+		if h.finally != 0 {
+			vm.sp = h.sp
+			frame.ip = h.finally - 1
+			return false, vm.pushAll(Null, &object.ReturnValue{Value: value})
+		}
+	}
+
+	if vm.framesIndex == 1 {
+		// returning from the main program ends it, leaving the value as
+		// the last popped one
+		vm.stack[vm.sp] = value
+		return true, nil
+	}
+
+	frame = vm.popFrame()
+	vm.sp = frame.basePointer - 1
+	vm.meter.Leave()
+	if frame.module != nil {
+		vm.modules[frame.module] = value
+	}
+
+	return false, vm.push(value)
+}
+
+// handle unwinds the frames run at depth to the innermost try block that
+// was being run when err was raised. The catch block of the try block is
+// entered with the error on the stack, or its finally block if the error
+// was raised by the catch block. Without such a try block the error is
+// returned as an *Exception, or as it is for exceeded limits, which are
+// never handled.
+func (vm *VM) handle(err error, depth int) error {
+	if vm.meter.Err() != nil {
+		return err
+	}
+	exc := vm.errorObject(err)
+
+	for vm.framesIndex > depth {
+		frame := vm.currentFrame()
+		for len(frame.handlers) > 0 {
+			h := &frame.handlers[len(frame.handlers)-1]
+			if !h.catching {
+				h.catching = true
+				vm.sp = h.sp
+				frame.ip = h.catch - 1
+				exc.Held = true
+				return vm.push(exc)
+			}
+
+			frame.handlers = frame.handlers[:len(frame.handlers)-1]
+			if h.finally != 0 {
+				vm.sp = h.sp
+				frame.ip = h.finally - 1
+				return vm.pushAll(Null, exc)
+			}
+		}
+
+		if vm.framesIndex == 1 {
+			break
+		}
+		vm.popFrame()
+		vm.meter.Leave()
+	}
+	return &Exception{Err: exc}
+}
+
+// errorObject returns the error object caught for err, recording the
+// functions being called if it has no stack yet and the position of the
+// instruction raising it if it has none
+func (vm *VM) errorObject(err error) *object.Error {
+	var exc *Exception
+	obj := &object.Error{Message: err.Error()}
+	if errors.As(err, &exc) {
+		obj = exc.Err
+	}
+	vm.locate(obj)
+
+	if obj.Stack == nil {
+		obj.Stack = []string{}
+		for i := vm.framesIndex - 1; i > 0; i-- {
+			fn := vm.frames[i]
+			if fn.module != nil {
+				continue
+			}
+			name := fn.cl.Fn.Name
+			if name == "" {
+				name = object.AnonymousFunction
+			}
+			obj.Stack = append(obj.Stack, name)
+		}
+	}
+	return obj
+}
+
+// locate records the position of the instruction being run as that of err,
+// unless it has one
+func (vm *VM) locate(err *object.Error) {
+	if err.Line == 0 {
+		err.Line, err.Column = vm.currentFrame().position()
+	}
+}
+
+func (vm *VM) executeCall(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return fmt.Errorf("not a function: %s", callee.Type())
+	}
+}
+
+// executeTailCall calls a function in tail position. A closure replaces
+// the closure of the current frame, which the call would only return to
+// for returning its value, so that tail calls do not use up frames.
+// Anything else is called like executeCall does, the following
+// OpReturnValue returning its value.
+func (vm *VM) executeTailCall(numArgs int) error {
+	cl, ok := vm.stack[vm.sp-1-numArgs].(*object.Closure)
+	frame := vm.currentFrame()
+	if !ok || vm.framesIndex == 1 || frame.module != nil {
+		return vm.executeCall(numArgs)
+	}
+	if numArgs != cl.Fn.NumParameters {
+		return fmt.Errorf("wrong number of arguments: want=%d, got=%d", cl.Fn.NumParameters, numArgs)
+	}
+	if err := vm.reserve(frame.basePointer + cl.Fn.NumLocals); err != nil {
+		return err
+	}
+
+	// move the closure and its arguments over those of the current frame
+	copy(vm.stack[frame.basePointer-1:], vm.stack[vm.sp-1-numArgs:vm.sp])
+	frame.cl = cl
+	frame.ip = -1
+	frame.handlers = nil
+	vm.sp = frame.basePointer + cl.Fn.NumLocals
+
+	return nil
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+	if numArgs != cl.Fn.NumParameters {
+		return fmt.Errorf("wrong number of arguments: want=%d, got=%d", cl.Fn.NumParameters, numArgs)
+	}
+	if vm.framesIndex >= vm.maxFrames {
+		return fmt.Errorf("frame overflow at call depth %d", vm.framesIndex-1)
+	}
+	if err := vm.meter.Enter(); err != nil {
+		return err
+	}
+
+	frame := NewFrame(cl, vm.sp-numArgs)
+	if err := vm.reserve(frame.basePointer + cl.Fn.NumLocals); err != nil {
+		return err
+	}
+	vm.pushFrame(frame)
+	vm.sp = frame.basePointer + cl.Fn.NumLocals
+
+	return nil
+}
+
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	args := vm.stack[vm.sp-numArgs : vm.sp]
+	if builtin.Size != nil {
+		if err := vm.meter.Alloc(builtin.Size(args...)); err != nil {
+			return err
+		}
+	}
+
+	var result object.Object
+	if builtin.HigherOrder != nil {
+		result = builtin.HigherOrder(vm.callback, args...)
+		if err := vm.callbackErr; err != nil {
+			vm.callbackErr = nil
+			return err
+		}
+	} else {
+		result = builtin.Fn(args...)
+	}
+	vm.sp = vm.sp - numArgs - 1
+
+	if result == nil {
+		return vm.push(Null)
+	}
+	if builtin.Size == nil {
+		if err := vm.meter.Alloc(object.Size(result)); err != nil {
+			return err
+		}
+	}
+	if err, ok := result.(*object.Error); ok {
+		vm.locate(err)
+	}
+	return vm.push(result)
+}
+
+// callback calls fn for a higher-order builtin, running the VM until fn
+// returns. An error stopping the VM is kept in vm.callbackErr for
+// callBuiltin to report, the builtin only seeing an error object.
+func (vm *VM) callback(fn object.Object, args ...object.Object) object.Object {
+	if vm.callbackErr != nil {
+		return &object.Error{Message: vm.callbackErr.Error()}
+	}
+
+	depth := vm.framesIndex
+	err := vm.push(fn)
+	for _, arg := range args {
+		if err == nil {
+			err = vm.push(arg)
+		}
+	}
+	if err == nil {
+		err = vm.executeCall(len(args))
+	}
+	if err == nil && vm.framesIndex > depth {
+		err = vm.run(depth)
+	}
+	if err != nil {
+		vm.callbackErr = err
+		return &object.Error{Message: err.Error()}
+	}
+
+	return vm.pop()
+}
+
+func (vm *VM) pushClosure(constIndex int, numFree int) error {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", constant)
+	}
+
+	if err := vm.meter.Alloc(1); err != nil {
+		return err
+	}
+
+	free := make([]object.Object, numFree)
+	copy(free, vm.stack[vm.sp-numFree:vm.sp])
+	vm.sp = vm.sp - numFree
+
+	globals := vm.currentFrame().cl.Globals
+	return vm.push(&object.Closure{Fn: function, Free: free, Globals: globals})
+}
+
+// importModule pushes the exports of a module, running the module first if
+// it has not run yet. A module runs like a call of a closure with globals
+// of its own, its exports being recorded when it returns.
+func (vm *VM) importModule(constIndex int) error {
+	mod, ok := vm.constants[constIndex].(*object.Module)
+	if !ok {
+		return fmt.Errorf("not a module: %+v", vm.constants[constIndex])
+	}
+	if exports, ok := vm.modules[mod]; ok {
+		return vm.push(exports)
+	}
+
+	if err := vm.meter.Alloc(1); err != nil {
+		return err
+	}
+	cl := &object.Closure{Fn: mod.Fn, Globals: make([]object.Object, mod.NumGlobals)}
+	if err := vm.push(cl); err != nil {
+		return err
+	}
+	if err := vm.callClosure(cl, 0); err != nil {
+		return err
+	}
+	vm.currentFrame().module = mod
+
+	return nil
+}
+
+func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
+	elements := make([]object.Object, endIndex-startIndex)
+	copy(elements, vm.stack[startIndex:endIndex])
+
+	return &object.Array{Elements: elements}
+}
+
+func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
+	hash := object.NewHash((endIndex - startIndex) / 2)
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+		}
+		hash.Set(hashKey, value)
+	}
+
+	return hash, nil
+}
+
+func (vm *VM) executeIndexExpression(left, index object.Object) error {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		return vm.executeArrayIndex(left, index)
+	case left.Type() == object.HASH_OBJ:
+		return vm.executeHashIndex(left, index)
+	case left.Type() == object.ERROR_OBJ && index.Type() == object.STRING_OBJ:
+		field, ok := left.(*object.Error).Field(index.(*object.String).Value)
+		if !ok {
+			return vm.push(Null)
+		}
+		return vm.push(field)
+	default:
+		return fmt.Errorf("index operator not supported: %s", left.Type())
+	}
+}
+
+func (vm *VM) executeArrayIndex(array, index object.Object) error {
+	elements := array.(*object.Array).Elements
+	i := index.(*object.Integer).Value
+	max := int64(len(elements) - 1)
+
+	if i < 0 || i > max {
+		return vm.push(Null)
+	}
+	return vm.push(elements[i])
+}
+
+func (vm *VM) executeHashIndex(hash, index object.Object) error {
+	hashObject := hash.(*object.Hash)
+
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return fmt.Errorf("unusable as hash key: %s", index.Type())
+	}
+
+	value, ok := hashObject.Get(key)
+	if !ok {
+		return vm.push(Null)
+	}
+	return vm.push(value)
+}
+
 func (vm *VM) push(o object.Object) error {
-	if vm.sp >= StackSize {
-		return errors.New("stack overflow")
+	if err := vm.reserve(vm.sp + 1); err != nil {
+		return err
 	}
 
 	vm.stack[vm.sp] = o
@@ -131,6 +813,38 @@ func (vm *VM) push(o object.Object) error {
 	return nil
 }
 
+// reserve grows the stack to at least size slots, doubling its size up to
+// the maximum one
+func (vm *VM) reserve(size int) error {
+	if size <= len(vm.stack) {
+		return nil
+	}
+	if size > vm.maxStackSize {
+		return fmt.Errorf("stack overflow at call depth %d", vm.framesIndex-1)
+	}
+
+	grown := 2 * len(vm.stack)
+	if grown < size {
+		grown = size
+	}
+	if grown > vm.maxStackSize {
+		grown = vm.maxStackSize
+	}
+	stack := make([]object.Object, grown)
+	copy(stack, vm.stack)
+	vm.stack = stack
+	return nil
+}
+
+func (vm *VM) pushAll(objects ...object.Object) error {
+	for _, o := range objects {
+		if err := vm.push(o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (vm *VM) pop() object.Object {
 	if vm.sp == 0 {
 		return nil
@@ -156,11 +870,15 @@ func (vm *VM) executeBangOperator() error {
 func (vm *VM) executeMinusOperator() error {
 	operand := vm.pop()
 	if operand.Type() != object.INTEGER_OBJ {
-		return fmt.Errorf("unsupported type for negation by minus: %s", operand.Type())
+		return fmt.Errorf("unknown operator: -%s", operand.Type())
+	}
+
+	if err := vm.meter.Alloc(1); err != nil {
+		return err
 	}
 
 	value := operand.(*object.Integer).Value
-	return vm.push(&object.Integer{Value: -value})
+	return vm.push(object.NewInteger(-value))
 }
 
 func (vm *VM) executeBinaryOperation(opcode code.Opcode) error {
@@ -170,17 +888,45 @@ func (vm *VM) executeBinaryOperation(opcode code.Opcode) error {
 	rightType := right.Type()
 	leftType := left.Type()
 
-	if rightType == object.INTEGER_OBJ && leftType == object.INTEGER_OBJ {
+	switch {
+	case rightType == object.INTEGER_OBJ && leftType == object.INTEGER_OBJ:
 		return vm.executeBinaryIntegerOperation(opcode, left, right)
+	case rightType == object.STRING_OBJ && leftType == object.STRING_OBJ:
+		return vm.executeBinaryStringOperation(opcode, left, right)
 	}
 
-	return fmt.Errorf("unsupported types for binary operation: %s and %s", leftType, rightType)
+	return operatorError(opcode, left, right)
+}
+
+// operators are the operators of the source compiled to binary operations
+var operators = map[code.Opcode]string{
+	code.OpAdd:         "+",
+	code.OpSub:         "-",
+	code.OpMul:         "*",
+	code.OpDiv:         "/",
+	code.OpEqual:       "==",
+	code.OpNotEqual:    "!=",
+	code.OpGreaterThan: ">",
+	code.OpLessThan:    "<",
+}
+
+// operatorError returns the error of a binary operation unsupported for
+// its operands, worded like the evaluator does
+func operatorError(opcode code.Opcode, left, right object.Object) error {
+	if left.Type() != right.Type() {
+		return fmt.Errorf("type mismatch: %s %s %s", left.Type(), operators[opcode], right.Type())
+	}
+	return fmt.Errorf("unknown operator: %s %s %s", left.Type(), operators[opcode], right.Type())
 }
 
 func (vm *VM) executeBinaryIntegerOperation(opcode code.Opcode, left, right object.Object) error {
 	leftValue := left.(*object.Integer).Value
 	rightValue := right.(*object.Integer).Value
 
+	if err := vm.meter.Alloc(1); err != nil {
+		return err
+	}
+
 	var result int64
 	switch opcode {
 	case code.OpAdd:
@@ -190,32 +936,58 @@ func (vm *VM) executeBinaryIntegerOperation(opcode code.Opcode, left, right obje
 	case code.OpMul:
 		result = leftValue * rightValue
 	case code.OpDiv:
+		if rightValue == 0 {
+			return errors.New("division by zero")
+		}
 		result = leftValue / rightValue
 	default:
-		return fmt.Errorf("unknown integer operator: %d", opcode)
+		return operatorError(opcode, left, right)
 	}
 
-	return vm.push(&object.Integer{Value: result})
+	return vm.push(object.NewInteger(result))
+}
+
+func (vm *VM) executeBinaryStringOperation(opcode code.Opcode, left, right object.Object) error {
+	if opcode != code.OpAdd {
+		return operatorError(opcode, left, right)
+	}
+
+	leftValue := left.(*object.String).Value
+	rightValue := right.(*object.String).Value
+
+	// concatenations are charged by length, lest doubling a string
+	// exhaust memory
+	if err := vm.meter.Alloc(object.StringSize(len(leftValue) + len(rightValue))); err != nil {
+		return err
+	}
+	return vm.push(&object.String{Value: leftValue + rightValue})
 }
 
 func (vm *VM) executeComparison(opcode code.Opcode) error {
 	right := vm.pop()
 	left := vm.pop()
 
+	if err := vm.meter.Alloc(1); err != nil {
+		return err
+	}
+
 	rightType := right.Type()
 	leftType := left.Type()
 
 	if rightType == object.INTEGER_OBJ && leftType == object.INTEGER_OBJ {
 		return vm.executeIntegerComparison(opcode, left, right)
 	}
+	if rightType == object.STRING_OBJ && leftType == object.STRING_OBJ {
+		return vm.executeStringComparison(opcode, left, right)
+	}
 
 	switch opcode {
 	case code.OpEqual:
-		return vm.push(&object.Boolean{Value: left == right})
+		return vm.push(nativeBoolToBooleanObject(left == right))
 	case code.OpNotEqual:
-		return vm.push(&object.Boolean{Value: left != right})
+		return vm.push(nativeBoolToBooleanObject(left != right))
 	}
-	return fmt.Errorf("unsupported types for binary operation: %s and %s", leftType, rightType)
+	return operatorError(opcode, left, right)
 }
 
 func (vm *VM) executeIntegerComparison(opcode code.Opcode, left, right object.Object) error {
@@ -230,17 +1002,44 @@ func (vm *VM) executeIntegerComparison(opcode code.Opcode, left, right object.Ob
 		result = leftValue != rightValue
 	case code.OpGreaterThan:
 		result = leftValue > rightValue
+	case code.OpLessThan:
+		result = leftValue < rightValue
 	default:
-		return fmt.Errorf("unknown integer operator: %d", opcode)
+		return operatorError(opcode, left, right)
 	}
 
-	return vm.push(&object.Boolean{Value: result})
+	return vm.push(nativeBoolToBooleanObject(result))
 }
 
+func (vm *VM) executeStringComparison(opcode code.Opcode, left, right object.Object) error {
+	leftValue := left.(*object.String).Value
+	rightValue := right.(*object.String).Value
+
+	switch opcode {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue == rightValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue != rightValue))
+	}
+	return operatorError(opcode, left, right)
+}
+
+// LastPopped returns the element most recently popped off the stack, or nil
+// if nothing was popped
 func (vm *VM) LastPopped() object.Object {
+	if vm.sp == len(vm.stack) {
+		return nil
+	}
 	return vm.stack[vm.sp]
 }
 
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return True
+	}
+	return False
+}
+
 func isTruthy(obj object.Object) bool {
 	switch obj := obj.(type) {
 	case *object.Boolean:
@@ -1,12 +1,19 @@
 package vm
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"monkey-compiler/ast"
 	"monkey-compiler/compiler"
+	"monkey-compiler/evaluator"
 	"monkey-compiler/lexer"
+	"monkey-compiler/limit"
 	"monkey-compiler/object"
 	"monkey-compiler/parser"
+	"strings"
 	"testing"
+	"time"
 )
 
 type vmTestCase struct {
@@ -52,6 +59,11 @@ func TestBooleanExpression(t *testing.T) {
 		{"!false;", true},
 		{"!!true;", true},
 		{"!(if (false) { 10; })", true},
+		{"(1 < 2) == true", true},
+		{"(1 == 1) == true", true},
+		{"(1 != 1) == false", true},
+		{"(true == true) == true", true},
+		{"(1 > 2) != false", false},
 	}
 
 	runVmTests(t, testCases)
@@ -85,6 +97,861 @@ func TestGlobalLetStatements(t *testing.T) {
 	runVmTests(t, testCases)
 }
 
+func TestMacroExpansion(t *testing.T) {
+	input := `
+	let unless = macro(condition, consequence, alternative) {
+		quote(if (!(unquote(condition))) {
+			unquote(consequence);
+		} else {
+			unquote(alternative);
+		});
+	};
+	unless(10 > 5, 1, 2);
+	`
+
+	program := parse(input)
+	env := object.NewEnvironment()
+	evaluator.DefineMacros(program, env)
+	expanded, err := evaluator.ExpandMacros(program, env)
+	if err != nil {
+		t.Fatalf("macro expansion error: %s", err)
+	}
+
+	c := compiler.New()
+	if err := c.Compile(expanded); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(c.ByteCode())
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	testObject(t, 2, vm.LastPopped())
+}
+
+func TestStringExpressions(t *testing.T) {
+	testCases := []vmTestCase{
+		{`"monkey"`, "monkey"},
+		{`"mon" + "key"`, "monkey"},
+		{`"mon" + "key" + "banana"`, "monkeybanana"},
+		{`"monkey" == "mon" + "key"`, true},
+		{`"monkey" == "banana"`, false},
+		{`"monkey" != "monkey"`, false},
+	}
+
+	runVmTests(t, testCases)
+}
+
+func TestArrayLiterals(t *testing.T) {
+	testCases := []vmTestCase{
+		{"[]", []int{}},
+		{"[1, 2, 3]", []int{1, 2, 3}},
+		{"[1 + 2, 3 * 4, 5 + 6]", []int{3, 12, 11}},
+	}
+
+	runVmTests(t, testCases)
+}
+
+func TestHashLiterals(t *testing.T) {
+	testCases := []vmTestCase{
+		{"{}", map[object.HashKey]int64{}},
+		{
+			"{1: 2, 2: 3}",
+			map[object.HashKey]int64{
+				(&object.Integer{Value: 1}).HashKey(): 2,
+				(&object.Integer{Value: 2}).HashKey(): 3,
+			},
+		},
+		{
+			"{1 + 1: 2 * 2, 3 + 3: 4 * 4}",
+			map[object.HashKey]int64{
+				(&object.Integer{Value: 2}).HashKey(): 4,
+				(&object.Integer{Value: 6}).HashKey(): 16,
+			},
+		},
+	}
+
+	runVmTests(t, testCases)
+}
+
+func TestIndexExpressions(t *testing.T) {
+	testCases := []vmTestCase{
+		{"[1, 2, 3][1]", 2},
+		{"[1, 2, 3][0 + 2]", 3},
+		{"[[1, 1, 1]][0][0]", 1},
+		{"[][0]", Null},
+		{"[1, 2, 3][99]", Null},
+		{"[1][-1]", Null},
+		{"{1: 1, 2: 2}[1]", 1},
+		{"{1: 1, 2: 2}[2]", 2},
+		{"{1: 1}[0]", Null},
+		{"{}[0]", Null},
+		{`{"a": 5}["a"]`, 5},
+	}
+
+	runVmTests(t, testCases)
+}
+
+func TestCallingFunctions(t *testing.T) {
+	testCases := []vmTestCase{
+		{"let fivePlusTen = fn() { 5 + 10; }; fivePlusTen();", 15},
+		{"let one = fn() { 1; }; let two = fn() { 2; }; one() + two()", 3},
+		{"let a = fn() { 1 }; let b = fn() { a() + 1 }; let c = fn() { b() + 1 }; c();", 3},
+		{"let earlyExit = fn() { return 99; 100; }; earlyExit();", 99},
+		{"let earlyExit = fn() { return 99; return 100; }; earlyExit();", 99},
+		{"let noReturn = fn() { }; noReturn();", Null},
+		{"let noReturn = fn() { }; let noReturnTwo = fn() { noReturn(); }; noReturn(); noReturnTwo();", Null},
+		{"let returnsOne = fn() { 1; }; let returnsOneReturner = fn() { returnsOne; }; returnsOneReturner()();", 1},
+		{"return 5; 10", 5},
+	}
+
+	runVmTests(t, testCases)
+}
+
+func TestCallingFunctionsWithBindings(t *testing.T) {
+	testCases := []vmTestCase{
+		{"let one = fn() { let one = 1; one }; one();", 1},
+		{"let oneAndTwo = fn() { let one = 1; let two = 2; one + two; }; oneAndTwo();", 3},
+		{`
+		let firstFoobar = fn() { let foobar = 50; foobar; };
+		let secondFoobar = fn() { let foobar = 100; foobar; };
+		firstFoobar() + secondFoobar();
+		`, 150},
+		{`
+		let globalSeed = 50;
+		let minusOne = fn() { let num = 1; globalSeed - num; }
+		let minusTwo = fn() { let num = 2; globalSeed - num; }
+		minusOne() + minusTwo();
+		`, 97},
+	}
+
+	runVmTests(t, testCases)
+}
+
+func TestCallingFunctionsWithArgumentsAndBindings(t *testing.T) {
+	testCases := []vmTestCase{
+		{"let identity = fn(a) { a; }; identity(4);", 4},
+		{"let sum = fn(a, b) { a + b; }; sum(1, 2);", 3},
+		{"let sum = fn(a, b) { let c = a + b; c; }; sum(1, 2) + sum(3, 4);", 10},
+		{`
+		let sum = fn(a, b) { let c = a + b; c; };
+		let outer = fn() { sum(1, 2) + sum(3, 4); };
+		outer();
+		`, 10},
+		{`
+		let globalNum = 10;
+		let sum = fn(a, b) { let c = a + b; c + globalNum; };
+		let outer = fn() { sum(1, 2) + sum(3, 4) + globalNum; };
+		outer() + globalNum;
+		`, 50},
+	}
+
+	runVmTests(t, testCases)
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	testCases := []vmTestCase{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len([1, 2, 3])`, 3},
+		{`len(1)`, &object.Error{Message: "argument to `len` not supported, got INTEGER"}},
+		{`len("one", "two")`, &object.Error{Message: "wrong number of arguments. got=2, want=1"}},
+		{`puts("hello")`, Null},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, Null},
+		{`last([1, 2, 3])`, 3},
+		{`rest([1, 2, 3])`, []int{2, 3}},
+		{`rest([])`, Null},
+		{`push([], 1)`, []int{1}},
+		{`push(1, 1)`, &object.Error{Message: "argument to `push` must be ARRAY, got INTEGER"}},
+	}
+
+	runVmTests(t, testCases)
+}
+
+func TestCollectionBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, "[2, 4, 6]"},
+		{`let offset = 10; map([1, 2], fn(x) { x + offset })`, "[11, 12]"},
+		{`map(["a", "bb"], len)`, "[1, 2]"},
+		{`map([], fn(x) { x })`, "[]"},
+		{`filter([1, 2, 3, 4], fn(x) { x > 2 })`, "[3, 4]"},
+		{`reduce([1, 2, 3, 4], 0, fn(acc, x) { acc + x })`, "10"},
+		{`reduce([], 5, fn(acc, x) { acc + x })`, "5"},
+		{`sort([3, 1, 2])`, "[1, 2, 3]"},
+		{`sort(["b", "c", "a"])`, "[a, b, c]"},
+		{`sort([3, 1, 2], fn(a, b) { a > b })`, "[3, 2, 1]"},
+		{`let a = [2, 1]; sort(a); a`, "[2, 1]"},
+		{`reverse([1, 2, 3])`, "[3, 2, 1]"},
+		{`contains([1, "a", [2]], "a")`, "true"},
+		{`contains([1, "a", [2]], [2])`, "true"},
+		{`!contains([1, 2], 3)`, "true"},
+		{`contains({"a": 1}, "a")`, "true"},
+		{`keys({"b": 2, "a": 1, 3: 0})`, "[b, a, 3]"},
+		{`values({"b": 2, "a": 1})`, "[2, 1]"},
+		{`keys({"a": 1, "b": 2, "a": 3})`, "[a, b]"},
+		{`{"z": 1, "y": 2, true: 3, 0: 4}`, "{z: 1, y: 2, true: 3, 0: 4}"},
+		{`keys(delete({"c": 1, "a": 2, "b": 3}, "a"))`, "[c, b]"},
+		{`merge({"b": 1, "a": 2}, {"c": 3, "b": 4})`, "{b: 4, a: 2, c: 3}"},
+		{`range(3)`, "[0, 1, 2]"},
+		{`range(2, 5)`, "[2, 3, 4]"},
+		{`range(5, 0, -2)`, "[5, 3, 1]"},
+		{`slice([1, 2, 3, 4], 1, 3)`, "[2, 3]"},
+		{`slice([1, 2, 3, 4], -2)`, "[3, 4]"},
+		{`slice([1, 2, 3], 2, 10)`, "[3]"},
+		{`join(["a", "b", "c"], ", ")`, "a, b, c"},
+		{`zip([1, 2, 3], ["a", "b"])`, "[[1, a], [2, b]]"},
+		{`map(["a", 1], len)`, "ERROR: argument to `len` not supported, got INTEGER"},
+		{`sort([1, "a"])`, "ERROR: cannot sort STRING and INTEGER"},
+		{`range(1, 2, 0)`, "ERROR: step of `range` must not be 0"},
+		{`range(9223372036854775806, 9223372036854775807, 5)`, "[9223372036854775806]"},
+		{`range(0, 50000000)`, "ERROR: range of 50000000 integers exceeds the maximum length of 4194304"},
+		{`join([1], "")`, "ERROR: elements to `join` must be STRING, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		vm := newVM(t, tt.input)
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+		if actual := vm.LastPopped().Inspect(); actual != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestStringBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`split("a,b,,c", ",")`, "[a, b, , c]"},
+		{"split(\"  one two\tthree \")", "[one, two, three]"},
+		{`join(split("a b c"), "-")`, "a-b-c"},
+		{`slice("hello", 1, 3)`, "el"},
+		{`slice("hello", -3)`, "llo"},
+		{`index_of("banana", "an")`, "1"},
+		{`index_of("banana", "x")`, "-1"},
+		{`index_of([1, 2, 3], 3)`, "2"},
+		{`contains("monkey", "key")`, "true"},
+		{`starts_with("monkey", "mon")`, "true"},
+		{`ends_with("monkey", "mon")`, "false"},
+		{`upper("Monkey")`, "MONKEY"},
+		{`lower("Monkey")`, "monkey"},
+		{"trim(\"  monkey \n\")", "monkey"},
+		{`replace("a-b-c", "-", "+")`, "a+b+c"},
+		{`repeat("ab", 3)`, "ababab"},
+		{`char(97) + char(955)`, "aλ"},
+		{`ord("a")`, "97"},
+		{`ord("λ")`, "955"},
+		{`format("%d items for %s: %v", 3, "you", [1, "a"])`, "3 items for you: [1, a]"},
+		{`format("100%%")`, "100%"},
+		{`upper(1)`, "ERROR: arguments to `upper` must be STRING, got INTEGER"},
+		{`repeat("a", -1)`, "ERROR: count to `repeat` must not be negative, got -1"},
+		{`repeat("ab", 9223372036854775807)`, "ERROR: repeating 2 bytes 9223372036854775807 times exceeds the maximum length of 4194304"},
+		{`replace(repeat("a", 3000), "", repeat("b", 3000))`, "ERROR: replacing in 3000 bytes makes 9006000 bytes, exceeding the maximum length of 4194304"},
+		{`len(replace("abab", "", "-"))`, "9"},
+		{`let s = repeat("a", 1000000); join([s, s, s, s, s])`, "ERROR: joining 5 strings makes 5000000 bytes, exceeding the maximum length of 4194304"},
+		{`ord("ab")`, "ERROR: argument to `ord` must be a single character, got \"ab\""},
+		{`format("%d", "a")`, "ERROR: format: %d expects INTEGER, got STRING"},
+		{`format("%d %d", 1)`, "ERROR: format: missing argument for %d"},
+		{`format("%d", 1, 2)`, "ERROR: format: 1 arguments left unused"},
+	}
+
+	for _, tt := range tests {
+		vm := newVM(t, tt.input)
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+		if actual := vm.LastPopped().Inspect(); actual != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestConversionBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`type(1)`, "INTEGER"},
+		{`type("a")`, "STRING"},
+		{`type(true)`, "BOOLEAN"},
+		{`type(if (false) { 1 })`, "NULL"},
+		{`type([])`, "ARRAY"},
+		{`type({})`, "HASH"},
+		{`type(len)`, "BUILTIN"},
+		{`str(12) + str(true) + str("!")`, "12true!"},
+		{`str([1, "a"])`, "[1, a]"},
+		{`int("42") + 1`, "43"},
+		{`int(" -7 ")`, "-7"},
+		{`int(true) + int(false)`, "1"},
+		{`int("4x2")`, "ERROR: cannot convert \"4x2\" to INTEGER"},
+		{`int([])`, "ERROR: argument to `int` not supported, got ARRAY"},
+		{`bool(0)`, "true"},
+		{`bool("")`, "true"},
+		{`bool(if (false) { 1 })`, "false"},
+		{`!bool(false)`, "true"},
+		{`bool(1) == true`, "true"},
+		{`inspect("a")`, "\"a\""},
+		{`inspect([1, "a", {"k": [true]}])`, "[1, \"a\", {\"k\": [true]}]"},
+		{`type(fn() {})`, "CLOSURE"},
+	}
+
+	for _, tt := range tests {
+		vm := newVM(t, tt.input)
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+		if actual := vm.LastPopped().Inspect(); actual != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestJSONBuiltins(t *testing.T) {
+	// string literals cannot contain double quotes, so JSON documents are
+	// written with single quotes replaced by q
+	quote := `let q = fn(s) { replace(s, "'", char(34)) }; `
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`json_parse("42")`, "42"},
+		{`json_parse(q(" 'a' "))`, "a"},
+		{`json_parse(q("[1, true, null, 'x']"))`, "[1, true, null, x]"},
+		{`json_parse(q("{'a': {'b': [1, 2]}}"))["a"]["b"][1]`, "2"},
+		{`json_parse("[null]")[0] == json_parse("null")`, "true"},
+		{`if (json_parse("[null]")[0]) { 1 } else { 2 }`, "2"},
+		{`json_parse(q("{'a': 1"))`, "ERROR: json_parse: unexpected end of JSON input"},
+		{`json_parse("[1,]")`, "ERROR: json_parse: invalid character ',' looking for beginning of value"},
+		{`json_parse("1 2")`, "ERROR: json_parse: unexpected data after JSON value"},
+		{`json_parse("1.5")`, "ERROR: json_parse: number 1.5 is not a 64-bit integer"},
+		{`json_parse(1)`, "ERROR: arguments to `json_parse` must be STRING, got INTEGER"},
+		{`json_stringify({"b": [1, "x"], "a": if (false) { 1 }, "c": true})`, `{"b":[1,"x"],"a":null,"c":true}`},
+		{`json_stringify(q("<a'b>"))`, `"<a\"b>"`},
+		{`json_stringify({"a": [1]}, true)`, "{\n  \"a\": [\n    1\n  ]\n}"},
+		{`json_stringify(json_parse(q("{'k': [1, {'v': false}], 'a': 1}")))`, `{"k":[1,{"v":false}],"a":1}`},
+		{`json_stringify({1: 2})`, "ERROR: json_stringify: keys must be STRING, got INTEGER"},
+		{`json_stringify([len])`, "ERROR: json_stringify: cannot encode BUILTIN"},
+		{`json_stringify(1, "yes")`, "ERROR: second argument to `json_stringify` must be BOOLEAN, got STRING"},
+	}
+
+	for _, tt := range tests {
+		vm := newVM(t, quote+tt.input)
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+		if actual := vm.LastPopped().Inspect(); actual != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestBuiltinCallbackErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`map([1], fn() { 1 })`, "wrong number of arguments: want=0, got=1"},
+		{`map([1], 1)`, "not a function: INTEGER"},
+		{`map([1], fn(x) { x() })`, "not a function: INTEGER"},
+	}
+
+	for _, tt := range tests {
+		err := newVM(t, tt.input).Run()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong VM error for %q. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestClosures(t *testing.T) {
+	testCases := []vmTestCase{
+		{"let newClosure = fn(a) { fn() { a; }; }; let closure = newClosure(99); closure();", 99},
+		{"let newAdder = fn(a, b) { fn(c) { a + b + c }; }; let adder = newAdder(1, 2); adder(8);", 11},
+		{"let newAdder = fn(a, b) { let c = a + b; fn(d) { c + d }; }; let adder = newAdder(1, 2); adder(8);", 11},
+		{`
+		let newAdderOuter = fn(a, b) {
+			let c = a + b;
+			fn(d) {
+				let e = d + c;
+				fn(f) { e + f; };
+			};
+		};
+		let newAdderInner = newAdderOuter(1, 2)
+		let adder = newAdderInner(3);
+		adder(8);
+		`, 14},
+		{`
+		let newClosure = fn(a, b) {
+			let one = fn() { a; };
+			let two = fn() { b; };
+			fn() { one() + two(); };
+		};
+		let closure = newClosure(9, 90);
+		closure();
+		`, 99},
+	}
+
+	runVmTests(t, testCases)
+}
+
+func TestRecursiveFunctions(t *testing.T) {
+	testCases := []vmTestCase{
+		{`
+		let countDown = fn(x) { if (x == 0) { return 0; } else { countDown(x - 1); } };
+		countDown(1);
+		`, 0},
+		{`
+		let wrapper = fn() {
+			let countDown = fn(x) { if (x == 0) { return 0; } else { countDown(x - 1); } };
+			countDown(1);
+		};
+		wrapper();
+		`, 0},
+		{`
+		let fibonacci = fn(x) {
+			if (x == 0) { return 0; }
+			if (x == 1) { return 1; }
+			fibonacci(x - 1) + fibonacci(x - 2);
+		};
+		fibonacci(15);
+		`, 610},
+	}
+
+	runVmTests(t, testCases)
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn() { 1; }(1);", "wrong number of arguments: want=0, got=1"},
+		{"fn(a) { a; }();", "wrong number of arguments: want=1, got=0"},
+		{"1();", "not a function: INTEGER"},
+		{"10 / (5 - 5);", "division by zero"},
+		{"1[0];", "index operator not supported: INTEGER"},
+		{"{[1]: 2};", "unusable as hash key: ARRAY"},
+		{`"a" - "b";`, "unknown operator: STRING - STRING"},
+		{"1 < true;", "type mismatch: INTEGER < BOOLEAN"},
+		{"true > false;", "unknown operator: BOOLEAN > BOOLEAN"},
+		{"[1] + [2];", "unknown operator: ARRAY + ARRAY"},
+		{`-"a";`, "unknown operator: -STRING"},
+		{"(1 + true) < (2 + -true);", "type mismatch: INTEGER + BOOLEAN"},
+		{"let f = fn() { 1 + f() }; f();", "frame overflow at call depth 1023"},
+	}
+
+	for _, tt := range tests {
+		c := compiler.New()
+		if err := c.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(c.ByteCode())
+		err := vm.Run()
+		if err == nil {
+			t.Errorf("expected VM error for %q", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong VM error for %q. want=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input  string
+		line   int
+		column int
+	}{
+		{"5 + true;", 1, 3},
+		{"let a = 1;\nlet b = -true;", 2, 9},
+		{"let f = fn() {\n  1 + true\n};\nf()", 2, 5},
+		{"let f = fn(a) { a };\nf()", 2, 2},
+		{"len(1)", 1, 4},
+		{"[1][true]", 1, 4},
+		{"{[1]: 2}", 1, 1},
+		{`throw "x"`, 1, 1},
+		{"let e = error(\"x\");\nthrow e", 1, 14},
+		{"try { 1 + true } catch (e) { throw e }", 1, 9},
+		{"let f = fn(x) { if (x) { 1 + true } };\nmap([true], f)", 1, 28},
+	}
+
+	for _, tt := range tests {
+		vm := newVM(t, tt.input)
+		var errObj *object.Error
+		if err := vm.Run(); err != nil {
+			exc, ok := err.(*Exception)
+			if !ok {
+				t.Fatalf("vm error for %q: %s", tt.input, err)
+			}
+			errObj = exc.Err
+		} else {
+			obj, ok := vm.LastPopped().(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned for %q. got=%T(%+v)",
+					tt.input, vm.LastPopped(), vm.LastPopped())
+				continue
+			}
+			errObj = obj
+		}
+
+		if errObj.Line != tt.line || errObj.Column != tt.column {
+			t.Errorf("wrong error position for %q. want=%d:%d, got=%d:%d",
+				tt.input, tt.line, tt.column, errObj.Line, errObj.Column)
+		}
+	}
+}
+
+func TestErrorBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`is_error(error("x"))`, "true"},
+		{`is_error(1)`, "false"},
+		{`is_error(if (false) { 1 })`, "false"},
+		{`error("x")`, "ERROR: x"},
+		{`error("x")["message"]`, "x"},
+		{`let e = error("x"); [1, 2]`, "[1, 2]"},
+		{`let check = fn(n) { if (n < 0) { return error("negative") } n }; is_error(check(-1))`, "true"},
+		{`try { throw error("bad") } catch (e) { e["message"] }`, "bad"},
+		{`is_error(try { 1 + true } catch (e) { e })`, "true"},
+		{`map([1, -1], fn(n) { if (n < 0) { error("neg") } else { n } })`, "[1, ERROR: neg]"},
+		{`error(1)`, "ERROR: arguments to `error` must be STRING, got INTEGER"},
+		{`is_error()`, "ERROR: wrong number of arguments. got=0, want=1"},
+		{`try { 1 + true } catch (e) { [e["line"], e["column"]] }`, "[1, 9]"},
+		{`error("x")["column"]`, "6"},
+		{`try { throw "x" } catch (e) { e["line"] }`, "1"},
+	}
+
+	for _, tt := range tests {
+		vm := newVM(t, tt.input)
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+		if actual := vm.LastPopped().Inspect(); actual != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestTryCatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`try { 1 } catch (e) { 2 }`, "1"},
+		{`try { throw "boom"; 1 } catch (e) { e["message"] }`, "boom"},
+		{`try { 1 + true } catch (e) { 2 }`, "2"},
+		{`try { throw 42 } catch (e) { e["message"] }`, "42"},
+		{`try { throw "a" } catch (e) { e }`, "ERROR: a"},
+		{`let x = 5; try { throw 1 } catch (x) { x }; x`, "5"},
+		{`let x = 5; try { throw 1 } catch (e) { let x = 6; x }; x`, "5"},
+		{`let f = fn() { let x = 5; try { throw 1 } catch (x) { x }; x }; f()`, "5"},
+		{`let f = try { throw "a" } catch (e) { fn() { e["message"] } }; f()`, "a"},
+		{`let f = fn() { try { throw "a" } catch (e) { fn() { e["message"] } } }; f()()`, "a"},
+		{`try { try { throw "inner" } catch (e) { throw e["message"] + "!" } } catch (e) { e["message"] }`, "inner!"},
+		{`try { try { throw "a" } catch (e) { throw e } } catch (f) { f["message"] }`, "a"},
+		{`try { throw "a" } catch (e) { e["unknown"] }`, "null"},
+		{`let f = fn() { throw "deep" }; let g = fn() { 1 + f() }; try { g() } catch (e) { e["stack"] }`, "[f, g]"},
+		{`let f = fn() { throw "deep" }; let g = fn() { f() }; try { g() } catch (e) { e["stack"] }`, "[f]"},
+		{`let f = fn() { try { throw "x" } catch (e) { e["stack"] } }; f()`, "[f]"},
+		{`try { fn() { throw "x" }() } catch (e) { e["stack"] }`, "[<anonymous>]"},
+		{`try { throw "x" } catch (e) { e["stack"] }`, "[]"},
+		{`let f = fn(n) { if (n == 0) { throw "bottom" }; 1 + f(n - 1) }; try { f(3) } catch (e) { len(e["stack"]) }`, "4"},
+		{`let log = []; let r = try { 1 } catch (e) { 2 } finally { let log = push(log, "f") }; [r, log]`, "[1, [f]]"},
+		{`let log = []; let r = try { throw "x" } catch (e) { 2 } finally { let log = push(log, "f") }; [r, log]`, "[2, [f]]"},
+		{`let log = []; let r = try { try { throw "x" } catch (e) { throw "y" } finally { let log = push(log, "f") } } catch (e) { e["message"] }; [r, log]`, "[y, [f]]"},
+		{`let f = fn() { try { return 1 } catch (e) { 2 } finally { 5 }; 3 }; f()`, "1"},
+		{`let f = fn() { try { return 1 } catch (e) { 2 } finally { throw "finally ran" } }; try { f() } catch (e) { e["message"] }`, "finally ran"},
+		{`let f = fn() { try { throw "x" } catch (e) { return 2 } finally { 3 }; 4 }; f()`, "2"},
+		{`let f = fn() { try { 1 } catch (e) { 2 } finally { return 3 } }; f()`, "3"},
+		{`let f = fn() { try { try { return 1 } catch (e) { 0 } finally { 2 } } catch (e) { 0 } finally { 3 } }; f()`, "1"},
+		{`let f = fn() { try { throw "x" } catch (e) { 1 } }; f() + f()`, "2"},
+		{`let g = fn(x) { if (x == 2) { throw "two" } x }; try { map([1, 2, 3], g) } catch (e) { e["message"] }`, "two"},
+		{`1 + try { throw "x" } catch (e) { 2 }`, "3"},
+		{`if (try { false } catch (e) { true }) { 1 } else { 2 }`, "2"},
+	}
+
+	for _, tt := range tests {
+		vm := newVM(t, tt.input)
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+		if actual := vm.LastPopped().Inspect(); actual != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestUncaughtErrors(t *testing.T) {
+	tests := []struct {
+		input   string
+		message string
+		stack   []string
+	}{
+		{`throw "boom"`, "boom", []string{}},
+		{`let f = fn() { throw "boom" }; f()`, "boom", []string{"f"}},
+		{`let f = fn() { 1 + true }; f()`, "type mismatch: INTEGER + BOOLEAN", []string{"f"}},
+		{`try { throw "a" } catch (e) { throw "b" }`, "b", []string{}},
+		{`try { 1 } catch (e) { 2 } finally { throw "c" }`, "c", []string{}},
+		{`try { throw "a" } catch (e) { throw "b" } finally { 3 }`, "b", []string{}},
+	}
+
+	for _, tt := range tests {
+		vm := newVM(t, tt.input)
+		err := vm.Run()
+
+		var exc *Exception
+		if !errors.As(err, &exc) {
+			t.Errorf("expected Exception for %q. got=%v", tt.input, err)
+			continue
+		}
+		if exc.Err.Message != tt.message {
+			t.Errorf("wrong message for %q. want=%q, got=%q", tt.input, tt.message, exc.Err.Message)
+		}
+		if strings.Join(exc.Err.Stack, ",") != strings.Join(tt.stack, ",") {
+			t.Errorf("wrong stack for %q. want=%v, got=%v", tt.input, tt.stack, exc.Err.Stack)
+		}
+	}
+}
+
+func TestLimitsNotCaught(t *testing.T) {
+	vm := newVM(t, "let f = fn() { 1 + f() }; try { f() } catch (e) { 1 }")
+	vm.SetLimits(limit.Limits{MaxDepth: 10})
+
+	var limitErr *limit.LimitError
+	if err := vm.Run(); !errors.As(err, &limitErr) {
+		t.Fatalf("expected LimitError. got=%v", err)
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let countdown = fn(n) { if (n == 0) { 0 } else { countdown(n - 1) } }; countdown(1000000)", "0"},
+		{"let countdown = fn(n) { if (n > 0) { return countdown(n - 1) }; n }; countdown(1000000)", "0"},
+		{"let sum = fn(n, acc) { if (n == 0) { acc } else { sum(n - 1, acc + n) } }; sum(100000, 0)", "5000050000"},
+		{"let even = fn(n, odd) { if (n == 0) { true } else { odd(n - 1, even) } }; let odd = fn(n, even) { if (n == 0) { false } else { even(n - 1, odd) } }; even(100001, odd)", "false"},
+		{"let f = fn(a) { len(a) }; f([1, 2])", "2"},
+		{"let f = fn(x) { if (x) { len([1]) } else { 2 } }; f(true)", "1"},
+		{"let f = fn(n) { if (n == 0) { fn() { 7 } } else { f(n - 1) } }; f(10)()", "7"},
+		{"let adder = fn(a) { fn(b) { a + b } }; let add = fn(a, b) { adder(a)(b) }; add(1, 2)", "3"},
+		{"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; map([3, 2], fn(n) { f(n) })", "[0, 0]"},
+		{"let f = fn() { 1 }; let g = fn() { try { f() } catch (e) { 2 } }; g()", "1"},
+	}
+
+	for _, tt := range tests {
+		vm := newVM(t, tt.input)
+		vm.SetLimits(limit.Limits{MaxDepth: 3})
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+		if actual := vm.LastPopped().Inspect(); actual != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestOptions(t *testing.T) {
+	recursion := "let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(%d)"
+
+	tests := []struct {
+		input    string
+		opts     Options
+		expected string
+		err      string
+	}{
+		{fmt.Sprintf(recursion, 300), Options{InitialStackSize: 1}, "300", ""},
+		{fmt.Sprintf(recursion, 300), Options{InitialStackSize: 4096}, "300", ""},
+		{fmt.Sprintf(recursion, 100), Options{MaxStackSize: 32}, "", "stack overflow at call depth 10"},
+		{fmt.Sprintf("try { %s } catch (e) { e[\"message\"] }", fmt.Sprintf(recursion, 100)),
+			Options{InitialStackSize: 2, MaxStackSize: 32}, "stack overflow at call depth 10", ""},
+		{"let a = 1; let b = 2; a + b", Options{GlobalsSize: 2}, "3", ""},
+		{"let a = 1; let b = 2; a + b", Options{GlobalsSize: 1}, "", "global 1 out of range of 1 globals"},
+		{fmt.Sprintf(recursion, 8), Options{MaxFrames: 10}, "8", ""},
+		{fmt.Sprintf(recursion, 9), Options{MaxFrames: 10}, "", "frame overflow at call depth 9"},
+		{"[1, 2, 3, 4, 5]", Options{InitialStackSize: 1, MaxStackSize: 4}, "", "stack overflow at call depth 0"},
+	}
+
+	for _, tt := range tests {
+		c := compiler.New()
+		if err := c.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := NewWithOptions(c.ByteCode(), tt.opts)
+		err := vm.Run()
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("wrong error for %q with %+v. want=%q, got=%v", tt.input, tt.opts, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("vm error for %q with %+v: %s", tt.input, tt.opts, err)
+		}
+		if actual := vm.LastPopped().Inspect(); actual != tt.expected {
+			t.Errorf("wrong result for %q with %+v. want=%q, got=%q", tt.input, tt.opts, tt.expected, actual)
+		}
+	}
+}
+
+func TestGlobals(t *testing.T) {
+	c := compiler.New()
+	if err := c.Compile(parse("let a = 1; let f = fn() { let b = 2; a + b }; f()")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(c.ByteCode())
+	if len(vm.globals) != 2 {
+		t.Errorf("globals not sized from the byte code. want=2, got=%d", len(vm.globals))
+	}
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if actual := vm.LastPopped().Inspect(); actual != "3" {
+		t.Errorf("wrong result. want=%q, got=%q", "3", actual)
+	}
+}
+
+func TestGrowGlobals(t *testing.T) {
+	globals := []object.Object{object.NewInteger(1)}
+
+	if grown := GrowGlobals(globals, 1); len(grown) != 1 {
+		t.Errorf("globals grown needlessly. got len=%d", len(grown))
+	}
+	grown := GrowGlobals(globals, 3)
+	if len(grown) != 3 {
+		t.Fatalf("globals not grown. want len=3, got=%d", len(grown))
+	}
+	if grown[0] != globals[0] || grown[1] != nil || grown[2] != nil {
+		t.Errorf("wrong globals after growing. got=%v", grown)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	countdown := "let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(100);"
+	// tail calls do not count toward the call depth
+	recursion := "let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(100);"
+
+	tests := []struct {
+		input    string
+		limits   limit.Limits
+		expected string
+	}{
+		{countdown, limit.Limits{MaxInstructions: 100}, limit.Instructions},
+		{recursion, limit.Limits{MaxDepth: 10}, limit.Depth},
+		{countdown, limit.Limits{MaxObjects: 50}, limit.Objects},
+		{"[[1], [2]];", limit.Limits{MaxObjects: 2}, limit.Objects},
+		{`"a" + "b" + "c";`, limit.Limits{MaxObjects: 1}, limit.Objects},
+		// builtins account for what they make
+		{"len(range(0, 50000000));", limit.Limits{MaxObjects: 1000}, limit.Objects},
+		{"let xs = range(100); push(xs, 1);", limit.Limits{MaxObjects: 150}, limit.Objects},
+		{`let s = repeat("a", 100000); join([s, s, s]);`, limit.Limits{MaxObjects: 10000}, limit.Objects},
+		{`replace(repeat("a", 1000), "", repeat("b", 1000));`, limit.Limits{MaxObjects: 10000}, limit.Objects},
+		{`let double = fn(s, n) { if (n == 0) { s } else { double(s + s, n - 1) } }; len(double("a", 27));`,
+			limit.Limits{MaxObjects: 1000}, limit.Objects},
+	}
+
+	for _, tt := range tests {
+		vm := newVM(t, tt.input)
+		vm.SetLimits(tt.limits)
+
+		err := vm.Run()
+		var limitErr *limit.LimitError
+		if !errors.As(err, &limitErr) {
+			t.Errorf("expected LimitError for %q with %+v. got=%v", tt.input, tt.limits, err)
+			continue
+		}
+		if limitErr.Limit != tt.expected {
+			t.Errorf("wrong limit exceeded for %q. want=%q, got=%q", tt.input, tt.expected, limitErr.Limit)
+		}
+	}
+}
+
+func TestWithinLimits(t *testing.T) {
+	vm := newVM(t, "let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(100);")
+	vm.SetLimits(limit.Limits{MaxInstructions: 10000, MaxDepth: 101, MaxObjects: 1000})
+
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testIntegerObject(t, 0, vm.LastPopped())
+}
+
+func TestRunContext(t *testing.T) {
+	// about 2^30 calls, far longer than the timeout
+	input := "let f = fn(n) { if (n == 0) { 0 } else { f(n - 1); f(n - 1) } }; f(30);"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := newVM(t, input).RunContext(ctx)
+	var canceledErr *limit.CanceledError
+	if !errors.As(err, &canceledErr) {
+		t.Fatalf("expected CanceledError. got=%v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected error to wrap context.DeadlineExceeded. got=%v", err)
+	}
+}
+
+func BenchmarkIntegerArithmetic(b *testing.B) {
+	benchmarkRun(b, `
+let collatz = fn(n, steps) {
+  if (n == 1) { return steps }
+  if (n / 2 * 2 == n) { collatz(n / 2, steps + 1) } else { collatz(3 * n + 1, steps + 1) }
+};
+let loop = fn(i, total) { if (i == 0) { total } else { loop(i - 1, total + collatz(27, 0) - 100) } };
+loop(100, 0)`)
+}
+
+func BenchmarkComparisons(b *testing.B) {
+	benchmarkRun(b, `
+let loop = fn(i, count) {
+  if (i == 0) { return count }
+  if ((i > 500) == true) { loop(i - 1, count + 1) } else { loop(i - 1, count) }
+};
+loop(1000, 0)`)
+}
+
+func benchmarkRun(b *testing.B, input string) {
+	c := compiler.New()
+	if err := c.Compile(parse(input)); err != nil {
+		b.Fatalf("compiler error: %s", err)
+	}
+	byteCode := c.ByteCode()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := NewWithOptions(byteCode, Options{GlobalsSize: 16}).Run(); err != nil {
+			b.Fatalf("vm error: %s", err)
+		}
+	}
+}
+
+func newVM(t *testing.T, input string) *VM {
+	t.Helper()
+
+	c := compiler.New()
+	if err := c.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return New(c.ByteCode())
+}
+
 func runVmTests(t *testing.T, testCases []vmTestCase) {
 	t.Helper()
 
@@ -122,6 +989,42 @@ func testObject(t *testing.T, expected interface{}, actual object.Object) {
 		testIntegerObject(t, int64(expected), actual)
 	case bool:
 		testBooleanObject(t, expected, actual)
+	case string:
+		testStringObject(t, expected, actual)
+	case []int:
+		array, ok := actual.(*object.Array)
+		if !ok {
+			t.Fatalf("object not Array: %T (%+v)", actual, actual)
+		}
+		if len(array.Elements) != len(expected) {
+			t.Fatalf("wrong number of elements. want=%d, got=%d", len(expected), len(array.Elements))
+		}
+		for i, el := range expected {
+			testIntegerObject(t, int64(el), array.Elements[i])
+		}
+	case map[object.HashKey]int64:
+		hash, ok := actual.(*object.Hash)
+		if !ok {
+			t.Fatalf("object not Hash: %T (%+v)", actual, actual)
+		}
+		if hash.Len() != len(expected) {
+			t.Fatalf("wrong number of pairs. want=%d, got=%d", len(expected), hash.Len())
+		}
+		for _, pair := range hash.OrderedPairs() {
+			value, ok := expected[pair.Key.(object.Hashable).HashKey()]
+			if !ok {
+				t.Fatalf("no pair for given key in pairs")
+			}
+			testIntegerObject(t, value, pair.Value)
+		}
+	case *object.Error:
+		err, ok := actual.(*object.Error)
+		if !ok {
+			t.Fatalf("object not Error: %T (%+v)", actual, actual)
+		}
+		if err.Message != expected.Message {
+			t.Fatalf("wrong error message. want=%q, got=%q", expected.Message, err.Message)
+		}
 	case *object.Null:
 		if actual != Null {
 			t.Fatalf("not null. got=%+v", actual)
@@ -154,3 +1057,16 @@ func testBooleanObject(t *testing.T, expected bool, actual object.Object) {
 		t.Fatalf("Boolean valud wrong. want=%t, got=%t", expected, actualBoolean.Value)
 	}
 }
+
+func testStringObject(t *testing.T, expected string, actual object.Object) {
+	t.Helper()
+
+	actualString, ok := actual.(*object.String)
+	if !ok {
+		t.Fatalf("could not convert to String: %+v", actual)
+	}
+
+	if actualString.Value != expected {
+		t.Fatalf("String value wrong. want=%q, got=%q", expected, actualString.Value)
+	}
+}